@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetFeeRules returns the fee rules with optional scope and active filters
+func (s *Service) GetFeeRules(w http.ResponseWriter, r *http.Request) {
+	query := make(bson.M)
+	v := r.URL.Query()
+	if scope := v.Get("scope"); scope != "" {
+		query["scope"] = scope
+	}
+	if active := v.Get("active"); active != "" {
+		query["active"] = active == "true"
+	}
+
+	rules, err := s.fees.Rules(query)
+	if err != nil {
+		log.Printf("get_fee_rules: failed to retrieve rules: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving fee rules")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   rules,
+	})
+}
+
+// CreateFeeRule adds a fee rule, it applies to orders listed and ICO
+// purchases made from then on
+func (s *Service) CreateFeeRule(w http.ResponseWriter, r *http.Request) {
+	var req models.FeeRuleReq
+	if err := utils.DecodeReq(r, &req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	rule, err := s.fees.CreateRule(req)
+	if err != nil {
+		log.Printf("create_fee_rule: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
+		Status:  "success",
+		Code:    http.StatusCreated,
+		Data:    rule,
+		Message: "Fee rule has been created",
+	})
+}
+
+// UpdateFeeRule replaces a fee rule, orders already listed keep their fee
+func (s *Service) UpdateFeeRule(w http.ResponseWriter, r *http.Request) {
+	var req models.FeeRuleReq
+	if err := utils.DecodeReq(r, &req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	rule, err := s.fees.UpdateRule(mux.Vars(r)["id"], req)
+	if err != nil {
+		log.Printf("update_fee_rule: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Data:    rule,
+		Message: "Fee rule has been updated",
+	})
+}
+
+// DeleteFeeRule removes a fee rule
+func (s *Service) DeleteFeeRule(w http.ResponseWriter, r *http.Request) {
+	if err := s.fees.DeleteRule(mux.Vars(r)["id"]); err != nil {
+		log.Printf("delete_fee_rule: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "Fee rule not found")
+		return
+	}
+
+	utils.RespondWithOk(w, "Fee rule has been deleted")
+}
+
+// GetFeeIncome reports trade and ICO fee income per day or month between
+// from and to, the last 30 days by day when they aren't given
+func (s *Service) GetFeeIncome(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -30)
+	period := "day"
+
+	if p := v.Get("period"); p != "" {
+		period = p
+	}
+	if f := v.Get("from"); f != "" {
+		t, err := time.Parse("2006-01-02", f)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "from must be a YYYY-MM-DD date")
+			return
+		}
+		from = t
+	}
+	if t := v.Get("to"); t != "" {
+		d, err := time.Parse("2006-01-02", t)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "to must be a YYYY-MM-DD date")
+			return
+		}
+		// to is inclusive
+		to = d.AddDate(0, 0, 1)
+	}
+
+	income, err := s.fees.Income(from, to, period)
+	if err != nil {
+		log.Printf("get_fee_income: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   income,
+	})
+}
+
+// SetUserTier sets the fee tier a user is charged at
+func (s *Service) SetUserTier(w http.ResponseWriter, r *http.Request) {
+	var req models.UserTierReq
+	if err := utils.DecodeReq(r, &req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	switch req.Tier {
+	case models.TierStandard, models.TierVerified, models.TierPro:
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "Unknown tier "+req.Tier)
+		return
+	}
+
+	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	ok, err := s.userDAO.SetTier(id, req.Tier)
+	if err != nil {
+		log.Printf("set_user_tier: failed to update user %s: %v", id.Hex(), err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating user")
+		return
+	}
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	utils.RespondWithOk(w, "User tier has been updated")
+}
@@ -0,0 +1,24 @@
+package admin
+
+import (
+	"vhennpay-bend/utils"
+	"log"
+	"net/http"
+)
+
+// GetJobs returns the scheduled background jobs with their run metrics and
+// the instance currently holding each lease
+func (s *Service) GetJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.scheduler.Jobs()
+	if err != nil {
+		log.Printf("get_jobs: failed to retrieve jobs: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving jobs")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   jobs,
+	})
+}
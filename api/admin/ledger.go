@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetLedgerBalances returns account balances with an optional account type
+// filter
+func (s *Service) GetLedgerBalances(w http.ResponseWriter, r *http.Request) {
+	accountType := models.LedgerAccountType(r.URL.Query().Get("type"))
+
+	balances, err := s.ledger.Balances(accountType)
+	if err != nil {
+		log.Printf("ledger_balances: failed to retrieve balances: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving ledger balances")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   balances,
+	})
+}
+
+// GetLedgerAccount returns the balance of a single account
+func (s *Service) GetLedgerAccount(w http.ResponseWriter, r *http.Request) {
+	account := models.ParseLedgerAccount(mux.Vars(r)["account"])
+
+	balance, err := s.ledger.Balance(account)
+	if err != nil {
+		log.Printf("ledger_account: failed to retrieve balance: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving ledger account")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   balance,
+	})
+}
+
+// GetLedgerAccountEntries returns the entry history of a single account
+func (s *Service) GetLedgerAccountEntries(w http.ResponseWriter, r *http.Request) {
+	account := models.ParseLedgerAccount(mux.Vars(r)["account"])
+
+	entries, err := s.ledger.History(account)
+	if err != nil {
+		log.Printf("ledger_history: failed to retrieve entries: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving ledger entries")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   entries,
+	})
+}
+
+// GetOrderLedgerEntries returns every ledger entry recorded for an order
+func (s *Service) GetOrderLedgerEntries(w http.ResponseWriter, r *http.Request) {
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	entries, err := s.ledger.OrderEntries(orderID)
+	if err != nil {
+		log.Printf("ledger_order: failed to retrieve entries: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving ledger entries")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   entries,
+	})
+}
@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"vhennpay-bend/utils/notifications"
+	"vhennpay-bend/utils/scheduler"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const reconciliationInterval = time.Minute * 30
+
+// Reconcile runs an escrow reconciliation and returns its report
+func (s *Service) Reconcile(w http.ResponseWriter, r *http.Request) {
+	report, err := s.reconcile()
+	if err != nil {
+		log.Printf("reconcile: failed to reconcile escrow: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error reconciling escrow: "+err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   report,
+	})
+}
+
+// GetReconciliations returns past reconciliation reports
+func (s *Service) GetReconciliations(w http.ResponseWriter, r *http.Request) {
+	query := make(bson.M)
+	if r.URL.Query().Get("drifted") == "true" {
+		query["drifted"] = true
+	}
+
+	var reports []models.ReconciliationReport
+	err := s.factoryDAO.QueryInto("reconciliations", query, &reports)
+	if err != nil {
+		log.Printf("get_reconciliations: failed to retrieve reports: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving reconciliations")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   reports,
+	})
+}
+
+// GetAlerts returns raised alerts
+func (s *Service) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts, err := s.factoryDAO.Query("alerts", bson.M{}, true)
+	if err != nil {
+		log.Printf("get_alerts: failed to retrieve alerts: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving alerts")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   alerts,
+	})
+}
+
+// RegisterJobs adds the admin background jobs to sched
+func (s *Service) RegisterJobs(sched *scheduler.Scheduler) {
+	sched.Register("escrow_reconciliation", reconciliationInterval, func(now time.Time) error {
+		_, err := s.reconcile()
+		return err
+	})
+}
+
+// reconcile runs and stores a reconciliation, alerting admins on drift
+func (s *Service) reconcile() (models.ReconciliationReport, error) {
+	report, err := s.escrow.Reconcile()
+	if err != nil {
+		return report, err
+	}
+
+	if err := s.factoryDAO.Insert("reconciliations", report); err != nil {
+		return report, err
+	}
+
+	if report.Drifted {
+		message := fmt.Sprintf(
+			"Escrow drift detected: chain %s, ledger %s, pending in %s, pending out %s (drift %s), seller holds %s, unreleased deposits %s, %d orphaned deposits",
+			report.ChainBalance,
+			report.LedgerBalance,
+			report.PendingIn,
+			report.PendingOut,
+			report.Drift,
+			report.SellerHolds,
+			report.UnreleasedDeposits,
+			len(report.OrphanedDeposits),
+		)
+		s.raiseAlert("escrow_drift", message, report.ID)
+	}
+
+	return report, nil
+}
+
+// raiseAlert records an alert and notifies every admin
+func (s *Service) raiseAlert(kind, message string, refID primitive.ObjectID) {
+	log.Printf("alert %s: %s", kind, message)
+
+	alert := models.Alert{
+		ID:        primitive.NewObjectID(),
+		Kind:      kind,
+		Message:   message,
+		RefID:     refID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.factoryDAO.Insert("alerts", alert); err != nil {
+		log.Printf("failed to record alert: %v", err)
+	}
+
+	admins, err := s.userDAO.FindAdmins()
+	if err != nil {
+		log.Printf("failed to retrieve admins: %v", err)
+		return
+	}
+
+	data := notifications.GenericEmailData{Content: message}
+	for _, admin := range admins {
+		go s.notifiable.SendGenericNotification(admin.ID.Hex(), "[Alert] "+kind, data)
+	}
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"vhennpay-bend/dao"
+	"vhennpay-bend/utils/escrow"
+	"vhennpay-bend/utils/fees"
+	"vhennpay-bend/utils/ledger"
+	"vhennpay-bend/utils/notifications"
+	"vhennpay-bend/utils/scheduler"
+	"log"
+)
+
+// Service represents the Admin Service, routes are restricted to admin users
+type Service struct {
+	ledger     *ledger.Ledger
+	escrow     *escrow.Escrow
+	fees       *fees.Engine
+	scheduler  *scheduler.Scheduler
+	userDAO    *dao.UserDAO
+	factoryDAO *dao.FactoryDAO
+	notifiable notifications.Notifiable
+}
+
+// NewAdminService returns a new admin service
+func NewAdminService(
+	ledger *ledger.Ledger,
+	escrow *escrow.Escrow,
+	fees *fees.Engine,
+	scheduler *scheduler.Scheduler,
+	userDAO *dao.UserDAO,
+	factoryDAO *dao.FactoryDAO,
+) *Service {
+	notifiable, err := notifications.NewNotifiable(factoryDAO)
+	if err != nil {
+		log.Fatalf("notifiable_init: %v", err)
+		return nil
+	}
+	return &Service{
+		ledger:     ledger,
+		escrow:     escrow,
+		fees:       fees,
+		scheduler:  scheduler,
+		userDAO:    userDAO,
+		factoryDAO: factoryDAO,
+		notifiable: notifiable,
+	}
+}
@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetTransfers returns escrow outbox transfers with optional status, tx id,
+// order and user filters
+func (s *Service) GetTransfers(w http.ResponseWriter, r *http.Request) {
+	query := make(bson.M)
+	v := r.URL.Query()
+	if status := v.Get("status"); status != "" {
+		query["status"] = status
+	}
+	if txID := v.Get("tx_id"); txID != "" {
+		query["tx_id"] = txID
+	}
+	for _, field := range []string{"order_id", "user_id"} {
+		if id, err := primitive.ObjectIDFromHex(v.Get(field)); err == nil {
+			query[field] = id
+		}
+	}
+
+	transfers, err := s.escrow.Transfers(query)
+	if err != nil {
+		log.Printf("get_transfers: failed to retrieve transfers: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving transfers")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   transfers,
+	})
+}
+
+// ResolveTransfer records the checked outcome of a transfer parked as unknown
+func (s *Service) ResolveTransfer(w http.ResponseWriter, r *http.Request) {
+	var req models.ResolveTransferReq
+	err := utils.DecodeReq(r, &req)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	transferID := mux.Vars(r)["id"]
+	if err := s.escrow.ResolveTransfer(transferID, req.Status, req.TxID); err != nil {
+		log.Printf("resolve_transfer: failed to resolve %s: %v", transferID, err)
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.RespondWithOk(w, "Transfer has been resolved")
+}
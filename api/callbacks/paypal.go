@@ -4,13 +4,12 @@ import (
 	"context"
 	"vhennpay-bend/models"
 	"vhennpay-bend/utils"
+	"vhennpay-bend/utils/lid"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/plutov/paypal/v4"
@@ -20,8 +19,8 @@ import (
 
 // ConfirmPaypalPayment confirms a PayPal orderID and validates the given order
 // has a matching amount.
-// On confirmation, the value in Quicoins will be transferred to the wallet set
-// in the payload
+// On confirmation, the value in Quicoins less the ICO fee will be transferred
+// to the wallet set in the payload and the fee swept to the FEE_WALLET
 func (s *Service) ConfirmPaypalPayment(w http.ResponseWriter, r *http.Request) {
 	var (
 		base         = paypal.APIBaseSandBox
@@ -91,13 +90,39 @@ func (s *Service) ConfirmPaypalPayment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// save payment data
-	a, _ := strconv.ParseFloat(amount.(string), 64)
+	a, err := models.ParseMoney(amount.(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid order amount detected")
+		return
+	}
+
+	schedule, err := s.fees.Schedule(models.FeeQuery{
+		Scope:         models.FeeScopeICO,
+		Currency:      order.PurchaseUnits[0].Amount.Currency,
+		PaymentOption: models.PayPal,
+		Tier:          s.walletTier(walletAddress.(string)),
+	})
+	if err != nil {
+		log.Printf("err looking up ico fee: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error processing request")
+		return
+	}
+
+	coins, fee, err := s.quote(a, schedule)
+	if err != nil {
+		log.Printf("err pricing ico_trade: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error validating order")
+		return
+	}
+
 	payloadByts, _ := json.Marshal(payload)
 	orderData := models.PayPalPayment{
 		ID:                 primitive.NewObjectID(),
 		OrderID:            orderID.(string),
 		WalletAddress:      walletAddress.(string),
 		Amount:             a,
+		Coins:              coins,
+		Fee:                fee,
 		TransactionPayload: string(payloadByts),
 		CreatedAt:          time.Now().UTC(),
 	}
@@ -108,13 +133,19 @@ func (s *Service) ConfirmPaypalPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.fundWallet(walletAddress.(string), a)
+	err = s.fundWallet(walletAddress.(string), coins.Sub(fee))
 	if err != nil {
 		log.Printf("err releasing funds to ico_trade wallet: %v", err)
 		utils.RespondWithError(w, http.StatusBadRequest, "Error validating order")
 		return
 	}
 
+	if fee.IsPositive() {
+		if err := s.escrow.SweepICOFee(orderData.ID.Hex(), fee); err != nil {
+			log.Printf("err sweeping fee on ico_trade %s: %v", orderData.ID.Hex(), err)
+		}
+	}
+
 	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
 		Status:  "success",
 		Code:    http.StatusCreated,
@@ -122,48 +153,56 @@ func (s *Service) ConfirmPaypalPayment(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Service) fundWallet(wallet string, amount float64) error {
-	var priceData map[string]interface{}
-	resp, err := http.Get(os.Getenv("LID_SERVER_ADDR") + "/api/v1/price")
+// quote returns the Quicoins amount buys and the fee charged on them
+func (s *Service) quote(amount models.Money, schedule models.FeeSchedule) (models.Money, models.Money, error) {
+	price, err := s.chain.GetPrice()
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&priceData)
+	// retrieve rate of Quicoins based on confirmed amount
+	if !price.CurrentPrice.IsPositive() {
+		return 0, 0, errors.New("Invalid price data from the QUI chain")
+	}
+	coins, err := amount.Div(price.CurrentPrice)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
+	coins = coins.Round(models.QC)
 
-	// retrieve rate of Quicoins based on confirmed amount
-	currentPrice := priceData["data"].(map[string]interface{})["current_price"]
-	amountToSend := amount / currentPrice.(float64)
-
-	// generate transfer payload
-	transferEndpoint := os.Getenv("LID_SERVER_ADDR") + "/api/v1/wallet/transfer"
-	icoTradeWallet := os.Getenv("ICO_WALLET")
-	icoTradeWalletSecret := os.Getenv("ICO_WALLET_SECRET")
-	payload := map[string]string{
-		"sender_address":     icoTradeWallet,
-		"reciever_address":   wallet,
-		"amount":             strconv.FormatFloat(amountToSend, 'f', -1, 64),
-		"sender_private_key": icoTradeWalletSecret,
+	fee, err := schedule.Apply(coins)
+	if err != nil {
+		return 0, 0, err
 	}
+	return coins, fee, nil
+}
 
-	resp, err = utils.PostToChain(transferEndpoint, payload)
-	if err != nil {
-		return err
+// walletTier returns the tier of the user owning wallet, purchases to
+// wallets no user has added are charged at the standard tier
+func (s *Service) walletTier(wallet string) string {
+	var wallets []models.UserWallet
+	err := s.factoryDAO.QueryInto("user_wallet", bson.M{"address": wallet}, &wallets)
+	if err != nil || len(wallets) == 0 {
+		return models.TierStandard
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		var d map[string]interface{}
-		err = json.NewDecoder(resp.Body).Decode(&d)
-		if err != nil {
-			log.Printf("failed to post ico_trade_tx to chain: %v", err)
-			return errors.New("Failed to read transaction data from the QUI chain")
-		}
+	user, err := s.factoryDAO.FactoryFindUser("user", wallets[0].UserID)
+	if err != nil || user.Tier == "" {
+		return models.TierStandard
+	}
+	return user.Tier
+}
 
-		return fmt.Errorf("Error posting ico_trade_tx to chain, resp: %v", d)
+func (s *Service) fundWallet(wallet string, amount models.Money) error {
+	_, err := s.chain.Transfer(lid.TransferReq{
+		Sender:           os.Getenv("ICO_WALLET"),
+		Receiver:         wallet,
+		Amount:           amount,
+		SenderPrivateKey: os.Getenv("ICO_WALLET_SECRET"),
+	})
+	if err != nil {
+		log.Printf("failed to post ico_trade_tx to chain: %v", err)
+		return err
 	}
 
 	return nil
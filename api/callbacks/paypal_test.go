@@ -0,0 +1,49 @@
+package callbacks
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/lid"
+	"os"
+	"testing"
+)
+
+func TestFundWallet(t *testing.T) {
+	os.Setenv("ICO_WALLET", "ico")
+	chain := lid.NewFakeClient(models.MoneyFromFloat(2))
+	chain.Balances["ico"] = models.MoneyFromFloat(100)
+
+	s := NewCallbacksService(nil, nil, nil, chain)
+	schedule := models.FeeSchedule{Percent: models.MoneyFromFloat(2), Flat: models.MoneyFromFloat(0.5)}
+	coins, fee, err := s.quote(models.MoneyFromFloat(50), schedule)
+	if err != nil {
+		t.Fatalf("quote: %v", err)
+	}
+	if coins != models.MoneyFromFloat(25) || fee != models.MoneyFromFloat(1) {
+		t.Fatalf("quote = %s, %s, want 25, 1", coins, fee)
+	}
+
+	if err := s.fundWallet("buyer", coins.Sub(fee)); err != nil {
+		t.Fatalf("fundWallet: %v", err)
+	}
+
+	if got := chain.Balances["buyer"]; got != models.MoneyFromFloat(24) {
+		t.Errorf("buyer balance = %s, want 24", got)
+	}
+	if got := chain.Balances["ico"]; got != models.MoneyFromFloat(76) {
+		t.Errorf("ico balance = %s, want 76", got)
+	}
+}
+
+func TestFundWalletChainError(t *testing.T) {
+	chain := lid.NewFakeClient(models.MoneyFromFloat(2))
+	chain.Err = &lid.Error{Kind: lid.ErrUnavailable, StatusCode: 503, Message: "unavailable"}
+
+	s := NewCallbacksService(nil, nil, nil, chain)
+	err := s.fundWallet("buyer", models.MoneyFromFloat(25))
+	if lid.KindOf(err) != lid.ErrUnavailable {
+		t.Fatalf("fundWallet err = %s, want ErrUnavailable", err)
+	}
+	if len(chain.Transactions) != 0 {
+		t.Errorf("expected no transfer, got %d", len(chain.Transactions))
+	}
+}
@@ -1,13 +1,21 @@
 package callbacks
 
-import "vhennpay-bend/dao"
+import (
+	"vhennpay-bend/dao"
+	"vhennpay-bend/utils/escrow"
+	"vhennpay-bend/utils/fees"
+	"vhennpay-bend/utils/lid"
+)
 
 // Service represents the Callbacks Service
 type Service struct {
 	factoryDAO *dao.FactoryDAO
+	fees       *fees.Engine
+	escrow     *escrow.Escrow
+	chain      lid.ChainClient
 }
 
 // NewCallbacksService returns a new callbacks service
-func NewCallbacksService(factoryDAO *dao.FactoryDAO) *Service {
-	return &Service{factoryDAO: factoryDAO}
+func NewCallbacksService(factoryDAO *dao.FactoryDAO, fees *fees.Engine, escrow *escrow.Escrow, chain lid.ChainClient) *Service {
+	return &Service{factoryDAO: factoryDAO, fees: fees, escrow: escrow, chain: chain}
 }
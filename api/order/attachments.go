@@ -0,0 +1,196 @@
+package order
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"vhennpay-bend/utils/attachments"
+	"vhennpay-bend/utils/blob"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxUploadMemory is how much of a multipart message is held in memory,
+	// the rest is buffered to temporary files
+	maxUploadMemory = 1 << 20
+	// maxAttachmentName is the longest attachment file name kept
+	maxAttachmentName = 255
+)
+
+// errInvalidMessage is returned for chat messages that can't be decoded
+var errInvalidMessage = errors.New("invalid chat message")
+
+// chatMessage is a trade chat message as sent, file is set when a file was
+// attached to it
+type chatMessage struct {
+	message string
+	name    string
+	file    *attachments.File
+}
+
+// decodeMessage reads a chat message sent as JSON, or as a multipart form
+// with the text in its "message" field and the attachment in its "file"
+// field
+func decodeMessage(w http.ResponseWriter, r *http.Request) (chatMessage, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		var req models.NewMessageReq
+		if err := utils.DecodeReq(r, &req); err != nil {
+			return chatMessage{}, errInvalidMessage
+		}
+		return chatMessage{message: strings.TrimSpace(req.Message)}, nil
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, attachments.MaxSize+maxUploadMemory)
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			return chatMessage{}, attachments.ErrTooLarge
+		}
+		return chatMessage{}, errInvalidMessage
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	msg := chatMessage{message: strings.TrimSpace(r.FormValue("message"))}
+	f, header, err := r.FormFile("file")
+	if err == http.ErrMissingFile {
+		return msg, nil
+	}
+	if err != nil {
+		return chatMessage{}, errInvalidMessage
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, attachments.MaxSize+1))
+	if err != nil {
+		return chatMessage{}, errInvalidMessage
+	}
+	file, err := attachments.Process(data)
+	if err != nil {
+		return chatMessage{}, err
+	}
+
+	msg.file = &file
+	msg.name = attachmentName(header.Filename)
+	return msg, nil
+}
+
+// attachmentName returns the base of an uploaded file's name, cut to
+// maxAttachmentName
+func attachmentName(name string) string {
+	name = filepath.Base(strings.Replace(name, "\\", "/", -1))
+	if name == "." || name == "/" {
+		name = "attachment"
+	}
+	if len(name) > maxAttachmentName {
+		name = name[:maxAttachmentName]
+	}
+	return name
+}
+
+// storeAttachment saves a message's attached file and its thumbnail in the
+// blob store
+func (s *Service) storeAttachment(trade models.BuyTrade, name string, file attachments.File) (*models.TradeAttachment, error) {
+	id := primitive.NewObjectID()
+	url := fmt.Sprintf("/api/v1/trades/%s/attachments/%s", trade.ID.Hex(), id.Hex())
+	att := &models.TradeAttachment{
+		ID:          id,
+		Name:        name,
+		ContentType: file.ContentType,
+		Size:        int64(len(file.Data)),
+		Key:         fmt.Sprintf("trades/%s/%s", trade.ID.Hex(), id.Hex()),
+		URL:         url,
+	}
+	if err := s.blobs.Put(att.Key, file.ContentType, bytes.NewReader(file.Data)); err != nil {
+		return nil, err
+	}
+
+	if file.Thumbnail != nil {
+		att.ThumbnailKey = att.Key + "_thumb"
+		att.ThumbnailURL = url + "?thumbnail=true"
+		if err := s.blobs.Put(att.ThumbnailKey, file.ContentType, bytes.NewReader(file.Thumbnail)); err != nil {
+			s.dropAttachment(att)
+			return nil, err
+		}
+	}
+	return att, nil
+}
+
+// dropAttachment removes a stored attachment whose message wasn't saved
+func (s *Service) dropAttachment(att *models.TradeAttachment) {
+	for _, key := range []string{att.Key, att.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.blobs.Delete(key); err != nil {
+			log.Printf("trade_attachments: failed to delete %s: %v", key, err)
+		}
+	}
+}
+
+// GetTradeAttachment downloads a file attached to a trade's chat, or its
+// thumbnail with ?thumbnail=true, for the trade's parties only
+func (s *Service) GetTradeAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	vars := mux.Vars(r)
+	trade, err := s.dao.FindTradeByID(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+	if tradeActor(trade, userID.(string)) == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
+		return
+	}
+
+	aid, _ := primitive.ObjectIDFromHex(vars["attachmentId"])
+	att, err := s.dao.FindTradeAttachment(trade.ID, aid)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	key := att.Key
+	if r.URL.Query().Get("thumbnail") == "true" {
+		if att.ThumbnailKey == "" {
+			utils.RespondWithError(w, http.StatusNotFound, "Attachment has no thumbnail")
+			return
+		}
+		key = att.ThumbnailKey
+	}
+
+	f, err := s.blobs.Get(key)
+	if err == blob.ErrNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+	if err != nil {
+		log.Printf("trade_attachments: failed to open %s: %v", key, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred")
+		return
+	}
+	defer f.Close()
+
+	disposition := "inline"
+	if att.ContentType == attachments.PDF {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": att.Name}))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("trade_attachments: failed to send %s: %v", key, err)
+	}
+}
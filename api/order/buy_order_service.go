@@ -0,0 +1,555 @@
+package order
+
+import (
+	"vhennpay-bend/dao"
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"vhennpay-bend/utils/notifications"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateBuyOrder creates a new buy order, it is listed to sellers right away
+// as sellers fund their own fills
+func (s *Service) CreateBuyOrder(w http.ResponseWriter, r *http.Request) {
+	var req models.BuyOrderReq
+	if err := utils.DecodeReq(r, &req); err != nil {
+		log.Printf("error decoding create_buy_order req: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	if !req.Amount.IsPositive() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount must be greater than zero")
+		return
+	}
+
+	if req.WalletID == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Wallet is missing from input")
+		return
+	}
+
+	if req.Currency == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Currency is missing from input")
+		return
+	}
+
+	if !req.ExRate.IsPositive() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Exchange rate must be greater than zero")
+		return
+	}
+
+	options := []int32{}
+	for _, option := range req.PaymentOptions {
+		switch models.PaymentOption(option) {
+		case models.Bank, models.PayPal, models.Stripe:
+		default:
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Payment option %d is not supported", option))
+			return
+		}
+		if !(models.BuyOrder{PaymentOptions: options}).Accepts(option) {
+			options = append(options, option)
+		}
+	}
+	if len(options) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "At least one payment option must be accepted")
+		return
+	}
+
+	if req.PaymentWindow != 0 && !validPaymentWindow(time.Duration(req.PaymentWindow)*time.Minute) {
+		utils.RespondWithError(w, http.StatusBadRequest, paymentWindowError)
+		return
+	}
+
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	uid, _ := primitive.ObjectIDFromHex(userID.(string))
+	now := time.Now().UTC()
+	order := models.BuyOrder{
+		ID:             primitive.NewObjectID(),
+		CreatedBy:      uid,
+		ExRate:         req.ExRate,
+		Amount:         req.Amount,
+		AmountLeft:     req.Amount,
+		Currency:       req.Currency,
+		WalletID:       req.WalletID,
+		PaymentOptions: options,
+		Note:           req.Note,
+		PaymentWindow:  req.PaymentWindow,
+		Status:         models.OrderPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.dao.InsertBuyOrder(order); err != nil {
+		log.Printf("failed to create new buy order: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred while processing request")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
+		Status:  "success",
+		Code:    http.StatusCreated,
+		Data:    order,
+		Message: "Buy order has been listed",
+	})
+}
+
+// FillBuyOrder fills part or all of a buy order for the requesting seller,
+// the fill is a sell order for the buyer that is traded once the seller's
+// signed escrow deposit settles, like a listed sell order
+func (s *Service) FillBuyOrder(w http.ResponseWriter, r *http.Request) {
+	var req models.FillBuyOrderReq
+	if err := utils.DecodeReq(r, &req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	buyOrder, err := s.dao.FindBuyOrderByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Buy order not found")
+		return
+	}
+
+	if buyOrder.CreatedBy.Hex() == userID.(string) {
+		utils.RespondWithError(w, http.StatusNotFound, "Operation not allowed on order")
+		return
+	}
+
+	if buyOrder.Status != models.OrderPending {
+		utils.RespondWithError(w, http.StatusNotFound, "Buy order not available at this time, order "+buyOrder.Status)
+		return
+	}
+
+	if !req.Amount.IsPositive() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount must be greater than zero")
+		return
+	}
+
+	if req.WalletID == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Wallet is missing from input")
+		return
+	}
+
+	if !buyOrder.Accepts(req.PaymentOption) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Payment option is not accepted by the buyer")
+		return
+	}
+
+	uid, _ := primitive.ObjectIDFromHex(userID.(string))
+	fee, err := s.orderFee(uid, buyOrder.Currency, req.PaymentOption)
+	if err != nil {
+		log.Printf("fill_buy_order: failed to look up fee: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred while processing request")
+		return
+	}
+	charged, err := fee.Apply(req.Amount)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount is too large")
+		return
+	}
+	if !req.Amount.Sub(charged).IsPositive() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount does not cover the trade fee of "+charged.String())
+		return
+	}
+	if _, err := req.Amount.Mul(buyOrder.ExRate); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount is too large")
+		return
+	}
+
+	window := buyOrder.PaymentWindow
+	if window == 0 {
+		window = int64(models.DefaultPaymentWindow(models.PaymentOption(req.PaymentOption)) / time.Minute)
+	}
+
+	// reserve the amount before the fill exists so concurrent sellers can't
+	// fill more than the buyer wants
+	ok, err := s.dao.ReserveBuyOrder(buyOrder.ID, req.Amount)
+	if err != nil {
+		log.Printf("fill_buy_order: failed to reserve amount: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred while processing request")
+		return
+	}
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Buy order has less left to fill")
+		return
+	}
+
+	now := time.Now().UTC()
+	paymentOptionID, _ := primitive.ObjectIDFromHex(req.PaymentOptionID)
+	order := models.SellOrder{
+		ID:              primitive.NewObjectID(),
+		CreatedBy:       uid,
+		ExRate:          buyOrder.ExRate,
+		Amount:          req.Amount,
+		AmountLeft:      req.Amount,
+		Currency:        buyOrder.Currency,
+		PhoneNumber:     req.PhoneNumber,
+		WalletID:        req.WalletID,
+		PaymentOption:   req.PaymentOption,
+		PaymentOptionID: paymentOptionID,
+		Fee:             fee,
+		PaymentWindow:   window,
+		BuyOrderID:      buyOrder.ID,
+		Status:          models.OrderFunding,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := s.dao.Insert(order); err != nil {
+		log.Printf("failed to create buy order fill: %v", err)
+		if err := s.dao.SettleBuyOrder(buyOrder.ID, req.Amount, 0); err != nil {
+			log.Printf("fill_buy_order: failed to release reserved amount: %v", err)
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred while processing request")
+		return
+	}
+
+	deposit, err := s.escrow.PrepareDeposit(order.ID, order.CreatedBy, order.Amount, req.WalletID)
+	if err != nil {
+		log.Printf("failed to init escrow deposit: %v", err)
+		s.failFunding(order.ID)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred while processing request")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
+		Status: "success",
+		Code:   http.StatusCreated,
+		Data: models.SellOrderRes{
+			Order: order,
+			Deposit: models.DepositPayload{
+				Message:   deposit.Message,
+				ExpiresAt: deposit.ExpiresAt,
+			},
+		},
+		Message: "Sign the deposit with your wallet to fund the fill",
+	})
+}
+
+// openFillTrade opens the trade selling a funded fill to its buy order's
+// buyer, the fill takes no other trades so it is closed right away and
+// settles once the trade finishes
+func (s *Service) openFillTrade(order models.SellOrder) {
+	buyOrder, err := s.dao.FindBuyOrderByID(order.BuyOrderID.Hex())
+	if err != nil {
+		log.Printf("fill_trade: failed to retrieve buy order %s: %v", order.BuyOrderID.Hex(), err)
+		s.closeFill(order.ID)
+		return
+	}
+
+	amount, fiat, err := order.Quote(order.Amount, 0)
+	if err != nil {
+		log.Printf("fill_trade: failed to quote fill %s: %v", order.ID.Hex(), err)
+		s.closeFill(order.ID)
+		return
+	}
+	fee, err := order.Fee.Apply(amount)
+	if err != nil {
+		log.Printf("fill_trade: failed to work out fee on fill %s: %v", order.ID.Hex(), err)
+		s.closeFill(order.ID)
+		return
+	}
+
+	ok, err := s.dao.Reserve(order.ID, order.Amount)
+	if err != nil || !ok {
+		log.Printf("fill_trade: failed to reserve fill %s: %v", order.ID.Hex(), err)
+		s.closeFill(order.ID)
+		return
+	}
+
+	trade := newBuyTrade(order, buyOrder.CreatedBy, buyOrder.WalletID, amount, fiat, fee)
+	opened := s.dao.InsertTrade(trade) == nil
+	if opened {
+		s.recordTradeEvent(trade, models.TradeActionOpen, "", models.TradeActorSystem, "", "buy order filled")
+	} else {
+		log.Printf("fill_trade: failed to create trade for fill %s", order.ID.Hex())
+		s.releaseTrade(trade)
+	}
+
+	s.closeFill(order.ID)
+	if !opened {
+		return
+	}
+
+	deadline := trade.PayBy.Format(time.RFC1123)
+	go s.notifiable.SendGenericNotification(trade.BuyerID.Hex(), "[Action Needed] Buy order filled",
+		notifications.GenericEmailData{Content: fmt.Sprintf(
+			"A seller filled %s of your buy order, pay them by %s and mark the trade paid", trade.AmountText(), deadline)})
+	go s.notifiable.SendGenericNotification(trade.SellerID.Hex(), "Buy order fill funded",
+		notifications.GenericEmailData{Content: fmt.Sprintf(
+			"Your fill of %s is funded, the buyer has until %s to pay you", trade.AmountText(), deadline)})
+}
+
+// closeFill closes a funded fill to new trades, it settles once its trade
+// finishes and a fill left without a trade is cancelled right away, its
+// deposit reversed and its reservation taken off the buy order
+func (s *Service) closeFill(orderID primitive.ObjectID) {
+	if _, err := s.dao.UpdateStatus(orderID, models.OrderPending, models.OrderClosing); err != nil {
+		log.Printf("fill_trade: failed to close fill %s: %v", orderID.Hex(), err)
+	}
+	go s.settleClosingOrder(orderID)
+}
+
+// settleFill takes a fill that has closed off its buy order, whatever it
+// sold counts as filled and the rest is available to other sellers again
+func (s *Service) settleFill(order models.SellOrder) {
+	err := s.dao.SettleBuyOrder(order.BuyOrderID, order.Amount, order.AmountSold)
+	if err != nil {
+		log.Printf("settle_fill: failed to update buy order %s: %v", order.BuyOrderID.Hex(), err)
+		return
+	}
+
+	buyOrder, err := s.dao.FindBuyOrderByID(order.BuyOrderID.Hex())
+	if err != nil {
+		log.Printf("settle_fill: failed to retrieve buy order %s: %v", order.BuyOrderID.Hex(), err)
+		return
+	}
+	s.closeBuyOrder(buyOrder)
+}
+
+// closeBuyOrder completes a buy order once it is filled, and cancels a
+// closing buy order once its last fill in progress has closed
+func (s *Service) closeBuyOrder(order models.BuyOrder) {
+	var err error
+	switch {
+	case order.Status != models.OrderPending && order.Status != models.OrderClosing:
+	case !order.AmountLeft.IsPositive():
+		_, err = s.dao.UpdateBuyOrderStatus(order.ID, order.Status, models.OrderCompleted)
+	case order.Status == models.OrderClosing && !order.AmountReserved.IsPositive():
+		_, err = s.dao.UpdateBuyOrderStatus(order.ID, models.OrderClosing, models.OrderCancelled)
+	}
+	if err != nil {
+		log.Printf("failed to update buy order %s: %v", order.ID.Hex(), err)
+	}
+}
+
+// ViewBuyOrder ...
+func (s *Service) ViewBuyOrder(w http.ResponseWriter, r *http.Request) {
+	order, err := s.dao.PipelineBuyOrder(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("view_buy_order: failed to retrieve order: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "Buy order not found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   order,
+	})
+}
+
+// GetPendingBuyOrders applies filters to retrieve buy orders sellers can
+// fill
+func (s *Service) GetPendingBuyOrders(w http.ResponseWriter, r *http.Request) {
+	query := make(bson.M)
+
+	v := r.URL.Query()
+	amount := v.Get("amount")
+	option := v.Get("payment_option")
+	query["status"] = models.OrderPending
+	query["amount_available"] = bson.M{"$gt": models.Money(0)}
+
+	page, err := dao.NewPage(v, "created_at", "ex_rate", "amount_available")
+	if err == nil {
+		err = dao.ListFilter(v, query, dao.FilterCurrency, dao.FilterRate, dao.FilterDate)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+
+	if a, err := models.ParseMoney(amount); err == nil && a.IsPositive() {
+		query["amount_available"] = bson.M{
+			"$gte": a,
+		}
+	}
+
+	if n, err := strconv.Atoi(option); err == nil {
+		query["payment_options"] = int32(n)
+	}
+
+	orders, info, err := s.dao.PipelineBuyOrders(query, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+	if err != nil {
+		log.Printf("pending_buy_orders: failed to retrieve orders: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "No orders found with query")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   orders,
+		Page:   &info,
+	})
+}
+
+// GetUserBuyOrders returns the buy orders of an authenticated user with an
+// optional status filter
+func (s *Service) GetUserBuyOrders(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	uid, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "No orders found with query")
+		return
+	}
+
+	v := r.URL.Query()
+	query := bson.M{"created_by": uid}
+	if status := v.Get("status"); status != "" {
+		query["status"] = status
+	}
+
+	page, err := dao.NewPage(v, "created_at", "ex_rate", "amount")
+	if err == nil {
+		err = dao.ListFilter(v, query, dao.FilterCurrency, dao.FilterRate, dao.FilterDate)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+
+	orders, info, err := s.dao.PageBuyOrders(query, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+	if err != nil {
+		log.Printf("user_buy_orders: failed to retrieve orders: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "No orders found with query")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   orders,
+		Page:   &info,
+	})
+}
+
+// ViewBuyOrderTrades returns the trades filling a buy order, its buyer sees
+// every fill and sellers only their own
+func (s *Service) ViewBuyOrderTrades(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	order, err := s.dao.FindBuyOrderByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Buy order not found")
+		return
+	}
+
+	query := bson.M{"buy_order_id": order.ID}
+	if order.CreatedBy.Hex() != userID.(string) {
+		query["seller_id"], _ = primitive.ObjectIDFromHex(userID.(string))
+	}
+
+	v := r.URL.Query()
+	if status := v.Get("status"); status != "" {
+		query["status"] = status
+	}
+
+	page, err := dao.NewPage(v, "created_at", "amount")
+	if err == nil {
+		err = dao.ListFilter(v, query, dao.FilterDate)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+
+	trades, info, err := s.dao.PageTrades(query, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+	if err != nil {
+		log.Printf("get_buy_order_trades: failed to retrieve trades: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "No trades found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   trades,
+		Page:   &info,
+	})
+}
+
+// CancelBuyOrder cancels a buy order, a buy order with fills in progress is
+// closed to new fills and cancelled once they finish
+func (s *Service) CancelBuyOrder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	order, err := s.dao.FindBuyOrderByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Buy order not found")
+		return
+	}
+
+	if order.CreatedBy.Hex() != userID.(string) {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Order not available to user")
+		return
+	}
+
+	if order.Status == models.OrderCancelled {
+		utils.RespondWithOk(w, "Buy order already cancelled")
+		return
+	}
+
+	if order.Status != models.OrderPending && order.Status != models.OrderClosing {
+		utils.RespondWithError(w, http.StatusBadRequest, "Buy order cannot be cancelled, order "+order.Status)
+		return
+	}
+
+	// close the order first so no new fill can reserve, then look at what
+	// fills still hold
+	if order.Status == models.OrderPending {
+		ok, err := s.dao.UpdateBuyOrderStatus(order.ID, models.OrderPending, models.OrderClosing)
+		if err != nil {
+			log.Printf("failed to update buy order %v: %v", order.ID.Hex(), err)
+			utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
+			return
+		}
+		if !ok {
+			utils.RespondWithError(w, http.StatusConflict, "Order was updated, please try again")
+			return
+		}
+	}
+
+	order, err = s.dao.FindBuyOrderByID(order.ID.Hex())
+	if err != nil {
+		log.Printf("cancel_buy_order: failed to retrieve order: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
+		return
+	}
+	if !order.AmountReserved.IsPositive() {
+		if _, err := s.dao.UpdateBuyOrderStatus(order.ID, models.OrderClosing, models.OrderCancelled); err != nil {
+			log.Printf("failed to update buy order %v: %v", order.ID.Hex(), err)
+			utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
+			return
+		}
+		order.Status = models.OrderCancelled
+	}
+
+	message := "Buy order has been cancelled"
+	if order.Status == models.OrderClosing {
+		message = "Buy order is closing, it will be cancelled once fills in progress finish"
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, utils.Response{
+		Status:  "success",
+		Code:    http.StatusAccepted,
+		Data:    order,
+		Message: message,
+	})
+}
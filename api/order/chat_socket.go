@@ -0,0 +1,134 @@
+package order
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"vhennpay-bend/utils/notifications"
+	"vhennpay-bend/utils/realtime"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// upgrader accepts sockets from any origin like the API's CORS policy, the
+// token authenticating a socket isn't sent by browsers on their own
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// TradeChatSocket streams a trade's chat to its buyer and seller over a
+// WebSocket, they send message and typing events and receive the other
+// party's messages and typing, and the trade's status changes
+func (s *Service) TradeChatSocket(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(models.ContextKey("user_id")).(string)
+	trade, err := s.dao.FindTradeByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+	if tradeActor(trade, userID) == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
+		return
+	}
+
+	// the upgrader responds to the client itself on failure
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("trade_chat_socket: failed to upgrade: %v", err)
+		return
+	}
+
+	conn := s.hub.Join(trade.ID.Hex(), userID, ws)
+	conn.Serve(func(data []byte) {
+		s.handleChatEvent(conn, trade, data)
+	})
+}
+
+// handleChatEvent handles a frame sent by a trade party over its chat socket
+func (s *Service) handleChatEvent(conn *realtime.Conn, trade models.BuyTrade, data []byte) {
+	var event models.ChatEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		conn.Send(models.ChatEvent{Type: models.ChatEventError, Error: "Invalid event"})
+		return
+	}
+
+	switch event.Type {
+	case models.ChatEventTyping:
+		s.hub.Broadcast(trade.ID.Hex(), models.ChatEvent{
+			Type:    models.ChatEventTyping,
+			TradeID: trade.ID.Hex(),
+			UserID:  conn.UserID,
+		}, conn)
+
+	case models.ChatEventMessage:
+		text := strings.TrimSpace(event.Text)
+		if text == "" {
+			conn.Send(models.ChatEvent{Type: models.ChatEventError, Error: "Message is empty"})
+			return
+		}
+		if err := s.postMessage(trade, newTradeChat(trade, conn.UserID, text)); err != nil {
+			log.Printf("trade_chat_socket: failed to save message: %v", err)
+			conn.Send(models.ChatEvent{Type: models.ChatEventError, Error: "Message could not be sent"})
+		}
+
+	default:
+		conn.Send(models.ChatEvent{Type: models.ChatEventError, Error: "Unknown event type " + event.Type})
+	}
+}
+
+// newTradeChat returns a new message from userID on trade
+func newTradeChat(trade models.BuyTrade, userID, text string) models.TradeChat {
+	uid, _ := primitive.ObjectIDFromHex(userID)
+	now := time.Now().UTC()
+	return models.TradeChat{
+		ID:        primitive.NewObjectID(),
+		TradeID:   trade.ID,
+		UserID:    uid,
+		Message:   text,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// postMessage saves a message on trade's chat and sends it to the trade's
+// chat sockets, the recipient is emailed and pushed the message only when
+// they aren't connected
+func (s *Service) postMessage(trade models.BuyTrade, msg models.TradeChat) error {
+	if err := s.factoryDAO.Insert("trade_chat", msg); err != nil {
+		return err
+	}
+
+	room := trade.ID.Hex()
+	s.hub.Broadcast(room, models.ChatEvent{
+		Type:    models.ChatEventMessage,
+		TradeID: room,
+		UserID:  msg.UserID.Hex(),
+		Message: &msg,
+	}, nil)
+
+	subject, to := "Trade message from buyer", trade.SellerID.Hex()
+	if msg.UserID == trade.SellerID {
+		subject, to = "New message from seller", trade.BuyerID.Hex()
+	}
+	if s.hub.Online(room, to) {
+		return nil
+	}
+
+	content := msg.Message
+	if msg.Attachment != nil {
+		content = strings.TrimSpace(content + "\n[Attachment: " + msg.Attachment.Name + "]")
+	}
+	go s.notifiable.SendGenericNotification(to, subject, notifications.GenericEmailData{
+		Formatted: false,
+		Content:   content,
+	})
+	return nil
+}
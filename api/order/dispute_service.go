@@ -0,0 +1,375 @@
+package order
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"vhennpay-bend/utils/notifications"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OpenDispute disputes a paid trade for its buyer or seller, the trade's
+// escrow is frozen until an admin rules on the dispute
+func (s *Service) OpenDispute(w http.ResponseWriter, r *http.Request) {
+	var req models.OpenDisputeReq
+	if err := utils.DecodeReq(r, &req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+	if req.Reason == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Reason is missing from input")
+		return
+	}
+
+	userID := r.Context().Value(models.ContextKey("user_id")).(string)
+	trade, err := s.dao.FindTradeByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+
+	actor := tradeActor(trade, userID)
+	if actor == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
+		return
+	}
+
+	dispute, err := s.openDispute(&trade, actor, userID, req.Reason, req.Message)
+	if err == models.ErrTradeTransition {
+		utils.RespondWithError(w, http.StatusBadRequest, "Trade cannot be disputed, trade "+trade.Status)
+		return
+	}
+	if err == errTradeChanged {
+		utils.RespondWithError(w, http.StatusConflict, "Trade was updated, please try again")
+		return
+	}
+	if err != nil {
+		log.Printf("open_dispute: failed to dispute trade %s: %v", trade.ID.Hex(), err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
+		Status:  "success",
+		Code:    http.StatusCreated,
+		Data:    dispute,
+		Message: "Dispute has been opened, escrow is frozen until it is settled",
+	})
+}
+
+// openDispute disputes trade for actor, freezing its escrow, message is
+// recorded as the first evidence when given
+func (s *Service) openDispute(trade *models.BuyTrade, actor models.TradeActor, actorID, reason, message string) (models.Dispute, error) {
+	if _, err := models.NextTradeStatus(trade.Status, models.TradeActionDispute, actor); err != nil {
+		return models.Dispute{}, err
+	}
+
+	now := time.Now().UTC()
+	uid, _ := primitive.ObjectIDFromHex(actorID)
+	dispute := models.Dispute{
+		ID:           primitive.NewObjectID(),
+		TradeID:      trade.ID,
+		OrderID:      trade.OrderID,
+		OpenedBy:     uid,
+		OpenedByRole: actor,
+		Reason:       reason,
+		Status:       models.DisputeOpen,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.dao.InsertDispute(dispute); err != nil {
+		return dispute, err
+	}
+
+	// freeze escrow before the trade shows as disputed so nothing is
+	// released in between
+	if err := s.escrow.Freeze(*trade); err != nil {
+		s.dropDispute(dispute, *trade, false)
+		return dispute, err
+	}
+
+	ok, err := s.transition(trade, models.TradeActionDispute, actor, actorID, reason)
+	if err != nil || !ok {
+		s.dropDispute(dispute, *trade, true)
+		if err == nil {
+			err = errTradeChanged
+		}
+		return dispute, err
+	}
+
+	if message != "" {
+		s.addEvidence(dispute, uid, actor, message)
+	}
+
+	// notify the parties and the arbitrators
+	content := fmt.Sprintf("A dispute was opened on the trade for %s: %s", trade.AmountText(), reason)
+	data := notifications.GenericEmailData{Content: content}
+	if actor != models.TradeActorBuyer {
+		go s.notifiable.SendGenericNotification(trade.BuyerID.Hex(), "[Action Needed] Trade disputed", data)
+	}
+	if actor != models.TradeActorSeller {
+		go s.notifiable.SendGenericNotification(trade.SellerID.Hex(), "[Action Needed] Trade disputed", data)
+	}
+	go s.notifyAdmins("[Dispute] Trade "+trade.ID.Hex()+" disputed", content)
+
+	return dispute, nil
+}
+
+// dropDispute removes a dispute whose trade couldn't be disputed
+func (s *Service) dropDispute(dispute models.Dispute, trade models.BuyTrade, unfreeze bool) {
+	if unfreeze {
+		if err := s.escrow.Unfreeze(trade); err != nil {
+			log.Printf("open_dispute: failed to unfreeze escrow for trade %s: %v", trade.ID.Hex(), err)
+		}
+	}
+	if err := s.dao.RemoveDispute(dispute.ID); err != nil {
+		log.Printf("open_dispute: failed to remove dispute %s: %v", dispute.ID.Hex(), err)
+	}
+}
+
+// AddDisputeEvidence adds an evidence message to a trade's open dispute
+func (s *Service) AddDisputeEvidence(w http.ResponseWriter, r *http.Request) {
+	var req models.DisputeEvidenceReq
+	if err := utils.DecodeReq(r, &req); err != nil || req.Message == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	userID := r.Context().Value(models.ContextKey("user_id")).(string)
+	trade, err := s.dao.FindTradeByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+
+	actor := tradeActor(trade, userID)
+	if actor == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
+		return
+	}
+
+	dispute, err := s.dao.FindTradeDispute(trade.ID)
+	if err != nil || dispute.Status != models.DisputeOpen {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade has no open dispute")
+		return
+	}
+
+	uid, _ := primitive.ObjectIDFromHex(userID)
+	evidence, err := s.addEvidence(dispute, uid, actor, req.Message)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
+		Status:  "success",
+		Code:    http.StatusCreated,
+		Data:    evidence,
+		Message: "Evidence has been added to the dispute",
+	})
+}
+
+func (s *Service) addEvidence(dispute models.Dispute, userID primitive.ObjectID, role models.TradeActor, message string) (models.DisputeEvidence, error) {
+	evidence := models.DisputeEvidence{
+		ID:        primitive.NewObjectID(),
+		DisputeID: dispute.ID,
+		UserID:    userID,
+		Role:      role,
+		Message:   message,
+		CreatedAt: time.Now().UTC(),
+	}
+	err := s.dao.InsertDisputeEvidence(evidence)
+	if err != nil {
+		log.Printf("dispute_evidence: failed to record evidence on %s: %v", dispute.ID.Hex(), err)
+	}
+	return evidence, err
+}
+
+// GetTradeDispute returns a trade's latest dispute and its evidence to the
+// trade's buyer and seller
+func (s *Service) GetTradeDispute(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(models.ContextKey("user_id")).(string)
+	trade, err := s.dao.FindTradeByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+
+	if tradeActor(trade, userID) == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
+		return
+	}
+
+	dispute, err := s.dao.FindTradeDispute(trade.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade has not been disputed")
+		return
+	}
+
+	s.respondWithDispute(w, dispute, trade)
+}
+
+// GetDisputes returns the arbitration queue, open disputes oldest first
+// unless another status is asked for
+func (s *Service) GetDisputes(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.DisputeOpen
+	}
+
+	disputes, err := s.dao.QueryDisputes(bson.M{"status": status})
+	if err != nil {
+		log.Printf("get_disputes: failed to retrieve disputes: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving disputes")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   disputes,
+	})
+}
+
+// GetDispute returns a dispute with its trade and evidence for arbitration
+func (s *Service) GetDispute(w http.ResponseWriter, r *http.Request) {
+	dispute, err := s.dao.FindDisputeByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Dispute not found")
+		return
+	}
+
+	trade, err := s.dao.FindTradeByID(dispute.TradeID.Hex())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+
+	s.respondWithDispute(w, dispute, trade)
+}
+
+func (s *Service) respondWithDispute(w http.ResponseWriter, dispute models.Dispute, trade models.BuyTrade) {
+	evidence, err := s.dao.QueryDisputeEvidence(dispute.ID)
+	if err != nil {
+		log.Printf("get_dispute: failed to retrieve evidence: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving dispute")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: models.DisputeView{
+			Dispute:  dispute,
+			Trade:    trade,
+			Evidence: evidence,
+		},
+	})
+}
+
+// RuleDispute settles an open dispute, a ruling for the buyer releases the
+// trade's escrow to them and a ruling for the seller reverses it to the
+// seller's wallet
+func (s *Service) RuleDispute(w http.ResponseWriter, r *http.Request) {
+	var req models.DisputeRulingReq
+	if err := utils.DecodeReq(r, &req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+	if req.Ruling != models.RuleForBuyer && req.Ruling != models.RuleForSeller {
+		utils.RespondWithError(w, http.StatusBadRequest, "Ruling must be buyer or seller")
+		return
+	}
+
+	adminID := r.Context().Value(models.ContextKey("user_id")).(string)
+	dispute, err := s.dao.FindDisputeByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Dispute not found")
+		return
+	}
+	if dispute.Status != models.DisputeOpen {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dispute has already been settled")
+		return
+	}
+
+	trade, err := s.dao.FindTradeByID(dispute.TradeID.Hex())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+	if trade.Status != models.TradeDisputed {
+		utils.RespondWithError(w, http.StatusConflict, "Trade is not disputed, trade "+trade.Status)
+		return
+	}
+
+	// the trade is claimed first, its escrow stays frozen until then
+	var ok bool
+	if req.Ruling == models.RuleForBuyer {
+		ok, err = s.releaseToBuyer(&trade, models.TradeActorAdmin, adminID, req.Note)
+	} else {
+		ok, err = s.reverseToSeller(&trade, adminID, req.Note)
+	}
+	if err != nil {
+		log.Printf("rule_dispute: failed to settle trade %s: %v", trade.ID.Hex(), err)
+		utils.RespondWithError(w, http.StatusBadRequest, "An Error occurred while settling dispute: "+err.Error())
+		return
+	}
+	if !ok {
+		utils.RespondWithError(w, http.StatusConflict, "Trade was updated, please try again")
+		return
+	}
+
+	dispute.Ruling = req.Ruling
+	dispute.RulingNote = req.Note
+	dispute.ResolvedBy, _ = primitive.ObjectIDFromHex(adminID)
+	if _, err := s.dao.ResolveDispute(dispute); err != nil {
+		log.Printf("rule_dispute: failed to record ruling on %s: %v", dispute.ID.Hex(), err)
+	}
+
+	// notify both parties of the outcome
+	outcome := fmt.Sprintf("The dispute on the trade for %s was settled for the %s", trade.AmountText(), req.Ruling)
+	if req.Note != "" {
+		outcome += ": " + req.Note
+	}
+	data := notifications.GenericEmailData{Content: outcome}
+	go s.notifiable.SendGenericNotification(trade.BuyerID.Hex(), "Trade dispute settled", data)
+	go s.notifiable.SendGenericNotification(trade.SellerID.Hex(), "Trade dispute settled", data)
+
+	utils.RespondWithOk(w, "Dispute has been settled for the "+string(req.Ruling))
+}
+
+// reverseToSeller cancels a disputed trade and sends its escrowed coins back
+// to the seller, reporting whether this call cancelled it
+// The trade is claimed before its reversal is queued, a reversal that fails
+// to queue after the claim is retried by SettleTrades
+func (s *Service) reverseToSeller(trade *models.BuyTrade, adminID, note string) (bool, error) {
+	ok, err := s.transition(trade, models.TradeActionCancel, models.TradeActorAdmin, adminID, note)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err := s.settleTrade(*trade); err != nil {
+		log.Printf("rule_dispute: failed to queue reversal of trade %s, it will be retried: %v", trade.ID.Hex(), err)
+	}
+	return true, nil
+}
+
+// notifyAdmins sends a notification to every admin
+func (s *Service) notifyAdmins(subject, message string) {
+	var admins []models.User
+	if err := s.factoryDAO.QueryInto("user", bson.M{"admin": true}, &admins); err != nil {
+		log.Printf("failed to retrieve admins: %v", err)
+		return
+	}
+
+	data := notifications.GenericEmailData{Content: message}
+	for _, admin := range admins {
+		s.notifiable.SendGenericNotification(admin.ID.Hex(), subject, data)
+	}
+}
@@ -0,0 +1,68 @@
+package order
+
+import (
+	"vhennpay-bend/utils/scheduler"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultReleaseHours is used when SELLER_RELEASE_HOURS isn't set
+	defaultReleaseHours = 12
+	// defaultPaymentReminderMinutes is used when PAYMENT_REMINDER_MINUTES
+	// isn't set
+	defaultPaymentReminderMinutes = 5
+	// defaultReleaseReminderMinutes is used when RELEASE_REMINDER_MINUTES
+	// isn't set
+	defaultReleaseReminderMinutes = 30
+
+	tradeExpiryInterval     = time.Minute
+	tradeEscalationInterval = time.Minute * 5
+	tradeReminderInterval   = time.Minute
+	orderRepricingInterval  = time.Minute
+	orderReversalInterval   = time.Minute * 5
+	tradeSettlementInterval = time.Minute
+
+	// tradeSettlementGrace leaves a closed trade to the request that closed
+	// it before SettleTrades retries its escrow transfer
+	tradeSettlementGrace = time.Minute
+)
+
+// envInt returns the positive integer set in the environment variable key,
+// or def
+func envInt(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n < 1 {
+		return def
+	}
+	return n
+}
+
+// sellerReleaseWindow returns how long a seller has to release a trade once
+// the buyer marks it paid before it is escalated to support
+func sellerReleaseWindow() time.Duration {
+	return time.Duration(envInt("SELLER_RELEASE_HOURS", defaultReleaseHours)) * time.Hour
+}
+
+// paymentReminderLead returns how long before an opened trade's payment
+// deadline its buyer is reminded to pay
+func paymentReminderLead() time.Duration {
+	return time.Duration(envInt("PAYMENT_REMINDER_MINUTES", defaultPaymentReminderMinutes)) * time.Minute
+}
+
+// releaseReminderDelay returns how long a paid trade waits for its seller
+// before they are reminded to release it
+func releaseReminderDelay() time.Duration {
+	return time.Duration(envInt("RELEASE_REMINDER_MINUTES", defaultReleaseReminderMinutes)) * time.Minute
+}
+
+// RegisterJobs adds the order service's background jobs to sched
+func (s *Service) RegisterJobs(sched *scheduler.Scheduler) {
+	sched.Register("trade_expiry", tradeExpiryInterval, s.ExpireTrades)
+	sched.Register("trade_release_escalation", tradeEscalationInterval, s.EscalateUnreleasedTrades)
+	sched.Register("trade_reminders", tradeReminderInterval, s.RemindTrades)
+	sched.Register("order_repricing", orderRepricingInterval, s.RepriceOrders)
+	sched.Register("order_reversals", orderReversalInterval, s.RetryReversals)
+	sched.Register("trade_settlement", tradeSettlementInterval, s.SettleTrades)
+}
@@ -0,0 +1,108 @@
+package order
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/notifications"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RemindTrades reminds buyers of opened trades nearing their payment
+// deadline to pay, and sellers of trades paid a while ago to release them
+// Each reminder is sent once and only while the trade is still in the state
+// it was due for, so trades that moved on are never reminded
+func (s *Service) RemindTrades(now time.Time) error {
+	var failed int
+	failed += s.remindBuyers(now)
+	failed += s.remindSellers(now)
+	if failed > 0 {
+		return fmt.Errorf("%d trade reminders failed", failed)
+	}
+	return nil
+}
+
+// remindBuyers reminds buyers of opened trades due within
+// paymentReminderLead to pay, it returns how many reminders failed
+func (s *Service) remindBuyers(now time.Time) int {
+	lead := paymentReminderLead()
+	trades, err := s.dao.PoolTradesByTime(now.Add(lead), "pay_by", models.TradeOpened)
+	if err != nil {
+		log.Printf("trade_reminders: failed to retrieve opened trades: %v", err)
+		return 1
+	}
+
+	var failed int
+	for _, trade := range trades {
+		// trades opened with less than the lead left are only told once,
+		// when they're opened
+		if !trade.PayRemindedAt.IsZero() || trade.PayBy.Sub(trade.LockTime) <= lead {
+			continue
+		}
+		ok, err := s.dao.MarkTradeReminded(trade.ID, models.TradeOpened, "pay_reminded_at", now)
+		if err != nil {
+			log.Printf("trade_reminders: failed to mark trade %s: %v", trade.ID.Hex(), err)
+			failed++
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		left := trade.PayBy.Sub(now).Round(time.Minute)
+		message := fmt.Sprintf("You have %s left to pay for your trade of %s, "+
+			"mark it paid once you have paid or it will be cancelled", left, trade.AmountText())
+		s.notifiable.SendGenericNotification(trade.BuyerID.Hex(), "[Action Needed] Trade payment due",
+			notifications.GenericEmailData{Content: message})
+	}
+	return failed
+}
+
+// remindSellers reminds sellers of trades paid at least
+// releaseReminderDelay ago to release them, it returns how many reminders
+// failed
+func (s *Service) remindSellers(now time.Time) int {
+	delay := releaseReminderDelay()
+	trades, err := s.dao.PoolTradesByTime(now.Add(-delay), "paid_at", models.TradePaid)
+	if err != nil {
+		log.Printf("trade_reminders: failed to retrieve paid trades: %v", err)
+		return 1
+	}
+
+	var failed int
+	for _, trade := range trades {
+		if !trade.ReleaseRemindedAt.IsZero() {
+			continue
+		}
+		ok, err := s.dao.MarkTradeReminded(trade.ID, models.TradePaid, "release_reminded_at", now)
+		if err != nil {
+			log.Printf("trade_reminders: failed to mark trade %s: %v", trade.ID.Hex(), err)
+			failed++
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		message := fmt.Sprintf("The buyer marked your trade of %s paid %s ago, "+
+			"confirm it once you have received the payment. "+
+			"Trades not confirmed by %s are escalated to support",
+			trade.AmountText(), now.Sub(trade.PaidAt).Round(time.Minute), trade.ReleaseBy.Format(time.RFC1123))
+		s.notifiable.SendGenericNotification(trade.SellerID.Hex(), "[Action Needed] Trade awaiting confirmation",
+			notifications.GenericEmailData{Content: message})
+	}
+	return failed
+}
+
+// notifyExpired tells a trade's buyer and seller it was cancelled for not
+// being paid in time
+func (s *Service) notifyExpired(trade models.BuyTrade) {
+	data := notifications.GenericEmailData{Content: fmt.Sprintf(
+		"Your trade of %s was cancelled as it was not marked paid by %s", trade.AmountText(), trade.PayBy.Format(time.RFC1123))}
+	s.notifiable.SendGenericNotification(trade.BuyerID.Hex(), "Trade cancelled", data)
+
+	data = notifications.GenericEmailData{Content: fmt.Sprintf(
+		"The trade of %s on your order was cancelled as the buyer did not pay in time, "+
+			"the amount is available on your order again", trade.AmountText())}
+	s.notifiable.SendGenericNotification(trade.SellerID.Hex(), "Trade cancelled", data)
+}
@@ -0,0 +1,129 @@
+package order
+
+import (
+	"vhennpay-bend/dao"
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReviewTrade records a party's review of the other party on a released
+// trade, each party may review a trade once
+func (s *Service) ReviewTrade(w http.ResponseWriter, r *http.Request) {
+	var req models.ReviewReq
+	if err := utils.DecodeReq(r, &req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	req.Comment = strings.TrimSpace(req.Comment)
+	if req.Score < models.MinReviewScore || req.Score > models.MaxReviewScore {
+		utils.RespondWithError(w, http.StatusBadRequest,
+			fmt.Sprintf("Score must be between %d and %d", models.MinReviewScore, models.MaxReviewScore))
+		return
+	}
+	if len(req.Comment) > models.MaxReviewComment {
+		utils.RespondWithError(w, http.StatusBadRequest,
+			fmt.Sprintf("Comment must be at most %d characters", models.MaxReviewComment))
+		return
+	}
+
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	trade, err := s.dao.FindTradeByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+
+	actor := tradeActor(trade, userID.(string))
+	reviewee := trade.SellerID
+	switch actor {
+	case models.TradeActorBuyer:
+	case models.TradeActorSeller:
+		reviewee = trade.BuyerID
+	default:
+		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
+		return
+	}
+
+	if trade.Status != models.TradeReleased {
+		utils.RespondWithError(w, http.StatusBadRequest, "Only released trades can be reviewed, trade "+trade.Status)
+		return
+	}
+
+	uid, _ := primitive.ObjectIDFromHex(userID.(string))
+	review := models.Review{
+		ID:           primitive.NewObjectID(),
+		TradeID:      trade.ID,
+		OrderID:      trade.OrderID,
+		ReviewerID:   uid,
+		ReviewerRole: actor,
+		RevieweeID:   reviewee,
+		Score:        req.Score,
+		Comment:      req.Comment,
+		CreatedAt:    time.Now().UTC(),
+	}
+	err = s.reviews.Insert(review)
+	if dao.IsDuplicateKey(err) {
+		utils.RespondWithError(w, http.StatusConflict, "Trade already reviewed")
+		return
+	}
+	if err != nil {
+		log.Printf("review_trade: failed to create review: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred")
+		return
+	}
+
+	s.refreshReputation(reviewee)
+
+	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
+		Status:  "success",
+		Code:    http.StatusCreated,
+		Data:    review,
+		Message: "Review has been recorded",
+	})
+}
+
+// GetUserReviews returns a user's reputation with the reviews they received
+func (s *Service) GetUserReviews(w http.ResponseWriter, r *http.Request) {
+	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	user, err := s.factoryDAO.FactoryFindUser("user", id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	reviews, err := s.reviews.Query(user.ID)
+	if err != nil {
+		log.Printf("user_reviews: failed to retrieve reviews: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving reviews")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   models.UserReviews{Reputation: user.Reputation, Reviews: reviews},
+	})
+}
+
+// refreshReputation rebuilds and saves the reputation of users, a failure is
+// only logged as it is rebuilt again on their next review or closed trade
+func (s *Service) refreshReputation(users ...primitive.ObjectID) {
+	for _, id := range users {
+		rep, err := s.reviews.Reputation(id)
+		if err == nil {
+			err = s.users.SetReputation(id, rep)
+		}
+		if err != nil {
+			log.Printf("reputation: failed to refresh user %s: %v", id.Hex(), err)
+		}
+	}
+}
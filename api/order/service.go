@@ -4,12 +4,19 @@ import (
 	"vhennpay-bend/dao"
 	"vhennpay-bend/models"
 	"vhennpay-bend/utils"
+	"vhennpay-bend/utils/blob"
 	"vhennpay-bend/utils/escrow"
+	"vhennpay-bend/utils/fees"
+	"vhennpay-bend/utils/lid"
 	"vhennpay-bend/utils/notifications"
+	"vhennpay-bend/utils/pricing"
+	"vhennpay-bend/utils/realtime"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -21,20 +28,107 @@ import (
 type Service struct {
 	dao        *dao.OrderDAO
 	escrow     *escrow.Escrow
+	fees       *fees.Engine
+	blobs      blob.Store
 	factoryDAO *dao.FactoryDAO
+	users      *dao.UserDAO
+	reviews    *dao.ReviewDAO
 	notifiable notifications.Notifiable
+	prices     *pricing.Service
+	// hub holds the trade chat sockets, rooms are trade ids
+	hub *realtime.Hub
 }
 
-// NewOrderService returns a new order service
-func NewOrderService(dao *dao.OrderDAO, escrow *escrow.Escrow, factoryDAO *dao.FactoryDAO) *Service {
+// NewOrderService returns a new order service, blobs holds trade chat
+// attachments and prices prices floating orders
+func NewOrderService(dao *dao.OrderDAO, escrow *escrow.Escrow, fees *fees.Engine, blobs blob.Store, prices *pricing.Service, users *dao.UserDAO, reviews *dao.ReviewDAO, factoryDAO *dao.FactoryDAO) *Service {
 	notifiable, err := notifications.NewNotifiable(factoryDAO)
 	if err != nil {
 		log.Fatalf("notifiable_init: %v", err)
 		return nil
 	}
-	return &Service{dao: dao, escrow: escrow, factoryDAO: factoryDAO, notifiable: notifiable}
+	s := &Service{dao: dao, escrow: escrow, fees: fees, blobs: blobs, factoryDAO: factoryDAO, users: users,
+		reviews: reviews, notifiable: notifiable, prices: prices, hub: realtime.NewHub()}
+	escrow.OnConfirmed(models.TransferDeposit, s.depositConfirmed)
+	escrow.OnFailed(models.TransferDeposit, s.depositFailed)
+	return s
 }
 
+// depositConfirmed lists an order once its escrow deposit is final on-chain
+func (s *Service) depositConfirmed(t models.Transfer) {
+	ok, err := s.dao.UpdateStatus(t.OrderID, models.OrderFunding, models.OrderPending)
+	if err != nil {
+		log.Printf("failed to list funded order %v: %v", t.OrderID.Hex(), err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	order, err := s.dao.FindByID(t.OrderID.Hex())
+	if err != nil {
+		log.Printf("failed to retrieve funded order %v: %v", t.OrderID.Hex(), err)
+		return
+	}
+	if !order.BuyOrderID.IsZero() {
+		s.openFillTrade(order)
+		return
+	}
+	go s.notifiable.SendOrderCreatedNotification(order, order.CreatedBy.Hex())
+}
+
+// depositFailed fails an order whose escrow deposit was never made
+func (s *Service) depositFailed(t models.Transfer) {
+	s.failFunding(t.OrderID)
+}
+
+// failFunding fails an order still waiting for its escrow deposit, a fill
+// gives its amount back to its buy order
+func (s *Service) failFunding(orderID primitive.ObjectID) {
+	ok, err := s.dao.UpdateStatus(orderID, models.OrderFunding, models.OrderFailed)
+	if err != nil {
+		log.Printf("failed to update order %v: %v", orderID.Hex(), err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	order, err := s.dao.FindByID(orderID.Hex())
+	if err != nil {
+		log.Printf("failed to retrieve failed order %v: %v", orderID.Hex(), err)
+		return
+	}
+	if !order.BuyOrderID.IsZero() {
+		s.settleFill(order)
+	}
+}
+
+// orderFee returns the fee schedule trades on an order listed by seller are
+// charged at, the fee in force when the order is listed
+func (s *Service) orderFee(seller primitive.ObjectID, currency string, option int32) (models.FeeSchedule, error) {
+	user, err := s.factoryDAO.FactoryFindUser("user", seller)
+	if err != nil {
+		return models.FeeSchedule{}, err
+	}
+	return s.fees.Schedule(models.FeeQuery{
+		Scope:         models.FeeScopeTrade,
+		Currency:      currency,
+		PaymentOption: models.PaymentOption(option),
+		Tier:          user.Tier,
+	})
+}
+
+// validPaymentWindow reports whether window is within the payment window
+// bounds
+func validPaymentWindow(window time.Duration) bool {
+	return window >= models.MinPaymentWindow && window <= models.MaxPaymentWindow
+}
+
+// paymentWindowError is the error message for a payment window out of bounds
+var paymentWindowError = fmt.Sprintf("Payment window must be between %d and %d minutes",
+	int64(models.MinPaymentWindow/time.Minute), int64(models.MaxPaymentWindow/time.Minute))
+
 // CreateSellOrder creates a new sell order
 func (s *Service) CreateSellOrder(w http.ResponseWriter, r *http.Request) {
 	var (
@@ -57,9 +151,50 @@ func (s *Service) CreateSellOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !req.Amount.IsPositive() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount must be greater than zero")
+		return
+	}
+
+	window := models.DefaultPaymentWindow(models.PaymentOption(req.PaymentOption))
+	if req.PaymentWindow != 0 {
+		window = time.Duration(req.PaymentWindow) * time.Minute
+	}
+	if !validPaymentWindow(window) {
+		utils.RespondWithError(w, http.StatusBadRequest, paymentWindowError)
+		return
+	}
+
+	if code := req.Limits.Validate(); code != "" {
+		utils.RespondWithErrorCode(w, http.StatusBadRequest, code, tradeLimitError(code, req.Limits))
+		return
+	}
+
+	switch req.PriceType {
+	case "":
+		req.PriceType = models.PriceFixed
+	case models.PriceFixed:
+	case models.PriceFloating:
+		if msg := s.floatingPriceError(req); msg != "" {
+			utils.RespondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "Price type must be fixed or floating")
+		return
+	}
+
 	now := time.Now().UTC()
 	paymentOptionID, _ := primitive.ObjectIDFromHex(req.PaymentOptionID)
 	uid, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	fee, err := s.orderFee(uid, req.Currency, req.PaymentOption)
+	if err != nil {
+		log.Printf("create_order: failed to look up fee: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred while processing request")
+		return
+	}
+
 	order.ID = primitive.NewObjectID()
 	order.CreatedBy = uid
 	order.Amount = req.Amount
@@ -71,39 +206,196 @@ func (s *Service) CreateSellOrder(w http.ResponseWriter, r *http.Request) {
 	order.PaymentOptionID = paymentOptionID
 	order.PaymentOption = req.PaymentOption
 	order.Note = req.Note
-	order.Status = models.OrderPending
+	order.Fee = fee
+	order.PaymentWindow = int64(window / time.Minute)
+	order.Limits = req.Limits
+	order.Status = models.OrderFunding
 	order.CreatedAt = now
 	order.UpdatedAt = now
+	order.PriceType = req.PriceType
+	if order.Floating() {
+		order.Margin = req.Margin
+		order.FloorRate = req.FloorRate
+		order.CeilingRate = req.CeilingRate
+	}
 
-	err = s.escrow.NewDeposit(
-		order.ID,
-		order.CreatedBy,
-		order.Amount,
-		req.WalletID,
-		req.WalletPrivateKey,
-	)
+	order.ExRate, err = s.currentRate(order)
+	if err == models.ErrInvalidMoney {
+		utils.RespondWithError(w, http.StatusBadRequest, "Price margin is too large")
+		return
+	}
 	if err != nil {
-		log.Printf("failed to init escrow deposit: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occurred while charging wallet, reason: %v", err.Error()))
+		log.Printf("create_order: failed to price order: %v", err)
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Reference price unavailable, try again later")
+		return
+	}
+
+	// an order that can't be quoted whole can't be traded
+	if _, _, err := order.Quote(order.Amount, 0); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount is too large for the exchange rate")
+		return
+	}
+	if _, err := order.Fee.Apply(order.Amount); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount is too large")
 		return
 	}
 
+	// the order is recorded before the deposit so a settled deposit always
+	// has an order to list
 	if err := s.dao.Insert(order); err != nil {
 		log.Printf("failed to create new sell order: %v", err)
 		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred while processing request")
 		return
 	}
 
-	// prepare and dispatch notifications
-	go s.notifiable.SendOrderCreatedNotification(order, userID.(string))
+	deposit, err := s.escrow.PrepareDeposit(order.ID, order.CreatedBy, order.Amount, req.WalletID)
+	if err != nil {
+		log.Printf("failed to init escrow deposit: %v", err)
+		s.failFunding(order.ID)
+		utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred while processing request")
+		return
+	}
 
 	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
 		Status: "success",
 		Code:   http.StatusCreated,
-		Data:   order,
+		Data: models.SellOrderRes{
+			Order: order,
+			Deposit: models.DepositPayload{
+				Message:   deposit.Message,
+				ExpiresAt: deposit.ExpiresAt,
+			},
+		},
+		Message: "Sign the deposit with your wallet to list the order",
 	})
 }
 
+// floatingPriceError returns why a floating order can't be priced as
+// requested, or an empty string
+func (s *Service) floatingPriceError(req models.SellOrderReq) string {
+	if !strings.EqualFold(req.Currency, s.prices.Currency()) {
+		return "Floating prices are only available in " + s.prices.Currency()
+	}
+	if req.Margin.Cmp(models.MaxPriceMargin) > 0 || req.Margin.Cmp(models.MaxPriceMargin.Neg()) < 0 {
+		return "Margin must be between -" + models.MaxPriceMargin.String() + " and " + models.MaxPriceMargin.String() + " percent"
+	}
+	if req.FloorRate.Cmp(0) < 0 || req.CeilingRate.Cmp(0) < 0 {
+		return "Floor and ceiling rates can't be negative"
+	}
+	if req.FloorRate.IsPositive() && req.CeilingRate.IsPositive() && req.FloorRate.Cmp(req.CeilingRate) > 0 {
+		return "Floor rate can't be above the ceiling rate"
+	}
+	return ""
+}
+
+// currentRate returns the rate order sells at now, floating orders are
+// priced off the cached reference price
+func (s *Service) currentRate(order models.SellOrder) (models.Money, error) {
+	if !order.Floating() {
+		return order.ExRate, nil
+	}
+	price, err := s.prices.Price()
+	if err != nil {
+		return 0, err
+	}
+	return order.FloatingRate(price)
+}
+
+// RepriceOrders brings the rate of floating orders in line with the
+// reference price
+func (s *Service) RepriceOrders(now time.Time) error {
+	orders, err := s.dao.Query(bson.M{
+		"price_type": models.PriceFloating,
+		"status":     bson.M{"$in": bson.A{models.OrderFunding, models.OrderPending}},
+	})
+	if err != nil || len(orders) == 0 {
+		return err
+	}
+
+	var failed int
+	for _, order := range orders {
+		rate, err := s.currentRate(order)
+		if err == models.ErrInvalidMoney {
+			log.Printf("order_repricing: failed to price order %s: %v", order.ID.Hex(), err)
+			failed++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if rate == order.ExRate {
+			continue
+		}
+		if err := s.dao.SetRate(order.ID, rate); err != nil {
+			log.Printf("order_repricing: failed to reprice order %s: %v", order.ID.Hex(), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orders not repriced", failed, len(orders))
+	}
+	return nil
+}
+
+// SubmitDeposit relays an order's escrow deposit once the seller has signed
+// it, the order is listed when the deposit settles
+func (s *Service) SubmitDeposit(w http.ResponseWriter, r *http.Request) {
+	var req models.DepositReq
+	if err := utils.DecodeReq(r, &req); err != nil || req.Signature == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+		return
+	}
+
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	order, err := s.dao.FindByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	if order.CreatedBy.Hex() != userID.(string) {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Order not available to user")
+		return
+	}
+
+	if order.Status != models.OrderFunding {
+		utils.RespondWithError(w, http.StatusBadRequest, "Order is not awaiting a deposit, order "+order.Status)
+		return
+	}
+
+	err = s.escrow.SubmitDeposit(order.ID, req.Signature)
+	switch {
+	case err == nil:
+		order, _ = s.dao.FindByID(order.ID.Hex())
+		message := "Deposit has been sent, the order is listed once it is confirmed on-chain"
+		if order.Status == models.OrderPending {
+			message = "Deposit has been confirmed, order is listed"
+		}
+		utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
+			Status:  "success",
+			Code:    http.StatusCreated,
+			Data:    order,
+			Message: message,
+		})
+	case err == lid.ErrInvalidSignature:
+		utils.RespondWithError(w, http.StatusBadRequest, "Deposit signature is invalid")
+	case err == escrow.ErrDepositExpired:
+		s.failFunding(order.ID)
+		utils.RespondWithError(w, http.StatusGone, "Deposit has expired, please create a new order")
+	case err == escrow.ErrOutcomeUnknown, err == escrow.ErrDepositInFlight, lid.KindOf(err) == lid.ErrTransport, lid.KindOf(err) == lid.ErrUnavailable:
+		// the order is listed once the deposit is confirmed
+		utils.RespondWithJSON(w, http.StatusAccepted, utils.Response{
+			Status:  "success",
+			Code:    http.StatusAccepted,
+			Data:    order,
+			Message: "Wallet charge is being verified",
+		})
+	default:
+		log.Printf("failed to submit escrow deposit: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("An error occurred while charging wallet, reason: %v", err.Error()))
+	}
+}
+
 // ViewOrder ...
 func (s *Service) ViewOrder(w http.ResponseWriter, r *http.Request) {
 	orderID := mux.Vars(r)["id"]
@@ -113,18 +405,17 @@ func (s *Service) ViewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orderIn, err := s.dao.PipelineSingle(orderID, nil)
+	order, err := s.dao.PipelineSingle(orderID, nil)
 	if err != nil {
 		log.Printf("view_order: failed to retrieve order: %v", err)
 		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
 		return
 	}
-	order := orderIn.(bson.M)
 	var option interface{}
-	if order["payment_option_id"] != primitive.NilObjectID {
+	if order.PaymentOptionID != primitive.NilObjectID {
 		option, err = s.factoryDAO.FindPaymentOptByID(
-			order["payment_option_id"].(primitive.ObjectID).Hex(),
-			models.PaymentOption(order["payment_option"].(int32)),
+			order.PaymentOptionID.Hex(),
+			models.PaymentOption(order.PaymentOption),
 		)
 		if err != nil {
 			log.Printf("view_order: failed to retrieve order payment option: %v", err)
@@ -133,7 +424,7 @@ func (s *Service) ViewOrder(w http.ResponseWriter, r *http.Request) {
 		}
 
 	}
-	order["payment_option_data"] = option
+	order.PaymentOptionData = option
 
 	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
 		Status: "success",
@@ -142,40 +433,86 @@ func (s *Service) ViewOrder(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetPendingOrders applies filters to retreive pending orders
+// GetPendingOrders applies filters to retreive a page of pending orders
 func (s *Service) GetPendingOrders(w http.ResponseWriter, r *http.Request) {
 	query := make(bson.M)
 
 	v := r.URL.Query()
-	currency := v.Get("currency")
 	amount := v.Get("amount")
 	query["status"] = models.OrderPending
+	query["amount_available"] = bson.M{"$gt": models.Money(0)}
+	// fills are sold to their buy order's buyer only
+	query["buy_order_id"] = bson.M{"$exists": false}
 
-	if currency != "" && currency != "any" {
-		query["currency"] = bson.M{
-			"$regex":   currency,
-			"$options": "i",
+	if a, err := models.ParseMoney(amount); err == nil && a.IsPositive() {
+		query["amount_available"] = bson.M{
+			"$gte": a,
 		}
 	}
 
-	if amount != "" {
-		a, _ := strconv.ParseFloat(amount, 64)
-		query["amount"] = bson.M{
-			"$gte": a,
-		}
+	seller := make(bson.M)
+	page, err := dao.NewPage(v, "created_at", "ex_rate", "amount_available")
+	if err == nil {
+		err = dao.ListFilter(v, query, dao.FilterCurrency, dao.FilterRate, dao.FilterPaymentOption, dao.FilterDate)
+	}
+	if err == nil {
+		err = dao.ReputationFilter(v, "user_data", seller)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
 	}
 
-	orders, err := s.dao.PipelineAll(query)
+	orders, info, err := s.dao.PipelineAll(query, seller, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
 	if err != nil {
 		log.Printf("pending_orders: failed to retrieve orders: %v", err)
 		utils.RespondWithError(w, http.StatusNotFound, "No orders found with query")
 		return
 	}
 
+	// orders are marked with whether their limits admit the buyer
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	uid, _ := primitive.ObjectIDFromHex(userID.(string))
+	if buyer, err := s.factoryDAO.FactoryFindUser("user", uid); err != nil {
+		log.Printf("pending_orders: failed to retrieve buyer: %v", err)
+	} else {
+		for i := range orders {
+			orders[i].Ineligible = orders[i].Limits.CheckBuyer(buyer)
+			orders[i].Eligible = orders[i].Ineligible == ""
+		}
+	}
+
 	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
 		Status: "success",
 		Code:   http.StatusOK,
 		Data:   orders,
+		Page:   &info,
+	})
+}
+
+// GetOrderBook returns the order book of each currency, or of the currency
+// given, with its trade volume over the last MarketWindow
+func (s *Service) GetOrderBook(w http.ResponseWriter, r *http.Request) {
+	currency := r.URL.Query().Get("currency")
+	if currency == "any" {
+		currency = ""
+	}
+
+	books, err := s.dao.OrderBooks(currency, time.Now().UTC().Add(-models.MarketWindow))
+	if err != nil {
+		log.Printf("order_book: failed to build order books: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving order book")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   books,
 	})
 }
 
@@ -200,7 +537,20 @@ func (s *Service) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 		query["status"] = status
 	}
 
-	orders, err := s.dao.Query(query)
+	page, err := dao.NewPage(v, "created_at", "ex_rate", "amount")
+	if err == nil {
+		err = dao.ListFilter(v, query, dao.FilterCurrency, dao.FilterRate, dao.FilterPaymentOption, dao.FilterDate)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+
+	orders, info, err := s.dao.PageOrders(query, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
 	if err != nil {
 		log.Printf("user_orders: failed to retrieve orders: %v", err)
 		utils.RespondWithError(w, http.StatusNotFound, "No orders found with query")
@@ -211,6 +561,7 @@ func (s *Service) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 		Status: "success",
 		Code:   http.StatusOK,
 		Data:   orders,
+		Page:   &info,
 	})
 
 }
@@ -224,10 +575,29 @@ func (s *Service) ViewOrderTrades(w http.ResponseWriter, r *http.Request) {
 	}
 
 	porderID, _ := primitive.ObjectIDFromHex(orderID)
-	trades, err := s.dao.QueryTrades(bson.M{
+	query := bson.M{
 		"order_id": porderID,
-	})
+	}
+
+	v := r.URL.Query()
+	if status := v.Get("status"); status != "" {
+		query["status"] = status
+	}
 
+	page, err := dao.NewPage(v, "created_at", "amount")
+	if err == nil {
+		err = dao.ListFilter(v, query, dao.FilterDate)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+
+	trades, info, err := s.dao.PageTrades(query, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
 	if err != nil {
 		log.Printf("get_trades: failed to retrieve trade: %v", err)
 		utils.RespondWithError(w, http.StatusNotFound, "No trades found")
@@ -238,11 +608,24 @@ func (s *Service) ViewOrderTrades(w http.ResponseWriter, r *http.Request) {
 		Status: "success",
 		Code:   http.StatusOK,
 		Data:   trades,
+		Page:   &info,
 	})
 }
 
 // CancelOrder cancels an order
+// Orders with trades in progress are only cancelled when a partial cancel is
+// requested, the amount those trades reserve stays in escrow until they finish
 func (s *Service) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	// the body is optional, chunked requests carry no content length so an
+	// empty body is told apart by reading it
+	var req models.CancelOrderReq
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
+			return
+		}
+	}
+
 	orderID := mux.Vars(r)["id"]
 	if orderID == "" {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
@@ -264,22 +647,180 @@ func (s *Service) CancelOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order.Status = models.OrderCancelled
+	if order.Status == models.OrderCancelled {
+		utils.RespondWithOk(w, "Order already cancelled")
+		return
+	}
+
+	if order.Status != models.OrderPending && order.Status != models.OrderClosing {
+		utils.RespondWithError(w, http.StatusBadRequest, "Order cannot be cancelled, order "+order.Status)
+		return
+	}
 
-	if err := s.dao.Update(order); err != nil {
-		log.Printf("failed to update order %v: %v", order.ID.Hex(), err)
+	trades, err := s.openTrades(order.ID)
+	if err != nil {
+		log.Printf("cancel_order: failed to retrieve trades: %v", err)
 		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
 		return
 	}
 
-	err = s.escrow.ReverseDeposit(order)
+	if len(trades) > 0 && !req.Partial {
+		utils.RespondWithJSON(w, http.StatusConflict, utils.Response{
+			Status: "error",
+			Code:   http.StatusConflict,
+			Data: models.CancelOrderRes{
+				Order:             order,
+				OutstandingTrades: trades,
+			},
+			Error: "Order has trades in progress, they must finish before the order can be cancelled",
+		})
+		return
+	}
+
+	// close the order first so no new amount can be reserved, then look at
+	// what trades still hold
+	if order.Status == models.OrderPending {
+		ok, err := s.dao.UpdateStatus(order.ID, models.OrderPending, models.OrderClosing)
+		if err != nil {
+			log.Printf("failed to update order %v: %v", order.ID.Hex(), err)
+			utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
+			return
+		}
+		if !ok {
+			utils.RespondWithError(w, http.StatusConflict, "Order was updated, please try again")
+			return
+		}
+	}
+
+	order, err = s.dao.FindByID(orderID)
 	if err != nil {
+		log.Printf("cancel_order: failed to retrieve order: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
+		return
+	}
+
+	if order.AmountReserved.IsPositive() {
+		err = s.escrow.ReverseUnreserved(order, order.AmountReserved)
+	} else {
+		if _, err := s.dao.UpdateStatus(order.ID, models.OrderClosing, models.OrderCancelled); err != nil {
+			log.Printf("failed to update order %v: %v", order.ID.Hex(), err)
+			utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
+			return
+		}
+		order.Status = models.OrderCancelled
+		err = s.escrow.ReverseDeposit(order)
+	}
+	reversalPending := err != nil && err != escrow.ErrNothingToReverse
+	if reversalPending {
 		log.Printf("failed to reverse escrow deposit: %v", err)
 	}
 
+	// a failed reversal is retried, by the order_reversals job once the order
+	// is cancelled and when a closing order settles otherwise
+	message := "Order has been cancelled"
+	if reversalPending {
+		message = "Order has been cancelled, the deposit will be returned once the reversal can be queued"
+	}
+	if order.Status == models.OrderClosing {
+		message = "Order is closing, it will be cancelled once trades in progress finish"
+		if reversalPending {
+			message += " and the deposit returned then"
+		}
+	}
+
 	utils.RespondWithJSON(w, http.StatusAccepted, utils.Response{
-		Status:  "success",
-		Code:    http.StatusAccepted,
-		Message: "Order has been cancelled",
+		Status: "success",
+		Code:   http.StatusAccepted,
+		Data: models.CancelOrderRes{
+			Order:             order,
+			OutstandingTrades: trades,
+		},
+		Message: message,
+	})
+}
+
+// RetryReversals reverses the deposits left in escrow for cancelled orders,
+// a reversal that failed when the order was cancelled is retried here
+func (s *Service) RetryReversals(now time.Time) error {
+	deposits, err := s.escrow.OrphanedDeposits()
+	if err != nil || len(deposits) == 0 {
+		return err
+	}
+
+	var failed int
+	for _, d := range deposits {
+		order, err := s.dao.FindByID(d.OrderID.Hex())
+		if err != nil {
+			log.Printf("order_reversals: failed to retrieve order %s: %v", d.OrderID.Hex(), err)
+			failed++
+			continue
+		}
+
+		err = s.escrow.ReverseDeposit(order)
+		if err != nil && err != escrow.ErrNothingToReverse {
+			log.Printf("order_reversals: failed to reverse order %s: %v", order.ID.Hex(), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d reversals not queued", failed, len(deposits))
+	}
+	return nil
+}
+
+// openTrades returns the trades still holding a reservation on an order,
+// closed trades whose escrow transfer isn't queued yet still hold theirs
+func (s *Service) openTrades(orderID primitive.ObjectID) ([]models.BuyTrade, error) {
+	return s.dao.QueryTrades(bson.M{
+		"order_id": orderID,
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": models.OpenTradeStatuses}},
+			bson.M{"settling": true},
+		},
 	})
 }
+
+// settleClosingOrder closes a closing order once its last trade in progress
+// has finished, it is completed when everything was sold and otherwise
+// cancelled with whatever is left in escrow reversed
+func (s *Service) settleClosingOrder(orderID primitive.ObjectID) {
+	order, err := s.dao.FindByID(orderID.Hex())
+	if err != nil {
+		log.Printf("settle_closing: failed to retrieve order %v: %v", orderID.Hex(), err)
+		return
+	}
+
+	if order.Status != models.OrderClosing {
+		return
+	}
+
+	trades, err := s.openTrades(order.ID)
+	if err != nil {
+		log.Printf("settle_closing: failed to retrieve trades: %v", err)
+		return
+	}
+	if len(trades) > 0 {
+		return
+	}
+
+	status := models.OrderCancelled
+	if order.AmountSold.IsPositive() && !order.AmountLeft.IsPositive() {
+		status = models.OrderCompleted
+	}
+	ok, err := s.dao.UpdateStatus(order.ID, models.OrderClosing, status)
+	if err != nil || !ok {
+		return
+	}
+
+	if !order.BuyOrderID.IsZero() {
+		s.settleFill(order)
+	}
+	if status == models.OrderCompleted {
+		return
+	}
+
+	err = s.escrow.ReverseDeposit(order)
+	if err != nil && err != escrow.ErrNothingToReverse {
+		log.Printf("failed to reverse escrow deposit: %v", err)
+	}
+}
@@ -1,12 +1,14 @@
 package order
 
 import (
+	"vhennpay-bend/dao"
 	"vhennpay-bend/models"
 	"vhennpay-bend/utils"
 	"vhennpay-bend/utils/notifications"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -61,7 +63,7 @@ func (s *Service) CreateBuyTrade(w http.ResponseWriter, r *http.Request) {
 	q := bson.M{
 		"buyer_id": bid,
 		"order_id": order.ID,
-		"status":   models.TradeInProgress,
+		"status":   bson.M{"$in": models.OpenTradeStatuses},
 	}
 
 	ctrades, err := s.dao.QueryTrades(q)
@@ -81,44 +83,91 @@ func (s *Service) CreateBuyTrade(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if userID.(string) == order.CreatedBy.Hex() {
+	if userID.(string) == order.CreatedBy.Hex() || !order.BuyOrderID.IsZero() {
 		utils.RespondWithError(w, http.StatusNotFound, "Operation not allowed on order")
 		return
 	}
 
-	if order.AmountSold > 0 && req.Amount > order.AmountSold {
-		utils.RespondWithError(w, http.StatusNotFound, "Order has limited funds available")
+	// floating orders are traded at their rate when the trade is opened
+	order.ExRate, err = s.currentRate(order)
+	if err != nil {
+		log.Printf("buy_trade: failed to price order: %v", err)
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Reference price unavailable, try again later")
 		return
 	}
 
-	if req.Amount > order.Amount || (order.AmountLeft > 0 && req.Amount > order.AmountLeft) {
-		utils.RespondWithError(w, http.StatusNotFound, "Order has limited funds available")
+	if !req.Amount.IsZero() && !req.FiatAmount.IsZero() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Enter either an amount or a fiat amount")
+		return
+	}
+	if req.FiatAmount.IsPositive() && !order.ExRate.IsPositive() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Order has no exchange rate, enter an amount")
 		return
 	}
 
-	now := time.Now().UTC()
+	req.Amount, req.FiatAmount, err = order.Quote(req.Amount, req.FiatAmount)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount is too large")
+		return
+	}
+	if !req.Amount.IsPositive() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount must be greater than zero")
+		return
+	}
 
-	buyerID, _ := primitive.ObjectIDFromHex(userID.(string))
+	buyer, err := s.factoryDAO.FactoryFindUser("user", bid)
+	if err != nil {
+		log.Printf("buy_trade: failed to retrieve buyer: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
+		return
+	}
+	if code := order.Limits.CheckBuyer(buyer); code != "" {
+		utils.RespondWithErrorCode(w, http.StatusForbidden, code, tradeLimitError(code, order.Limits))
+		return
+	}
+	available := order.AmountLeft.Sub(order.AmountReserved)
+	if code := order.Limits.CheckAmount(req.Amount, available); code != "" {
+		utils.RespondWithErrorCode(w, http.StatusBadRequest, code, tradeLimitError(code, order.Limits))
+		return
+	}
 
-	trade := models.BuyTrade{
-		ID:          primitive.NewObjectID(),
-		SellerID:    order.CreatedBy,
-		BuyerID:     buyerID,
-		OrderID:     order.ID,
-		BuyerWallet: req.WalletID,
-		Amount:      req.Amount,
-		LockTime:    now,
-		Status:      models.TradeInProgress,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+	fee, err := order.Fee.Apply(req.Amount)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount is too large")
+		return
+	}
+	if !req.Amount.Sub(fee).IsPositive() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Amount does not cover the trade fee of "+fee.String())
+		return
 	}
 
+	// reserve the amount before the trade exists so concurrent buyers can't
+	// both claim what is left on the order
+	ok, err := s.dao.Reserve(order.ID, req.Amount)
+	if err != nil {
+		log.Printf("buy_trade: failed to reserve amount: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
+		return
+	}
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Order has limited funds available")
+		return
+	}
+
+	buyerID, _ := primitive.ObjectIDFromHex(userID.(string))
+	trade := newBuyTrade(order, buyerID, req.WalletID, req.Amount, req.FiatAmount, fee)
+
 	if err := s.dao.InsertTrade(trade); err != nil {
 		log.Printf("failed to create buy_trade: %v", err)
+		if err := s.dao.Release(order.ID, trade.Amount); err != nil {
+			log.Printf("buy_trade: failed to release reserved amount: %v", err)
+		}
 		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
 		return
 	}
 
+	s.recordTradeEvent(trade, models.TradeActionOpen, "", models.TradeActorBuyer, userID.(string), "")
+
 	// dispatch notification
 	go s.notifiable.SendOrderIntentNotification(trade, trade.BuyerID.Hex(), trade.SellerID.Hex())
 
@@ -130,9 +179,61 @@ func (s *Service) CreateBuyTrade(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetTrades ...
+// tradeLimitError returns the message for a trade limits error code
+func tradeLimitError(code string, limits models.TradeLimits) string {
+	switch code {
+	case models.ErrCodeTradeBelowMin:
+		return "Trades on this order must be at least " + limits.MinAmount.String() + "QC"
+	case models.ErrCodeTradeAboveMax:
+		return "Trades on this order must be at most " + limits.MaxAmount.String() + "QC"
+	case models.ErrCodeBuyerReputation:
+		return fmt.Sprintf("This order requires an average review score of at least %.1f", limits.MinScore)
+	case models.ErrCodeBuyerTrades:
+		return fmt.Sprintf("This order requires at least %d completed trades", limits.MinTrades)
+	case models.ErrCodeBuyerUnverified:
+		return "This order is only available to verified accounts"
+	}
+	return "Invalid trade limits"
+}
+
+// newBuyTrade returns a new trade of amount on order for buyerID, owing fiat
+// for it and charged fee, the amount must already be reserved on the order
+func newBuyTrade(order models.SellOrder, buyerID primitive.ObjectID, wallet string, amount, fiat, fee models.Money) models.BuyTrade {
+	now := time.Now().UTC()
+	return models.BuyTrade{
+		ID:          primitive.NewObjectID(),
+		SellerID:    order.CreatedBy,
+		BuyerID:     buyerID,
+		OrderID:     order.ID,
+		BuyOrderID:  order.BuyOrderID,
+		BuyerWallet: wallet,
+		Amount:      amount,
+		FiatAmount:  fiat,
+		Currency:    order.Currency,
+		ExRate:      order.ExRate,
+		Fee:         fee,
+		NetAmount:   amount.Sub(fee),
+		LockTime:    now,
+		PayBy:       now.Add(order.PaymentDeadline()),
+		Status:      models.TradeOpened,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// Trade list roles, the side of their trades a user lists
+const (
+	tradeRoleBuying  = "buying"
+	tradeRoleSelling = "selling"
+	tradeRoleAll     = "all"
+)
+
+// GetTrades returns a page of the trades the user buys in, sells in or both
+// as picked by role, all by default
+// status takes a comma separated list of statuses and awaiting=true keeps
+// the trades waiting on the user, opened trades they buy in and paid trades
+// they sell in
 func (s *Service) GetTrades(w http.ResponseWriter, r *http.Request) {
-	query := make(bson.M)
 	v := r.URL.Query()
 	status := v.Get("status")
 
@@ -144,29 +245,68 @@ func (s *Service) GetTrades(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query["buyer_id"] = puserID
+	buying := bson.M{"buyer_id": puserID}
+	selling := bson.M{"seller_id": puserID}
+	if v.Get("awaiting") == "true" {
+		buying["status"] = models.TradeOpened
+		selling["status"] = models.TradePaid
+	}
+
+	query := make(bson.M)
+	switch v.Get("role") {
+	case tradeRoleBuying:
+		query["$and"] = bson.A{buying}
+	case tradeRoleSelling:
+		query["$and"] = bson.A{selling}
+	case "", tradeRoleAll:
+		query["$or"] = bson.A{buying, selling}
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid trade role")
+		return
+	}
+
 	if status != "" {
-		query["status"] = status
+		query["status"] = bson.M{"$in": strings.Split(status, ",")}
+	}
+
+	page, err := dao.NewPage(v, "created_at", "amount")
+	if err == nil {
+		err = dao.ListFilter(v, query, dao.FilterDate)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
 	}
 
-	trades, err := s.dao.QueryTrades(query)
+	trades, info, err := s.dao.PageTradeViews(puserID, query, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
 	if err != nil {
 		log.Printf("user_trades: failed to retrieve trades: %v", err)
 		utils.RespondWithError(w, http.StatusNotFound, "No trades found with query")
 		return
 	}
 
+	for i := range trades {
+		t := &trades[i]
+		t.NextAction, t.NextActor = models.TradeNextStep(t.Status)
+		t.AwaitingUser = t.NextActor != "" && t.NextActor == t.Role
+	}
+
 	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
 		Status: "success",
 		Code:   http.StatusOK,
 		Data:   trades,
+		Page:   &info,
 	})
 }
 
-// ConfirmTrade ...
+// ConfirmTrade releases a trade's coins to the buyer, only its seller may
+// confirm a trade
 func (s *Service) ConfirmTrade(w http.ResponseWriter, r *http.Request) {
-	var userIDKey = models.ContextKey("user_id")
-	orderCreator := r.Context().Value(userIDKey)
+	userID := r.Context().Value(models.ContextKey("user_id"))
 	tradeID := mux.Vars(r)["id"]
 
 	if tradeID == "" {
@@ -181,96 +321,113 @@ func (s *Service) ConfirmTrade(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if trade.Status == models.TradeProcessed {
+	if trade.Status == models.TradeReleased {
 		utils.RespondWithOk(w, "Trade already marked as confirmed")
 		return
 	}
 
-	if trade.Status != models.TradeInProgress && trade.Status != models.TradeProcessed {
+	// validate confirmation triggerer
+	actor := tradeActor(trade, userID.(string))
+	if actor != models.TradeActorSeller {
 		utils.RespondWithError(w, http.StatusUnauthorized, "Trade operation not allowed")
 		return
 	}
 
-	order, err := s.dao.FindByID(trade.OrderID.Hex())
-	if err != nil {
-		log.Printf("confirm_trade: failed to retrieve order: %v", err)
-		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
+	if _, err := models.NextTradeStatus(trade.Status, models.TradeActionRelease, actor); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Trade cannot be confirmed, trade "+trade.Status)
 		return
 	}
 
-	user, err := s.factoryDAO.FactoryFindUser("user", trade.SellerID)
+	ok, err := s.releaseToBuyer(&trade, actor, userID.(string), "")
 	if err != nil {
-		log.Printf("get_user: failed to retrieve user: %v", err)
-		utils.RespondWithError(w, http.StatusNotFound, "Seller not found")
+		log.Printf("confirm_trade: failed to release trade %s: %v", trade.ID.Hex(), err)
+		utils.RespondWithError(w, http.StatusBadRequest, "An Error occurred while confirming trade: "+err.Error())
 		return
 	}
-
-	// validate confirmation triggerer
-	if orderCreator.(string) != order.CreatedBy.Hex() {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Trade operation not allowed")
+	if !ok {
+		utils.RespondWithError(w, http.StatusConflict, "Trade was updated, please try again")
 		return
 	}
 
-	if trade.Confirmed {
-		utils.RespondWithOk(w, "Trade is already marked as confirmed")
-		return
-	}
+	utils.RespondWithJSON(w, http.StatusAccepted, utils.Response{
+		Status:  "success",
+		Code:    http.StatusAccepted,
+		Message: "Order has been marked as confirmed",
+	})
+}
 
-	now := time.Now().UTC()
-	// update trade
-	trade.Confirmed = true
-	trade.ProcessedAt = time.Now()
-	trade.Status = models.TradeProcessed
-	trade.UpdatedAt = now
+// releaseToBuyer releases a trade's escrowed coins to its buyer and moves
+// the trade to released, reporting whether this call released it
+// The trade is claimed before its release is queued so a trade expired or
+// cancelled concurrently is never paid out, a release that fails to queue
+// after the claim is retried by SettleTrades
+func (s *Service) releaseToBuyer(trade *models.BuyTrade, actor models.TradeActor, actorID, note string) (bool, error) {
+	ok, err := s.transition(trade, models.TradeActionRelease, actor, actorID, note)
+	if err != nil || !ok {
+		return false, err
+	}
 
-	// update order
-	order.AmountSold = order.AmountSold + trade.Amount
-	order.AmountLeft = order.Amount - order.AmountSold
-	order.UpdatedAt = now
+	if err := s.settleTrade(*trade); err != nil {
+		log.Printf("release_trade: failed to queue release of trade %s, it will be retried: %v", trade.ID.Hex(), err)
+	}
 
 	// update user (seller) attributes
-	user.NumTransactions++
-
-	// release fund
-	err = s.processConfirmedOrder(trade)
-	if err != nil {
-		log.Printf("escrow_release: failed to release deposit: %v", err)
-		utils.RespondWithError(w, http.StatusBadRequest, "An Error occurred while confirming trade: "+err.Error())
-		return
+	if err := s.users.CountTransaction(trade.SellerID); err != nil {
+		log.Printf("release_trade: failed to update seller %s: %v", trade.SellerID.Hex(), err)
 	}
 
-	// update user
-	if err := s.factoryDAO.Update("user", user.ID, user); err != nil {
-		log.Printf("update_user: failed to update user: %v", err)
-		utils.RespondWithError(w, http.StatusBadRequest, "An Error occurred while confirming trade")
-		return
-	}
+	// notify
+	go s.notifiable.SendOrderConfirmedNotification(*trade, trade.BuyerID.Hex())
 
-	// persit trade changes
-	if err := s.dao.UpdateTrade(trade); err != nil {
-		log.Printf("confirm_trade: failed to update trade: %v", err)
-		utils.RespondWithError(w, http.StatusBadRequest, "An Error occurred while confirming trade")
-		return
+	return true, nil
+}
+
+// settleTrade queues the escrow transfer closing a trade, a release to the
+// buyer or a reversal to the seller, and then takes its reserved amount off
+// the order, it is safe to repeat until the trade is marked settled
+func (s *Service) settleTrade(trade models.BuyTrade) error {
+	// a closed trade is no longer disputed, its share of escrow may move
+	if err := s.escrow.Unfreeze(trade); err != nil {
+		return err
 	}
 
-	// persit order changes
-	if err := s.dao.Update(order); err != nil {
-		log.Printf("confirm_order: failed to update order: %v", err)
-		utils.RespondWithError(w, http.StatusBadRequest, "An Error occurred while confirming order")
-		return
+	released := trade.Status == models.TradeReleased
+	if released {
+		// the release is queued on the escrow outbox and is safe to repeat
+		if err := s.escrow.ReleaseDeposit(trade, trade.BuyerWallet); err != nil {
+			return err
+		}
+	} else {
+		order, err := s.dao.FindByID(trade.OrderID.Hex())
+		if err != nil {
+			return err
+		}
+		// the reversal is queued on the escrow outbox and is safe to repeat
+		if err := s.escrow.ReverseTrade(order, trade); err != nil {
+			return err
+		}
 	}
 
-	// notify
-	go s.notifiable.SendOrderConfirmedNotification(trade, trade.BuyerID.Hex())
+	ok, err := s.dao.MarkTradeSettled(trade.ID)
+	if err != nil || !ok {
+		return err
+	}
 
-	utils.RespondWithJSON(w, http.StatusAccepted, utils.Response{
-		Status:  "success",
-		Code:    http.StatusAccepted,
-		Message: "Order has been marked as confirmed",
-	})
+	if released {
+		// move the reserved amount to sold
+		err = s.dao.Settle(trade.OrderID, trade.Amount)
+	} else {
+		// the reserved amount left escrow, it can't be sold again
+		err = s.dao.Withdraw(trade.OrderID, trade.Amount)
+	}
+	if err != nil {
+		log.Printf("settle_trade: failed to update order %s: %v", trade.OrderID.Hex(), err)
+	}
+	go s.settleClosingOrder(trade.OrderID)
+	return nil
 }
 
-// MarkTradePaid ...
+// MarkTradePaid records the buyer has paid the seller for an opened trade
 func (s *Service) MarkTradePaid(w http.ResponseWriter, r *http.Request) {
 	tradeID := mux.Vars(r)["id"]
 	if tradeID == "" {
@@ -286,35 +443,42 @@ func (s *Service) MarkTradePaid(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := s.factoryDAO.FactoryFindUser("user", trade.BuyerID)
-	if err != nil {
-		log.Printf("get_user: failed to retrieve user: %v", err)
-		utils.RespondWithError(w, http.StatusNotFound, "Buyer info not found")
-		return
-	}
-
-	if trade.MarkPaid {
+	if trade.Status == models.TradePaid {
 		utils.RespondWithOk(w, "Trade already marked as paid")
 		return
 	}
 
-	if trade.BuyerID.Hex() != userID.(string) {
+	actor := tradeActor(trade, userID.(string))
+	if actor != models.TradeActorBuyer {
 		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
 		return
 	}
 
-	trade.MarkPaid = true
-	trade.UpdatedAt = time.Now().UTC()
+	user, err := s.factoryDAO.FactoryFindUser("user", trade.BuyerID)
+	if err != nil {
+		log.Printf("get_user: failed to retrieve user: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "Buyer info not found")
+		return
+	}
 
-	if err := s.dao.UpdateTrade(trade); err != nil {
+	ok, err := s.transition(&trade, models.TradeActionPay, actor, userID.(string), "")
+	if err == models.ErrTradeTransition {
+		utils.RespondWithError(w, http.StatusBadRequest, "Trade cannot be marked paid, trade "+trade.Status)
+		return
+	}
+	if err != nil {
 		log.Printf("failed to update trade %v: %v", trade.ID.Hex(), err)
 		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
 		return
 	}
+	if !ok {
+		utils.RespondWithError(w, http.StatusConflict, "Trade was updated, please try again")
+		return
+	}
 
 	// notify seller
 	subject := "[Action Needed] Order marked paid"
-	message := fmt.Sprintf("Order for %fQC has been marked as paid by @%s", trade.Amount, user.Username)
+	message := fmt.Sprintf("Order for %s has been marked as paid by @%s", trade.AmountText(), user.Username)
 	data := notifications.GenericEmailData{
 		Content: message,
 	}
@@ -328,7 +492,8 @@ func (s *Service) MarkTradePaid(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// CancelTrade ...
+// CancelTrade cancels a trade for its buyer, trades the buyer has marked
+// paid can't be cancelled
 func (s *Service) CancelTrade(w http.ResponseWriter, r *http.Request) {
 	tradeID := mux.Vars(r)["id"]
 	if tradeID == "" {
@@ -349,17 +514,26 @@ func (s *Service) CancelTrade(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if trade.BuyerID.Hex() != userID.(string) {
+	actor := tradeActor(trade, userID.(string))
+	if actor != models.TradeActorBuyer {
 		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
 		return
 	}
 
-	trade.Status = models.TradeCancelled
-	if err := s.dao.UpdateTrade(trade); err != nil {
+	ok, err := s.cancelTrade(&trade, models.TradeActionCancel, actor, userID.(string), "")
+	if err == models.ErrTradeTransition {
+		utils.RespondWithError(w, http.StatusBadRequest, "Trade cannot be cancelled, trade "+trade.Status)
+		return
+	}
+	if err != nil {
 		log.Printf("failed to update trade %v: %v", trade.ID.Hex(), err)
 		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
 		return
 	}
+	if !ok {
+		utils.RespondWithError(w, http.StatusConflict, "Trade was updated, please try again")
+		return
+	}
 
 	utils.RespondWithJSON(w, http.StatusAccepted, utils.Response{
 		Status:  "success",
@@ -368,28 +542,42 @@ func (s *Service) CancelTrade(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Service) processConfirmedOrder(trade models.BuyTrade) error {
-	log.Printf("releasing funds for BuyTrade: %s", trade.ID.Hex())
-
-	err := s.escrow.ReleaseDeposit(trade, trade.BuyerWallet)
-	if err != nil {
-		return err
+// cancelTrade moves a trade to cancelled or expired with action and returns
+// what it reserved to its order, reporting whether this call moved it
+func (s *Service) cancelTrade(trade *models.BuyTrade, action models.TradeAction, actor models.TradeActor, actorID, note string) (bool, error) {
+	ok, err := s.transition(trade, action, actor, actorID, note)
+	if err != nil || !ok {
+		return false, err
 	}
 
-	return err
+	s.releaseTrade(*trade)
+	go s.settleClosingOrder(trade.OrderID)
+
+	return true, nil
+}
+
+// releaseTrade returns the amount a cancelled trade reserved to its order
+func (s *Service) releaseTrade(trade models.BuyTrade) {
+	if err := s.dao.Release(trade.OrderID, trade.Amount); err != nil {
+		log.Printf("failed to release amount reserved by trade %v: %v", trade.ID.Hex(), err)
+	}
 }
 
-// NewMessage records a new message on a buy trade
+// NewMessage records a new message on a buy trade, a JPEG or PNG image or a
+// PDF such as a payment receipt may be attached by sending the message as a
+// multipart form
 func (s *Service) NewMessage(w http.ResponseWriter, r *http.Request) {
-	var req models.NewMessageReq
-	err := utils.DecodeReq(r, &req)
-	if err != nil {
-		log.Printf("buy_intent: error decoding req: %v", err)
+	req, err := decodeMessage(w, r)
+	if err == errInvalidMessage {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request data sent")
 		return
 	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Attachment rejected, "+err.Error())
+		return
+	}
 
-	if req.Message == "" {
+	if req.message == "" && req.file == nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Message is empty")
 		return
 	}
@@ -410,64 +598,33 @@ func (s *Service) NewMessage(w http.ResponseWriter, r *http.Request) {
 
 	// guard
 	uid := userID.(string)
-	log.Println("uid:", uid)
-	if uid != trade.SellerID.Hex() && uid != trade.BuyerID.Hex() {
+	if tradeActor(trade, uid) == "" {
 		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
 		return
 	}
 
-	puid, _ := primitive.ObjectIDFromHex(uid)
-	now := time.Now().UTC()
-	msg := models.TradeChat{
-		ID:        primitive.NewObjectID(),
-		TradeID:   trade.ID,
-		UserID:    puid,
-		Message:   req.Message,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-
-	var msgType string
-	if uid == trade.SellerID.Hex() && trade.BuyerID != primitive.NilObjectID {
-		// msg from seller
-		msgType = "msg_from:seller"
-	}
-
-	if uid == trade.BuyerID.Hex() {
-		msgType = "msg_from:buyer"
-	}
-
-	if msgType == "" {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Operation not allowed on trade")
-		return
+	msg := newTradeChat(trade, uid, req.message)
+	if req.file != nil {
+		msg.Attachment, err = s.storeAttachment(trade, req.name, *req.file)
+		if err != nil {
+			log.Printf("new_message: failed to store attachment: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "An Error occurred")
+			return
+		}
+		if msg.Attachment.ThumbnailKey != "" {
+			msg.ImageURL = msg.Attachment.URL
+		}
 	}
 
-	if err := s.factoryDAO.Insert("trade_chat", msg); err != nil {
+	if err := s.postMessage(trade, msg); err != nil {
 		log.Printf("err create_trade_chat: %+v", err)
+		if msg.Attachment != nil {
+			s.dropAttachment(msg.Attachment)
+		}
 		utils.RespondWithError(w, http.StatusNotFound, "An Error occurred")
 		return
 	}
 
-	// dispatch notification
-	var (
-		subject string
-		to      string
-		nData   notifications.GenericEmailData
-	)
-	switch msgType {
-	case "msg_from:seller":
-		subject = "New message from seller"
-		to = trade.BuyerID.Hex()
-	case "msg_from:buyer":
-		subject = "Trade message from buyer"
-		to = trade.SellerID.Hex()
-	}
-	nData = notifications.GenericEmailData{
-		Formatted: false,
-		Content:   msg.Message,
-	}
-	go s.notifiable.SendGenericNotification(to, subject, nData)
-
 	utils.RespondWithJSON(w, http.StatusCreated, utils.Response{
 		Status:  "success",
 		Code:    http.StatusCreated,
@@ -491,7 +648,28 @@ func (s *Service) GetTradeMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	messages, err := s.dao.QueryTradeMessages(trade.ID)
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	if tradeActor(trade, userID.(string)) == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
+		return
+	}
+
+	query := bson.M{"trade_id": trade.ID}
+	v := r.URL.Query()
+	page, err := dao.NewPage(v, "created_at")
+	if err == nil {
+		err = dao.ListFilter(v, query, dao.FilterDate)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
+
+	messages, info, err := s.dao.PageTradeMessages(query, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
+		return
+	}
 	if err != nil {
 		log.Printf("err_q_trade_messages: %v", err)
 		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving trade chat")
@@ -502,39 +680,83 @@ func (s *Service) GetTradeMessages(w http.ResponseWriter, r *http.Request) {
 		Status: "success",
 		Code:   http.StatusOK,
 		Data:   messages,
+		Page:   &info,
 	})
 }
 
-// AutoCancellationJob pools the orders collection and auto cancel orders not
-// processed within set timeframe
-func (s *Service) AutoCancellationJob() {
-	log.Println("starting order auto cancellation job")
-	now := time.Now().UTC()
-	interval := now.Add(time.Minute * -10)
-
-	for {
-		log.Println("Checking for idle trades...")
+// ExpireTrades expires opened trades whose payment window has run out, paid
+// trades are left to EscalateUnreleasedTrades
+func (s *Service) ExpireTrades(now time.Time) error {
+	trades, err := s.dao.PoolTradesByTime(now, "pay_by", models.TradeOpened)
+	if err != nil {
+		return err
+	}
 
-		trades, err := s.dao.PoolTradesByTime(interval, "lock_time", models.TradeInProgress)
+	var failed int
+	for _, trade := range trades {
+		log.Printf("expiring trade #%s", trade.ID.Hex())
+		ok, err := s.cancelTrade(&trade, models.TradeActionExpire, models.TradeActorSystem, "", "not paid in time")
 		if err != nil {
-			log.Printf("error pooling orders: %v", err)
-			return
+			log.Printf("failed to expire trade %s: %v", trade.ID.Hex(), err)
+			failed++
+			continue
+		}
+		if ok {
+			go s.notifyExpired(trade)
 		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d trades failed to expire", failed, len(trades))
+	}
+	return nil
+}
+
+// SettleTrades queues the escrow transfers of trades that were closed but
+// not settled, a request that failed or stopped after claiming a trade is
+// finished here
+func (s *Service) SettleTrades(now time.Time) error {
+	trades, err := s.dao.QueryTrades(bson.M{
+		"settling":   true,
+		"updated_at": bson.M{"$lte": now.Add(-tradeSettlementGrace)},
+	})
+	if err != nil {
+		return err
+	}
 
-		for _, trade := range trades {
-			log.Printf("auto cancelling Order #%s", trade.ID.Hex())
-			// switch status to cancelled
-			trade.Status = models.TradeCancelled
-			trade.CancelReason = models.AutoCancellation
-			trade.UpdatedAt = time.Now().UTC()
-
-			// update order
-			if err := s.dao.UpdateTrade(trade); err != nil {
-				log.Printf("failed to update trade cancellation status: %v", err)
-				return
-			}
+	var failed int
+	for _, trade := range trades {
+		log.Printf("settling trade #%s", trade.ID.Hex())
+		if err := s.settleTrade(trade); err != nil {
+			log.Printf("failed to settle trade %s: %v", trade.ID.Hex(), err)
+			failed++
 		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d trades failed to settle", failed, len(trades))
+	}
+	return nil
+}
 
-		time.Sleep(time.Minute * 1)
+// EscalateUnreleasedTrades disputes paid trades the seller hasn't released
+// within the release window, putting them in the support arbitration queue
+func (s *Service) EscalateUnreleasedTrades(now time.Time) error {
+	trades, err := s.dao.PoolTradesByTime(now, "release_by", models.TradePaid)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, trade := range trades {
+		log.Printf("escalating unreleased trade #%s", trade.ID.Hex())
+		reason := fmt.Sprintf("Seller did not release the trade within %s of it being marked paid", sellerReleaseWindow())
+		_, err := s.openDispute(&trade, models.TradeActorSystem, "", reason, "")
+		if err != nil && err != errTradeChanged {
+			log.Printf("failed to escalate trade %s: %v", trade.ID.Hex(), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d trades failed to escalate", failed, len(trades))
 	}
+	return nil
 }
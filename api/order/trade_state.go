@@ -0,0 +1,159 @@
+package order
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errTradeChanged is returned when a trade was moved by another request
+// while it was being moved
+var errTradeChanged = errors.New("trade was updated concurrently")
+
+// tradeActor returns the side userID takes on trade, it is empty for users
+// not part of the trade
+func tradeActor(trade models.BuyTrade, userID string) models.TradeActor {
+	switch userID {
+	case trade.BuyerID.Hex():
+		return models.TradeActorBuyer
+	case trade.SellerID.Hex():
+		return models.TradeActorSeller
+	}
+	return ""
+}
+
+// transition moves trade with action when the state machine allows actor to,
+// the move is saved only if the trade wasn't moved concurrently and is then
+// recorded on the trade's timeline and sent to the trade's chat sockets,
+// closing a trade refreshes its parties'
+// reputations
+// It reports whether the trade was moved, trade holds its new state
+func (s *Service) transition(trade *models.BuyTrade, action models.TradeAction, actor models.TradeActor, actorID, note string) (bool, error) {
+	to, err := models.NextTradeStatus(trade.Status, action, actor)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	from := trade.Status
+	next := *trade
+	next.Status = to
+	next.UpdatedAt = now
+
+	// only what the move changes is saved
+	set := bson.M{
+		"status":     next.Status,
+		"updated_at": next.UpdatedAt,
+	}
+	closed := true
+	switch to {
+	case models.TradePaid:
+		next.PaidAt = now
+		next.ReleaseBy = now.Add(sellerReleaseWindow())
+		set["paid_at"] = next.PaidAt
+		set["release_by"] = next.ReleaseBy
+		closed = false
+	case models.TradeDisputed:
+		closed = false
+	case models.TradeReleased:
+		// the release is queued once the trade is claimed, until then
+		// SettleTrades picks it up
+		next.ProcessedAt = now
+		next.Settling = true
+		set["processed_at"] = next.ProcessedAt
+		set["settling"] = next.Settling
+	case models.TradeCancelled:
+		next.CancelReason = models.ManualCancellation
+		set["cancel_reason"] = next.CancelReason
+		if from == models.TradeDisputed {
+			// a dispute ruled for the seller reverses the trade's escrow
+			next.Settling = true
+			set["settling"] = next.Settling
+		}
+	case models.TradeExpired:
+		next.CancelReason = models.AutoCancellation
+		set["cancel_reason"] = next.CancelReason
+	}
+
+	ok, err := s.dao.TransitionTrade(trade.ID, from, set)
+	if err != nil || !ok {
+		return false, err
+	}
+	*trade = next
+
+	s.recordTradeEvent(*trade, action, from, actor, actorID, note)
+	s.hub.Broadcast(trade.ID.Hex(), models.ChatEvent{
+		Type:    models.ChatEventStatus,
+		TradeID: trade.ID.Hex(),
+		UserID:  actorID,
+		Status:  trade.Status,
+		Action:  action,
+	}, nil)
+	if closed {
+		// closed trades count towards both parties' completion rates
+		go s.refreshReputation(trade.BuyerID, trade.SellerID)
+	}
+	return true, nil
+}
+
+// recordTradeEvent adds a move to a trade's timeline, the move has already
+// happened so failing to record it is only logged
+func (s *Service) recordTradeEvent(trade models.BuyTrade, action models.TradeAction, from string, actor models.TradeActor, actorID, note string) {
+	aid, _ := primitive.ObjectIDFromHex(actorID)
+	err := s.dao.InsertTradeEvent(models.TradeEvent{
+		ID:        primitive.NewObjectID(),
+		TradeID:   trade.ID,
+		OrderID:   trade.OrderID,
+		Action:    action,
+		From:      from,
+		To:        trade.Status,
+		Actor:     actor,
+		ActorID:   aid,
+		Note:      note,
+		CreatedAt: trade.UpdatedAt,
+	})
+	if err != nil {
+		log.Printf("trade_events: failed to record %s on trade %s: %v", action, trade.ID.Hex(), err)
+	}
+}
+
+// GetTradeTimeline returns every move a trade made between states, oldest
+// first, to its buyer and seller
+func (s *Service) GetTradeTimeline(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	trade, err := s.dao.FindTradeByID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Trade not found")
+		return
+	}
+
+	actor := tradeActor(trade, userID.(string))
+	if actor == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Trade not available to user")
+		return
+	}
+
+	events, err := s.dao.QueryTradeEvents(trade.ID)
+	if err != nil {
+		log.Printf("trade_timeline: failed to retrieve events: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving trade timeline")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: models.TradeTimeline{
+			Trade:   trade,
+			Events:  events,
+			Actions: models.AllowedTradeActions(trade.Status, actor),
+		},
+	})
+}
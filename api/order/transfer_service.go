@@ -0,0 +1,45 @@
+package order
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils"
+	"log"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetTransfers returns the escrow transfers made for an authenticated user,
+// deposits and reversals of their orders and releases of their trades, with
+// the chain tx id of each
+func (s *Service) GetTransfers(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(models.ContextKey("user_id"))
+	uid, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "No transfers found")
+		return
+	}
+
+	query := bson.M{"user_id": uid}
+	v := r.URL.Query()
+	if orderID, err := primitive.ObjectIDFromHex(v.Get("order_id")); err == nil {
+		query["order_id"] = orderID
+	}
+	if tradeID, err := primitive.ObjectIDFromHex(v.Get("trade_id")); err == nil {
+		query["trade_id"] = tradeID
+	}
+
+	transfers, err := s.escrow.Transfers(query)
+	if err != nil {
+		log.Printf("user_transfers: failed to retrieve transfers: %v", err)
+		utils.RespondWithError(w, http.StatusNotFound, "No transfers found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   transfers,
+	})
+}
@@ -477,58 +477,32 @@ func (s *Service) Notifications(w http.ResponseWriter, r *http.Request) {
 		"user_id": id,
 	}
 
-	notifications, err := s.factoryDAO.QueryNotifications(filter)
-	if err != nil {
-		log.Printf("failed to retrieve user notifications: %v", err)
-		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving notifications")
-		return
+	v := r.URL.Query()
+	page, err := dao.NewPage(v, "created_at")
+	if err == nil {
+		err = dao.ListFilter(v, filter, dao.FilterDate)
 	}
-
-	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
-		Status: "success",
-		Code:   http.StatusOK,
-		Data:   notifications,
-	})
-}
-
-// RateUser ...
-func (s *Service) RateUser(w http.ResponseWriter, r *http.Request) {
-	var req models.RateUserReq
-	err := utils.DecodeReq(r, &req)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
 		return
 	}
 
-	userID := r.Context().Value(models.ContextKey("user_id"))
-
-	user, err := s.dao.FindByID(userID.(string))
-	if err != nil {
-		log.Printf("failed to retreive user: %v", err)
-		utils.RespondWithError(w, http.StatusNotFound, "User account not found")
-		return
-	}
-
-	switch req.Type {
-	case models.PositiveRating:
-		user.PositiveRatings++
-	case models.NegativeRating:
-		user.NegativeRatings++
-	default:
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid rating type")
+	notifications, info, err := s.factoryDAO.PageNotifications(filter, page)
+	if err == dao.ErrInvalidPage {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid page request")
 		return
 	}
-
-	if err := s.dao.Update(user); err != nil {
-		log.Printf("failed to update user: %v", err)
-		utils.RespondWithError(w, http.StatusBadRequest, "Cannot update user rating at this time")
+	if err != nil {
+		log.Printf("failed to retrieve user notifications: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Error retrieving notifications")
 		return
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, utils.Response{
-		Status:  "success",
-		Code:    http.StatusOK,
-		Message: "User ratings updated successfully",
+		Status: "success",
+		Code:   http.StatusOK,
+		Data:   notifications,
+		Page:   &info,
 	})
 }
 
@@ -0,0 +1,135 @@
+package dao
+
+import (
+	"vhennpay-bend/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InsertBuyOrder ...
+func (dao *OrderDAO) InsertBuyOrder(order models.BuyOrder) error {
+	collection := dao.db.Collection("buy_orders")
+	_, err := collection.InsertOne(dao.ctx, order)
+	return err
+}
+
+// FindBuyOrderByID retrieves a buy order by its id
+func (dao *OrderDAO) FindBuyOrderByID(id string) (models.BuyOrder, error) {
+	var order models.BuyOrder
+
+	collection := dao.db.Collection("buy_orders")
+	docID, _ := primitive.ObjectIDFromHex(id)
+	err := collection.FindOne(dao.ctx, bson.M{"_id": docID}).Decode(&order)
+	return order, err
+}
+
+// PageBuyOrders retrieves a page of the buy orders matching filter
+func (dao *OrderDAO) PageBuyOrders(filter bson.M, page Page) ([]models.BuyOrder, models.PageInfo, error) {
+	var orders []models.BuyOrder
+	info, err := paginate(dao.ctx, dao.db.Collection("buy_orders"), page, &orders, []bson.M{amountAvailable, {"$match": filter}})
+	return orders, info, err
+}
+
+// buyerLookup joins buy orders with their buyer
+var buyerLookup = []bson.M{
+	{"$lookup": bson.M{
+		"from":         "user",
+		"localField":   "created_by",
+		"foreignField": "_id",
+		"as":           "user_data",
+	}},
+	{"$unwind": "$user_data"},
+	{"$project": bson.M{
+		"user_data.password":  0,
+		"user_data.confirmed": 0,
+		"user_data.fcm_token": 0,
+		"user_data.passcode":  0,
+		"user_data.admin":     0,
+	}},
+}
+
+// PipelineBuyOrders retrieves a page of the buy orders matching query joined
+// with their buyer, query may filter on amount_available
+func (dao *OrderDAO) PipelineBuyOrders(query bson.M, page Page) ([]models.BuyOrderView, models.PageInfo, error) {
+	var orders []models.BuyOrderView
+	info, err := paginate(dao.ctx, dao.db.Collection("buy_orders"), page, &orders,
+		[]bson.M{amountAvailable, {"$match": query}}, buyerLookup...)
+	return orders, info, err
+}
+
+// PipelineBuyOrder retrieves a buy order joined with its buyer
+func (dao *OrderDAO) PipelineBuyOrder(id string) (models.BuyOrderView, error) {
+	var orders []models.BuyOrderView
+
+	docID, _ := primitive.ObjectIDFromHex(id)
+	pipeline := append([]bson.M{amountAvailable, {"$match": bson.M{"_id": docID}}}, buyerLookup...)
+	cursor, err := dao.db.Collection("buy_orders").Aggregate(dao.ctx, pipeline)
+	if err != nil {
+		return models.BuyOrderView{}, err
+	}
+	if err := cursor.All(dao.ctx, &orders); err != nil {
+		return models.BuyOrderView{}, err
+	}
+	if len(orders) < 1 {
+		return models.BuyOrderView{}, mongo.ErrNoDocuments
+	}
+	return orders[0], nil
+}
+
+// ReserveBuyOrder sets amount of a pending buy order aside for a fill, only
+// if that much is still wanted, reporting whether the reservation was made
+func (dao *OrderDAO) ReserveBuyOrder(id primitive.ObjectID, amount models.Money) (bool, error) {
+	collection := dao.db.Collection("buy_orders")
+	res, err := collection.UpdateOne(dao.ctx, bson.M{
+		"_id":    id,
+		"status": models.OrderPending,
+		"$expr": bson.M{
+			"$gte": bson.A{
+				bson.M{"$subtract": bson.A{"$amount_left", "$amount_reserved"}},
+				amount,
+			},
+		},
+	}, bson.M{
+		"$inc": bson.M{"amount_reserved": amount},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// SettleBuyOrder takes a finished fill's reservation off a buy order, filled
+// is the part of it that was sold to the buyer
+func (dao *OrderDAO) SettleBuyOrder(id primitive.ObjectID, reserved, filled models.Money) error {
+	collection := dao.db.Collection("buy_orders")
+	_, err := collection.UpdateOne(dao.ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{
+			"amount_reserved": reserved.Neg(),
+			"amount_filled":   filled,
+			"amount_left":     filled.Neg(),
+		},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// UpdateBuyOrderStatus moves a buy order to status `to` only if it is still
+// in `from`, reporting whether the update happened
+func (dao *OrderDAO) UpdateBuyOrderStatus(id primitive.ObjectID, from, to string) (bool, error) {
+	collection := dao.db.Collection("buy_orders")
+	res, err := collection.UpdateOne(dao.ctx, bson.M{
+		"_id":    id,
+		"status": from,
+	}, bson.M{"$set": bson.M{
+		"status":     to,
+		"updated_at": time.Now().UTC(),
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
@@ -38,3 +38,18 @@ func Initialize(dbURI, user, serverPass, dbname string) (*mongo.Client, context.
 
 	return client, ctx, nil
 }
+
+// IsDuplicateKey reports whether err is a unique index violation
+func IsDuplicateKey(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == 11000 {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == 11000
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package dao
+
+import (
+	"vhennpay-bend/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InsertDispute ...
+func (dao *OrderDAO) InsertDispute(dispute models.Dispute) error {
+	collection := dao.db.Collection("disputes")
+	_, err := collection.InsertOne(dao.ctx, dispute)
+	return err
+}
+
+// RemoveDispute deletes a dispute that never got its trade disputed
+func (dao *OrderDAO) RemoveDispute(id primitive.ObjectID) error {
+	collection := dao.db.Collection("disputes")
+	_, err := collection.DeleteOne(dao.ctx, bson.M{"_id": id})
+	return err
+}
+
+// FindDisputeByID retrieves a dispute by its id
+func (dao *OrderDAO) FindDisputeByID(id string) (models.Dispute, error) {
+	var dispute models.Dispute
+
+	collection := dao.db.Collection("disputes")
+	docID, _ := primitive.ObjectIDFromHex(id)
+	err := collection.FindOne(dao.ctx, bson.M{"_id": docID}).Decode(&dispute)
+	return dispute, err
+}
+
+// FindTradeDispute retrieves the latest dispute opened on a trade
+func (dao *OrderDAO) FindTradeDispute(tradeID primitive.ObjectID) (models.Dispute, error) {
+	var dispute models.Dispute
+
+	collection := dao.db.Collection("disputes")
+	opts := options.FindOne()
+	opts.SetSort(bson.M{"created_at": -1})
+	err := collection.FindOne(dao.ctx, bson.M{"trade_id": tradeID}, opts).Decode(&dispute)
+	return dispute, err
+}
+
+// QueryDisputes returns the disputes matching filter, oldest first so the
+// arbitration queue is worked in order
+func (dao *OrderDAO) QueryDisputes(filter bson.M) ([]models.Dispute, error) {
+	var disputes []models.Dispute
+
+	collection := dao.db.Collection("disputes")
+	opts := options.Find()
+	opts.SetSort(bson.M{"created_at": 1})
+
+	cursor, err := collection.Find(dao.ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &disputes)
+
+	return disputes, err
+}
+
+// ResolveDispute records the ruling of an open dispute, reporting whether
+// it was still open
+func (dao *OrderDAO) ResolveDispute(dispute models.Dispute) (bool, error) {
+	collection := dao.db.Collection("disputes")
+	now := time.Now().UTC()
+	res, err := collection.UpdateOne(dao.ctx, bson.M{
+		"_id":    dispute.ID,
+		"status": models.DisputeOpen,
+	}, bson.M{"$set": bson.M{
+		"status":      models.DisputeResolved,
+		"ruling":      dispute.Ruling,
+		"ruling_note": dispute.RulingNote,
+		"resolved_by": dispute.ResolvedBy,
+		"resolved_at": now,
+		"updated_at":  now,
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// InsertDisputeEvidence ...
+func (dao *OrderDAO) InsertDisputeEvidence(evidence models.DisputeEvidence) error {
+	collection := dao.db.Collection("dispute_evidence")
+	_, err := collection.InsertOne(dao.ctx, evidence)
+	return err
+}
+
+// QueryDisputeEvidence returns a dispute's evidence, oldest first
+func (dao *OrderDAO) QueryDisputeEvidence(id primitive.ObjectID) ([]models.DisputeEvidence, error) {
+	var evidence []models.DisputeEvidence
+
+	collection := dao.db.Collection("dispute_evidence")
+	opts := options.Find()
+	opts.SetSort(bson.M{"created_at": 1})
+
+	cursor, err := collection.Find(dao.ctx, bson.M{"dispute_id": id}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &evidence)
+
+	return evidence, err
+}
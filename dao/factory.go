@@ -32,6 +32,8 @@ func NewFactoryDAO(ctx context.Context, db *mongo.Database) *FactoryDAO {
 		"paypal_payment_option",
 		"escrow_deposits",
 		"user_wallet",
+		"reconciliations",
+		"alerts",
 	}
 	dao := &FactoryDAO{
 		ctx:         context.TODO(),
@@ -109,6 +111,25 @@ func (dao *FactoryDAO) Query(ckey string, filter bson.M, sort ...bool) (interfac
 	return data, err
 }
 
+// QueryInto applies filter on a collection and decodes the results into out,
+// a pointer to a slice of typed documents
+func (dao *FactoryDAO) QueryInto(ckey string, filter bson.M, out interface{}) error {
+	collection, ok := dao.Collections[ckey]
+	if !ok {
+		return errors.New("Invalid collection")
+	}
+
+	opts := options.Find()
+	opts.SetSort(bson.M{"created_at": -1})
+
+	cursor, err := collection.Find(dao.ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(dao.ctx, out)
+}
+
 // Remove ...
 func (dao *FactoryDAO) Remove(ckey string, filter bson.M) error {
 	collection, ok := dao.Collections[ckey]
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"vhennpay-bend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FeeDAO represents the fee rules DAO
+type FeeDAO struct {
+	ctx        context.Context
+	db         *mongo.Database
+	Collection *mongo.Collection
+}
+
+// NewFeeDAO returns a new FeeDAO
+func NewFeeDAO(ctx context.Context, db *mongo.Database) *FeeDAO {
+	return &FeeDAO{
+		ctx:        context.TODO(),
+		db:         db,
+		Collection: db.Collection("fee_rules"),
+	}
+}
+
+// Insert a fee rule into database
+func (dao *FeeDAO) Insert(rule models.FeeRule) error {
+	obj, _ := bson.Marshal(rule)
+	_, err := dao.Collection.InsertOne(dao.ctx, obj)
+	return err
+}
+
+// FindByID retrieves a fee rule by its id
+func (dao *FeeDAO) FindByID(id string) (models.FeeRule, error) {
+	var rule models.FeeRule
+	docID, _ := primitive.ObjectIDFromHex(id)
+	err := dao.Collection.FindOne(dao.ctx, bson.M{"_id": docID}).Decode(&rule)
+	return rule, err
+}
+
+// Update an existing fee rule
+func (dao *FeeDAO) Update(rule models.FeeRule) error {
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": rule.ID}, bson.M{"$set": rule})
+	return err
+}
+
+// Remove a fee rule
+func (dao *FeeDAO) Remove(id primitive.ObjectID) error {
+	_, err := dao.Collection.DeleteOne(dao.ctx, bson.M{"_id": id})
+	return err
+}
+
+// Query takes a bson.M filters map and applies the query on the fee rules
+// collection, most recently updated first
+func (dao *FeeDAO) Query(filter bson.M) ([]models.FeeRule, error) {
+	var rules []models.FeeRule
+
+	opts := options.Find()
+	opts.SetSort(bson.M{"updated_at": -1})
+
+	cursor, err := dao.Collection.Find(dao.ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &rules)
+
+	return rules, err
+}
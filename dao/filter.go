@@ -0,0 +1,121 @@
+package dao
+
+import (
+	"vhennpay-bend/models"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// List filters, read from the query parameters named after them
+const (
+	// FilterCurrency matches currency regardless of case
+	FilterCurrency = "currency"
+	// FilterRate bounds ex_rate by min_rate and max_rate
+	FilterRate = "rate"
+	// FilterPaymentOption matches payment_option
+	FilterPaymentOption = "payment_option"
+	// FilterDate bounds created_at by from and to, given as RFC 3339 times
+	// or dates, a to date includes the whole day
+	FilterDate = "date"
+)
+
+// ListFilter reads filters from v into query, parameters that are missing
+// or empty are ignored and any that can't be read are an ErrInvalidPage
+func ListFilter(v url.Values, query bson.M, filters ...string) error {
+	for _, filter := range filters {
+		switch filter {
+		case FilterCurrency:
+			if c := v.Get("currency"); c != "" && c != "any" {
+				query["currency"] = bson.M{"$regex": "^" + regexp.QuoteMeta(c) + "$", "$options": "i"}
+			}
+		case FilterRate:
+			rate, err := moneyRange(v.Get("min_rate"), v.Get("max_rate"))
+			if err != nil {
+				return err
+			}
+			if len(rate) > 0 {
+				query["ex_rate"] = rate
+			}
+		case FilterPaymentOption:
+			if o := v.Get("payment_option"); o != "" {
+				option, err := strconv.ParseInt(o, 10, 32)
+				if err != nil {
+					return ErrInvalidPage
+				}
+				query["payment_option"] = int32(option)
+			}
+		case FilterDate:
+			created := bson.M{}
+			if s := v.Get("from"); s != "" {
+				from, _, err := parseTime(s)
+				if err != nil {
+					return ErrInvalidPage
+				}
+				created["$gte"] = from
+			}
+			if s := v.Get("to"); s != "" {
+				to, day, err := parseTime(s)
+				if err != nil {
+					return ErrInvalidPage
+				}
+				// a date runs to the end of that day
+				if day {
+					to = to.Add(24 * time.Hour)
+				}
+				created["$lt"] = to
+			}
+			if len(created) > 0 {
+				query["created_at"] = created
+			}
+		}
+	}
+	return nil
+}
+
+// ReputationFilter reads the min_score and min_completion_rate parameters of
+// v into query as bounds on the reputation at prefix
+func ReputationFilter(v url.Values, prefix string, query bson.M) error {
+	for param, field := range map[string]string{
+		"min_score":           "average_score",
+		"min_completion_rate": "completion_rate",
+	} {
+		if s := v.Get(param); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return ErrInvalidPage
+			}
+			query[prefix+".reputation."+field] = bson.M{"$gte": f}
+		}
+	}
+	return nil
+}
+
+func moneyRange(min, max string) (bson.M, error) {
+	r := bson.M{}
+	bounds := []struct{ value, op string }{{min, "$gte"}, {max, "$lte"}}
+	for _, b := range bounds {
+		if b.value == "" {
+			continue
+		}
+		m, err := models.ParseMoney(b.value)
+		if err != nil {
+			return nil, ErrInvalidPage
+		}
+		r[b.op] = m
+	}
+	return r, nil
+}
+
+// parseTime reads an RFC 3339 time or a date, reporting whether it was a
+// date
+func parseTime(s string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	return t, true, err
+}
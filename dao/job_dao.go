@@ -0,0 +1,142 @@
+package dao
+
+import (
+	"context"
+	"vhennpay-bend/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JobDAO represents the scheduled jobs DAO
+type JobDAO struct {
+	ctx        context.Context
+	db         *mongo.Database
+	Collection *mongo.Collection
+}
+
+// NewJobDAO returns a new JobDAO
+func NewJobDAO(ctx context.Context, db *mongo.Database) *JobDAO {
+	return &JobDAO{
+		ctx:        context.TODO(),
+		db:         db,
+		Collection: db.Collection("jobs"),
+	}
+}
+
+// Ensure records a job if it doesn't exist yet, an existing job keeps its
+// schedule and metrics but takes the new interval
+func (dao *JobDAO) Ensure(name string, interval time.Duration) error {
+	now := time.Now().UTC()
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": name}, bson.M{
+		"$set": bson.M{
+			"interval_seconds": int64(interval / time.Second),
+			"updated_at":       now,
+		},
+		"$setOnInsert": bson.M{
+			"next_run_at": now,
+			"created_at":  now,
+		},
+	}, options.Update().SetUpsert(true))
+	if IsDuplicateKey(err) {
+		// another instance recorded it first
+		return nil
+	}
+	return err
+}
+
+// Acquire takes the lease on a due job for owner until `until`, a job that
+// isn't due or is leased by another live owner returns mongo.ErrNoDocuments
+func (dao *JobDAO) Acquire(name, owner string, now, until time.Time) (models.Job, error) {
+	var job models.Job
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := dao.Collection.FindOneAndUpdate(dao.ctx, bson.M{
+		"_id":         name,
+		"next_run_at": bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"lease_until": bson.M{"$lt": now}},
+			bson.M{"lease_until": bson.M{"$exists": false}},
+			bson.M{"lease_owner": owner},
+		},
+	}, bson.M{"$set": bson.M{
+		"lease_owner": owner,
+		"lease_until": until,
+		"updated_at":  now,
+	}}, opts).Decode(&job)
+
+	return job, err
+}
+
+// Renew extends the lease owner holds on a job to `until`, reporting
+// whether owner still held it
+func (dao *JobDAO) Renew(name, owner string, until time.Time) (bool, error) {
+	res, err := dao.Collection.UpdateOne(dao.ctx, bson.M{
+		"_id":         name,
+		"lease_owner": owner,
+	}, bson.M{"$set": bson.M{
+		"lease_until": until,
+		"updated_at":  time.Now().UTC(),
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// Complete records a run of a job leased by owner and gives up the lease
+func (dao *JobDAO) Complete(name, owner string, run models.JobRun) error {
+	now := time.Now().UTC()
+	ms := int64(run.Duration / time.Millisecond)
+
+	set := bson.M{
+		"lease_owner":      "",
+		"lease_until":      time.Time{},
+		"next_run_at":      run.NextRunAt,
+		"last_run_at":      run.StartedAt,
+		"last_duration_ms": ms,
+		"updated_at":       now,
+	}
+	inc := bson.M{"runs": 1, "total_duration_ms": ms}
+	if run.Err != nil {
+		set["last_error"] = run.Err.Error()
+		inc["failures"] = 1
+		inc["consecutive_failures"] = 1
+	} else {
+		set["last_error"] = ""
+		set["last_success_at"] = now
+		set["consecutive_failures"] = 0
+	}
+
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{
+		"_id":         name,
+		"lease_owner": owner,
+	}, bson.M{"$set": set, "$inc": inc})
+	return err
+}
+
+// FindByName retrieves a job by its name
+func (dao *JobDAO) FindByName(name string) (models.Job, error) {
+	var job models.Job
+	err := dao.Collection.FindOne(dao.ctx, bson.M{"_id": name}).Decode(&job)
+	return job, err
+}
+
+// FindAll returns every scheduled job
+func (dao *JobDAO) FindAll() ([]models.Job, error) {
+	var jobs []models.Job
+
+	opts := options.Find()
+	opts.SetSort(bson.M{"_id": 1})
+
+	cursor, err := dao.Collection.Find(dao.ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &jobs)
+
+	return jobs, err
+}
@@ -0,0 +1,151 @@
+package dao
+
+import (
+	"context"
+	"vhennpay-bend/models"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LedgerDAO represents the escrow ledger DAO, journal entries are only ever
+// inserted, never updated or removed
+type LedgerDAO struct {
+	ctx        context.Context
+	db         *mongo.Database
+	Collection *mongo.Collection
+}
+
+// NewLedgerDAO returns a new LedgerDAO
+func NewLedgerDAO(ctx context.Context, db *mongo.Database) *LedgerDAO {
+	dao := &LedgerDAO{
+		ctx:        context.TODO(),
+		db:         db,
+		Collection: db.Collection("journal_entries"),
+	}
+
+	_, err := dao.Collection.Indexes().CreateOne(dao.ctx, mongo.IndexModel{
+		Keys:    bson.M{"reference": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("journal_entries: failed to create reference index: %v", err)
+	}
+
+	return dao
+}
+
+// Insert a journal entry into database, an entry with the same reference
+// already existing results in a duplicate key error
+func (dao *LedgerDAO) Insert(entry models.JournalEntry) error {
+	obj, _ := bson.Marshal(entry)
+	_, err := dao.Collection.InsertOne(dao.ctx, obj)
+	return err
+}
+
+// FindByReference retrieves a journal entry by its reference
+func (dao *LedgerDAO) FindByReference(reference string) (models.JournalEntry, error) {
+	var entry models.JournalEntry
+	err := dao.Collection.FindOne(dao.ctx, bson.M{"reference": reference}).Decode(&entry)
+	return entry, err
+}
+
+// Entries returns journal entries matching filter, newest first
+func (dao *LedgerDAO) Entries(filter bson.M) ([]models.JournalEntry, error) {
+	var entries []models.JournalEntry
+
+	opts := options.Find()
+	opts.SetSort(bson.M{"created_at": -1})
+
+	cursor, err := dao.Collection.Find(dao.ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &entries)
+
+	return entries, err
+}
+
+// Balances sums debits and credits per account for postings matching filter
+func (dao *LedgerDAO) Balances(filter bson.M) ([]models.AccountBalance, error) {
+	var balances []models.AccountBalance
+
+	unwind := bson.M{
+		"$unwind": "$postings",
+	}
+	matches := bson.M{
+		"$match": filter,
+	}
+	group := bson.M{
+		"$group": bson.M{
+			"_id":          "$postings.account",
+			"account_type": bson.M{"$first": "$postings.account_type"},
+			"debits":       bson.M{"$sum": "$postings.debit"},
+			"credits":      bson.M{"$sum": "$postings.credit"},
+			"entries":      bson.M{"$sum": 1},
+		},
+	}
+	sort := bson.M{
+		"$sort": bson.M{"_id": 1},
+	}
+
+	pipeline := []bson.M{unwind, matches, group, sort}
+	cursor, err := dao.Collection.Aggregate(dao.ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &balances)
+
+	return balances, err
+}
+
+// PeriodTotals sums the postings made against account per period between
+// from and to, format is a $dateToString format naming the period
+// Only entries of the given kinds are summed when any are given
+func (dao *LedgerDAO) PeriodTotals(account string, from, to time.Time, format string, kinds ...models.JournalEntryKind) ([]models.AccountBalance, error) {
+	var totals []models.AccountBalance
+
+	filter := bson.M{
+		"postings.account": account,
+		"created_at":       bson.M{"$gte": from, "$lt": to},
+	}
+	if len(kinds) > 0 {
+		filter["kind"] = bson.M{"$in": kinds}
+	}
+	matches := bson.M{
+		"$match": filter,
+	}
+	unwind := bson.M{
+		"$unwind": "$postings",
+	}
+	postings := bson.M{
+		"$match": bson.M{"postings.account": account},
+	}
+	group := bson.M{
+		"$group": bson.M{
+			"_id":          bson.M{"$dateToString": bson.M{"format": format, "date": "$created_at"}},
+			"account_type": bson.M{"$first": "$postings.account_type"},
+			"debits":       bson.M{"$sum": "$postings.debit"},
+			"credits":      bson.M{"$sum": "$postings.credit"},
+			"entries":      bson.M{"$sum": 1},
+		},
+	}
+	sort := bson.M{
+		"$sort": bson.M{"_id": 1},
+	}
+
+	pipeline := []bson.M{matches, unwind, postings, group, sort}
+	cursor, err := dao.Collection.Aggregate(dao.ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &totals)
+
+	return totals, err
+}
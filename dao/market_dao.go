@@ -0,0 +1,152 @@
+package dao
+
+import (
+	"vhennpay-bend/models"
+	"regexp"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// marketLevel is a price level of one currency's book
+type marketLevel struct {
+	models.PriceLevel `bson:",inline"`
+	Currency          string `bson:"currency"`
+}
+
+// OrderBooks builds the order book of every currency with listed orders or
+// released trades since since, or only of currency when it isn't empty
+// Currencies are matched regardless of case and books are sorted by currency
+func (dao *OrderDAO) OrderBooks(currency string, since time.Time) ([]models.OrderBook, error) {
+	filter := func(field string) bson.M {
+		if currency == "" {
+			return bson.M{}
+		}
+		return bson.M{field: bson.M{"$regex": "^" + regexp.QuoteMeta(currency) + "$", "$options": "i"}}
+	}
+
+	var asks []marketLevel
+	err := dao.aggregate("orders", &asks, priceLevels(
+		bson.M{"$and": bson.A{filter("currency"), bson.M{
+			"status":       models.OrderPending,
+			"buy_order_id": bson.M{"$exists": false},
+		}}}, 1)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var bids []marketLevel
+	err = dao.aggregate("buy_orders", &bids, priceLevels(
+		bson.M{"$and": bson.A{filter("currency"), bson.M{"status": models.OrderPending}}}, -1)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// trades opened before their rate was kept are priced at their order's
+	// exchange rate
+	var volumes []models.MarketVolume
+	err = dao.aggregate("buy_trade", &volumes,
+		bson.M{"$match": bson.M{"status": models.TradeReleased, "processed_at": bson.M{"$gte": since}}},
+		bson.M{"$lookup": bson.M{
+			"from":         "orders",
+			"localField":   "order_id",
+			"foreignField": "_id",
+			"as":           "order",
+		}},
+		bson.M{"$unwind": "$order"},
+		bson.M{"$match": filter("order.currency")},
+		bson.M{"$sort": bson.M{"processed_at": 1}},
+		bson.M{"$addFields": bson.M{"ex_rate": bson.M{"$ifNull": bson.A{"$ex_rate", "$order.ex_rate"}}}},
+		bson.M{"$group": bson.M{
+			"_id":       bson.M{"$toUpper": "$order.currency"},
+			"amount":    bson.M{"$sum": "$amount"},
+			"value":     bson.M{"$sum": bson.M{"$multiply": bson.A{"$amount", "$ex_rate"}}},
+			"trades":    bson.M{"$sum": 1},
+			"last_rate": bson.M{"$last": "$ex_rate"},
+		}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	books := make(map[string]*models.OrderBook)
+	book := func(currency string) *models.OrderBook {
+		b, ok := books[currency]
+		if !ok {
+			b = &models.OrderBook{
+				Currency:  currency,
+				Asks:      []models.PriceLevel{},
+				Bids:      []models.PriceLevel{},
+				Volume:    models.MarketVolume{Currency: currency},
+				UpdatedAt: now,
+			}
+			books[currency] = b
+		}
+		return b
+	}
+	for _, l := range asks {
+		b := book(l.Currency)
+		b.Asks = append(b.Asks, l.PriceLevel)
+		b.AskDepth = b.AskDepth.Add(l.Amount)
+	}
+	for _, l := range bids {
+		b := book(l.Currency)
+		b.Bids = append(b.Bids, l.PriceLevel)
+		b.BidDepth = b.BidDepth.Add(l.Amount)
+	}
+	for _, v := range volumes {
+		book(v.Currency).Volume = v
+	}
+
+	result := make([]models.OrderBook, 0, len(books))
+	for _, b := range books {
+		if len(b.Asks) > 0 {
+			b.BestAsk = b.Asks[0].ExRate
+		}
+		if len(b.Bids) > 0 {
+			b.BestBid = b.Bids[0].ExRate
+		}
+		if len(b.Asks) > 0 && len(b.Bids) > 0 {
+			b.Spread = b.BestAsk.Sub(b.BestBid)
+		}
+		result = append(result, *b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Currency < result[j].Currency })
+
+	return result, nil
+}
+
+// priceLevels groups the amount still available on the orders matching
+// filter by currency and exchange rate, levels are sorted by exchange rate
+// in direction
+func priceLevels(filter bson.M, direction int) []bson.M {
+	return []bson.M{
+		amountAvailable,
+		bson.M{"$match": filter},
+		bson.M{"$match": bson.M{"amount_available": bson.M{"$gt": models.Money(0)}}},
+		bson.M{"$group": bson.M{
+			"_id":    bson.M{"currency": bson.M{"$toUpper": "$currency"}, "ex_rate": "$ex_rate"},
+			"amount": bson.M{"$sum": "$amount_available"},
+			"orders": bson.M{"$sum": 1},
+		}},
+		bson.M{"$project": bson.M{
+			"_id":      0,
+			"currency": "$_id.currency",
+			"ex_rate":  "$_id.ex_rate",
+			"amount":   1,
+			"orders":   1,
+		}},
+		bson.M{"$sort": bson.D{{Key: "currency", Value: 1}, {Key: "ex_rate", Value: direction}}},
+	}
+}
+
+// aggregate runs pipeline on collection ckey decoding the results into out
+func (dao *OrderDAO) aggregate(ckey string, out interface{}, pipeline ...bson.M) error {
+	cursor, err := dao.db.Collection(ckey).Aggregate(dao.ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(dao.ctx, out)
+}
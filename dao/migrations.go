@@ -0,0 +1,457 @@
+package dao
+
+import (
+	"context"
+	"vhennpay-bend/models"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration is a one-off change to stored documents, applied migrations are
+// recorded in the migrations collection and never run again
+type migration struct {
+	ID  string
+	Run func(ctx context.Context, db *mongo.Database) error
+}
+
+var migrations = []migration{
+	{ID: "0001_money_decimal128", Run: moneyToDecimal128},
+	{ID: "0002_order_amount_reserved", Run: reserveOpenTrades},
+	{ID: "0003_transfers_confirmed", Run: confirmSettledTransfers},
+	{ID: "0004_trade_fees", Run: zeroLegacyFees},
+	{ID: "0005_trade_states", Run: migrateTradeStates},
+	{ID: "0006_payment_windows", Run: setPaymentDeadlines},
+	{ID: "0007_reputation", Run: buildReputations},
+	{ID: "0008_trade_fiat_amounts", Run: quoteLegacyTrades},
+	{ID: "0009_order_price_types", Run: fixLegacyPrices},
+	{ID: "0010_ico_fee_entries", Run: postLegacyICOFees},
+	{ID: "0011_escrow_deposit_entries", Run: postLegacyDeposits},
+}
+
+// RunMigrations applies every migration not yet recorded against db
+func RunMigrations(db *mongo.Database) error {
+	ctx := context.TODO()
+	applied := db.Collection("migrations")
+
+	for _, m := range migrations {
+		count, err := applied.CountDocuments(ctx, bson.M{"_id": m.ID})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		log.Printf("migrations: running %s", m.ID)
+		if err := m.Run(ctx, db); err != nil {
+			return fmt.Errorf("migration %s failed: %v", m.ID, err)
+		}
+
+		_, err = applied.InsertOne(ctx, bson.M{"_id": m.ID, "applied_at": time.Now().UTC()})
+		if err != nil && !IsDuplicateKey(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// numericTypes are the BSON types amounts were stored as before Money
+var numericTypes = bson.A{"double", "int", "long"}
+
+// moneyFields lists the amount fields of every collection moved to Money
+var moneyFields = map[string][]string{
+	"orders":          {"ex_rate", "amount", "amount_sold", "amount_left"},
+	"buy_trade":       {"amount"},
+	"escrow":          {"amount", "released_amount"},
+	"transfers":       {"amount"},
+	"ico_trade":       {"amount"},
+	"reconciliations": {"chain_balance", "ledger_balance", "drift", "seller_holds", "unreleased_deposits", "hold_drift"},
+}
+
+// toDecimal converts a numeric expression to a Decimal128 rounded to the
+// Money scale
+func toDecimal(expr interface{}) bson.M {
+	return bson.M{"$round": bson.A{bson.M{"$toDecimal": expr}, models.MoneyScale}}
+}
+
+// moneyToDecimal128 rewrites float and integer amounts as Decimal128
+func moneyToDecimal128(ctx context.Context, db *mongo.Database) error {
+	for collection, fields := range moneyFields {
+		for _, field := range fields {
+			_, err := db.Collection(collection).UpdateMany(ctx,
+				bson.M{field: bson.M{"$type": numericTypes}},
+				bson.A{bson.M{"$set": bson.M{field: toDecimal("$" + field)}}},
+			)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %v", collection, field, err)
+			}
+		}
+	}
+
+	// journal entry postings are converted as a whole
+	_, err := db.Collection("journal_entries").UpdateMany(ctx,
+		bson.M{"postings": bson.M{"$elemMatch": bson.M{"$or": bson.A{
+			bson.M{"debit": bson.M{"$type": numericTypes}},
+			bson.M{"credit": bson.M{"$type": numericTypes}},
+		}}}},
+		bson.A{bson.M{"$set": bson.M{"postings": bson.M{"$map": bson.M{
+			"input": "$postings",
+			"as":    "p",
+			"in": bson.M{"$mergeObjects": bson.A{"$$p", bson.M{
+				"debit":  toDecimal("$$p.debit"),
+				"credit": toDecimal("$$p.credit"),
+			}}},
+		}}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("journal_entries.postings: %v", err)
+	}
+	return nil
+}
+
+// Trade statuses replaced by the trade state machine
+const (
+	legacyTradeInProgress = "in-progress"
+	legacyTradeProcessed  = "processed"
+)
+
+// reserveOpenTrades backfills amount_reserved from the trades in progress
+func reserveOpenTrades(ctx context.Context, db *mongo.Database) error {
+	cursor, err := db.Collection("buy_trade").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"status": legacyTradeInProgress}},
+		{"$group": bson.M{"_id": "$order_id", "reserved": bson.M{"$sum": "$amount"}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var totals []struct {
+		OrderID  primitive.ObjectID `bson:"_id"`
+		Reserved models.Money       `bson:"reserved"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return err
+	}
+
+	orders := db.Collection("orders")
+	if _, err := orders.UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"amount_reserved": models.Money(0)}}); err != nil {
+		return err
+	}
+	for _, t := range totals {
+		_, err := orders.UpdateOne(ctx, bson.M{"_id": t.OrderID}, bson.M{"$set": bson.M{"amount_reserved": t.Reserved}})
+		if err != nil {
+			return fmt.Errorf("orders %s: %v", t.OrderID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// confirmSettledTransfers marks transfers settled before finality was tracked
+// as confirmed, their effects were recorded when they settled
+func confirmSettledTransfers(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("transfers").UpdateMany(ctx,
+		bson.M{"status": models.TransferSettled, "tx_id": bson.M{"$exists": false}},
+		bson.A{bson.M{"$set": bson.M{
+			"status":       models.TransferConfirmed,
+			"confirmed_at": "$settled_at",
+		}}},
+	)
+	return err
+}
+
+// zeroLegacyFees records no fee on orders and trades created before fees,
+// their trades release the full amount
+func zeroLegacyFees(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("orders").UpdateMany(ctx,
+		bson.M{"fee": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"fee": models.FeeSchedule{}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("buy_trade").UpdateMany(ctx,
+		bson.M{"fee": bson.M{"$exists": false}},
+		bson.A{bson.M{"$set": bson.M{
+			"fee":        models.Money(0),
+			"net_amount": "$amount",
+		}}},
+	)
+	return err
+}
+
+// migrateTradeStates moves trades from the in-progress status and its
+// confirmed and mark_paid flags to the trade state machine
+func migrateTradeStates(ctx context.Context, db *mongo.Database) error {
+	trades := db.Collection("buy_trade")
+	moves := []struct {
+		filter bson.M
+		status string
+	}{
+		{bson.M{"status": legacyTradeInProgress, "mark_paid": true}, models.TradePaid},
+		{bson.M{"status": legacyTradeInProgress}, models.TradeOpened},
+		{bson.M{"status": legacyTradeProcessed}, models.TradeReleased},
+		{bson.M{"status": models.TradeCancelled, "cancel_reason": models.AutoCancellation}, models.TradeExpired},
+	}
+	for _, m := range moves {
+		_, err := trades.UpdateMany(ctx, m.filter, bson.M{"$set": bson.M{"status": m.status}})
+		if err != nil {
+			return fmt.Errorf("buy_trade %s: %v", m.status, err)
+		}
+	}
+
+	_, err := trades.UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"confirmed": "", "mark_paid": ""}})
+	return err
+}
+
+// Deadlines given to trades opened or paid before sellers set payment
+// windows, legacyPaymentWindow is how long buyers had to pay then and
+// legacyReleaseWindow the default seller release window
+const (
+	legacyPaymentWindow = time.Minute * 10
+	legacyReleaseWindow = time.Hour * 12
+)
+
+// setPaymentDeadlines records the default payment window on existing orders,
+// and the deadlines of open trades from when they were opened or paid
+func setPaymentDeadlines(ctx context.Context, db *mongo.Database) error {
+	for _, option := range []models.PaymentOption{models.Bank, models.PayPal, models.Stripe} {
+		window := models.DefaultPaymentWindow(option)
+		_, err := db.Collection("orders").UpdateMany(ctx,
+			bson.M{"payment_option": option, "payment_window_minutes": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"payment_window_minutes": int64(window / time.Minute)}},
+		)
+		if err != nil {
+			return fmt.Errorf("orders payment option %d: %v", option, err)
+		}
+	}
+
+	trades := db.Collection("buy_trade")
+	_, err := trades.UpdateMany(ctx,
+		bson.M{"status": models.TradeOpened, "pay_by": bson.M{"$exists": false}},
+		bson.A{bson.M{"$set": bson.M{
+			"pay_by": bson.M{"$add": bson.A{"$lock_time", int64(legacyPaymentWindow / time.Millisecond)}},
+		}}},
+	)
+	if err != nil {
+		return fmt.Errorf("buy_trade pay_by: %v", err)
+	}
+
+	_, err = trades.UpdateMany(ctx,
+		bson.M{"status": models.TradePaid, "release_by": bson.M{"$exists": false}},
+		bson.A{bson.M{"$set": bson.M{
+			"release_by": bson.M{"$add": bson.A{"$updated_at", int64(legacyReleaseWindow / time.Millisecond)}},
+		}}},
+	)
+	if err != nil {
+		return fmt.Errorf("buy_trade release_by: %v", err)
+	}
+	return nil
+}
+
+// buildReputations drops the ratings users could give without trading and
+// builds the reputation of every user who traded
+func buildReputations(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("user").UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{
+		"positive_ratings": 0,
+		"negative_ratings": 0,
+	}})
+	if err != nil {
+		return err
+	}
+
+	reviews, users := NewReviewDAO(ctx, db), NewUserDAO(ctx, db)
+	seen := map[primitive.ObjectID]bool{}
+	for _, field := range []string{"buyer_id", "seller_id"} {
+		ids, err := db.Collection("buy_trade").Distinct(ctx, field, bson.M{})
+		if err != nil {
+			return fmt.Errorf("buy_trade %s: %v", field, err)
+		}
+		for _, v := range ids {
+			id, ok := v.(primitive.ObjectID)
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			rep, err := reviews.Reputation(id)
+			if err == nil {
+				err = users.SetReputation(id, rep)
+			}
+			if err != nil {
+				return fmt.Errorf("user %s: %v", id.Hex(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// quoteLegacyTrades records the currency and fiat amount of existing trades
+// at their order's exchange rate
+func quoteLegacyTrades(ctx context.Context, db *mongo.Database) error {
+	trades := db.Collection("buy_trade")
+	cursor, err := trades.Find(ctx, bson.M{"currency": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	var legacy []models.BuyTrade
+	if err := cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+
+	orders := NewOrderDAO(ctx, db)
+	for _, trade := range legacy {
+		order, err := orders.FindByID(trade.OrderID.Hex())
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("order %s: %v", trade.OrderID.Hex(), err)
+		}
+
+		_, fiat, err := order.Quote(trade.Amount, 0)
+		if err != nil {
+			return fmt.Errorf("buy_trade %s: %v", trade.ID.Hex(), err)
+		}
+		_, err = trades.UpdateOne(ctx, bson.M{"_id": trade.ID}, bson.M{"$set": bson.M{
+			"currency":    order.Currency,
+			"fiat_amount": fiat,
+		}})
+		if err != nil {
+			return fmt.Errorf("buy_trade %s: %v", trade.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// fixLegacyPrices marks existing orders fixed priced and records the rate
+// of existing trades, orders were always fixed priced before
+func fixLegacyPrices(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("orders").UpdateMany(ctx,
+		bson.M{"price_type": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"price_type": models.PriceFixed}},
+	)
+	if err != nil {
+		return fmt.Errorf("orders price_type: %v", err)
+	}
+
+	cursor, err := db.Collection("buy_trade").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"ex_rate": bson.M{"$exists": false}}},
+		{"$lookup": bson.M{"from": "orders", "localField": "order_id", "foreignField": "_id", "as": "order"}},
+		{"$unwind": "$order"},
+		{"$project": bson.M{"ex_rate": "$order.ex_rate"}},
+	})
+	if err != nil {
+		return err
+	}
+	var rates []struct {
+		ID     primitive.ObjectID `bson:"_id"`
+		ExRate models.Money       `bson:"ex_rate"`
+	}
+	if err := cursor.All(ctx, &rates); err != nil {
+		return err
+	}
+	for _, r := range rates {
+		_, err := db.Collection("buy_trade").UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": bson.M{"ex_rate": r.ExRate}})
+		if err != nil {
+			return fmt.Errorf("buy_trade %s: %v", r.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// postLegacyICOFees records on the ledger the fees taken on ICO purchases
+// before they were posted there, so fee income reads from the fees account
+// alone
+// Their sweep isn't queued, they stay on the ico_wallet account until
+// they are moved to the FEE_WALLET by hand
+func postLegacyICOFees(ctx context.Context, db *mongo.Database) error {
+	var purchases []models.PayPalPayment
+	cursor, err := db.Collection("ico_trade").Find(ctx, bson.M{"fee": bson.M{"$gt": models.Money(0)}})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &purchases); err != nil {
+		return err
+	}
+
+	entries := db.Collection("journal_entries")
+	icoWallet := models.LedgerAccount{Type: models.ICOWalletAccount}
+	fees := models.LedgerAccount{Type: models.FeesAccount}
+	for _, p := range purchases {
+		entry := models.JournalEntry{
+			ID:        primitive.NewObjectID(),
+			Reference: "ico_fee:" + p.ID.Hex(),
+			Kind:      models.EntryICOFee,
+			Memo:      "fee on ico purchase " + p.ID.Hex(),
+			Postings: []models.Posting{
+				{Account: icoWallet.Code(), AccountType: icoWallet.Type, Debit: p.Fee},
+				{Account: fees.Code(), AccountType: fees.Type, Credit: p.Fee},
+			},
+			CreatedAt: p.CreatedAt,
+		}
+		_, err := entries.UpdateOne(ctx,
+			bson.M{"reference": entry.Reference},
+			bson.M{"$setOnInsert": entry},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("ico_trade %s: %v", p.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// postLegacyDeposits records on the ledger the deposits held in escrow
+// before it was kept there, each unreleased deposit opens its order's seller
+// hold with what is left of it so its trades can be released and what is
+// left reversed
+func postLegacyDeposits(ctx context.Context, db *mongo.Database) error {
+	var deposits []models.EscrowDeposit
+	cursor, err := db.Collection("escrow").Find(ctx, bson.M{"released": false})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &deposits); err != nil {
+		return err
+	}
+
+	entries := db.Collection("journal_entries")
+	wallet := models.LedgerAccount{Type: models.EscrowWalletAccount}
+	for _, d := range deposits {
+		held := d.Amount.Sub(d.ReleasedAmount)
+		if !held.IsPositive() {
+			continue
+		}
+
+		hold := models.LedgerAccount{Type: models.SellerHoldAccount, Owner: d.OrderID.Hex()}
+		entry := models.JournalEntry{
+			ID:        primitive.NewObjectID(),
+			Reference: "deposit:" + d.OrderID.Hex(),
+			Kind:      models.EntryDeposit,
+			OrderID:   d.OrderID,
+			Memo:      "seller deposit from " + d.SourceWallet,
+			Postings: []models.Posting{
+				{Account: wallet.Code(), AccountType: wallet.Type, Debit: held},
+				{Account: hold.Code(), AccountType: hold.Type, Credit: held},
+			},
+			CreatedAt: d.CreatedAt,
+		}
+		// deposits settled since the ledger was added are already posted
+		_, err := entries.UpdateOne(ctx,
+			bson.M{"reference": entry.Reference},
+			bson.M{"$setOnInsert": entry},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("escrow %s: %v", d.ID.Hex(), err)
+		}
+	}
+	return nil
+}
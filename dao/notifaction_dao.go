@@ -6,7 +6,6 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // FindNotificationByID ...
@@ -27,23 +26,15 @@ func (dao *FactoryDAO) FindNotificationByID(id string) (interface{}, error) {
 	return notification, err
 }
 
-// QueryNotifications ...
-func (dao *FactoryDAO) QueryNotifications(filter bson.M) ([]models.Notification, error) {
+// PageNotifications retrieves a page of the notifications matching filter
+func (dao *FactoryDAO) PageNotifications(filter bson.M, page Page) ([]models.Notification, models.PageInfo, error) {
 	var notifications []models.Notification
-	opts := options.Find()
-	opts.SetSort(bson.M{"created_at": -1})
 
 	collection, ok := dao.Collections["notifications"]
 	if !ok {
-		return nil, errors.New("invalid collection type")
-	}
-
-	cursor, err := collection.Find(dao.ctx, filter, opts)
-	if err != nil {
-		return nil, err
+		return nil, models.PageInfo{}, errors.New("invalid collection type")
 	}
 
-	err = cursor.All(dao.ctx, &notifications)
-
-	return notifications, err
+	info, err := paginate(dao.ctx, collection, page, &notifications, []bson.M{{"$match": filter}})
+	return notifications, info, err
 }
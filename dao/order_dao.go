@@ -51,18 +51,31 @@ func (dao *OrderDAO) Query(filter bson.M) ([]models.SellOrder, error) {
 	return orders, err
 }
 
-// PipelineAll ...
-func (dao *OrderDAO) PipelineAll(query bson.M) (interface{}, error) {
-	var orders []bson.M
+// amountAvailable adds the amount of an order not yet sold or reserved
+var amountAvailable = bson.M{
+	"$addFields": bson.M{
+		"amount_available": bson.M{
+			"$subtract": bson.A{"$amount_left", bson.M{"$ifNull": bson.A{"$amount_reserved", 0}}},
+		},
+	},
+}
+
+// PageOrders retrieves a page of the orders matching filter
+func (dao *OrderDAO) PageOrders(filter bson.M, page Page) ([]models.SellOrder, models.PageInfo, error) {
+	var orders []models.SellOrder
+	info, err := paginate(dao.ctx, dao.Collection, page, &orders, []bson.M{amountAvailable, {"$match": filter}})
+	return orders, info, err
+}
+
+// PipelineAll retrieves a page of the orders matching query joined with
+// their sellers, seller filters on the seller and may be empty
+func (dao *OrderDAO) PipelineAll(query, seller bson.M, page Page) ([]models.SellOrderView, models.PageInfo, error) {
+	var orders []models.SellOrderView
 
 	matches := bson.M{
 		"$match": query,
 	}
 
-	sort := bson.M{
-		"$sort": bson.M{"created_at": -1},
-	}
-
 	lookup := bson.M{
 		"$lookup": bson.M{
 			"from":         "user",
@@ -81,23 +94,25 @@ func (dao *OrderDAO) PipelineAll(query bson.M) (interface{}, error) {
 			"user_data.confirmed": 0,
 			"user_data.fcm_token": 0,
 			"user_data.passcode":  0,
+			"user_data.admin":     0,
 		},
 	}
 
-	pipeline := []bson.M{matches, sort, lookup, unwind, project}
-	cursor, err := dao.Collection.Aggregate(dao.ctx, pipeline)
-	if err != nil {
-		return nil, err
+	// sellers are only looked up ahead of the page cut when filtered on
+	pipeline := []bson.M{amountAvailable, matches}
+	after := []bson.M{lookup, unwind, project}
+	if len(seller) > 0 {
+		pipeline = append(pipeline, lookup, unwind, bson.M{"$match": seller})
+		after = []bson.M{project}
 	}
 
-	err = cursor.All(dao.ctx, &orders)
-
-	return orders, err
+	info, err := paginate(dao.ctx, dao.Collection, page, &orders, pipeline, after...)
+	return orders, info, err
 }
 
 // PipelineSingle ...
-func (dao *OrderDAO) PipelineSingle(id string, query bson.M) (interface{}, error) {
-	var orders []bson.M
+func (dao *OrderDAO) PipelineSingle(id string, query bson.M) (models.SellOrderView, error) {
+	var orders []models.SellOrderView
 
 	var matches = make(bson.M)
 	if query != nil {
@@ -129,22 +144,26 @@ func (dao *OrderDAO) PipelineSingle(id string, query bson.M) (interface{}, error
 			"user_data.confirmed": 0,
 			"user_data.fcm_token": 0,
 			"user_data.passcode":  0,
+			"user_data.admin":     0,
 		},
 	}
 
-	pipeline := []bson.M{matches, lookup, unwind, project}
+	pipeline := []bson.M{matches, amountAvailable, lookup, unwind, project}
 	cursor, err := dao.Collection.Aggregate(dao.ctx, pipeline)
 	if err != nil {
-		return models.SellOrder{}, err
+		return models.SellOrderView{}, err
 	}
 
 	err = cursor.All(dao.ctx, &orders)
+	if err != nil {
+		return models.SellOrderView{}, err
+	}
 
 	if len(orders) < 1 {
-		return models.SellOrder{}, err
+		return models.SellOrderView{}, mongo.ErrNoDocuments
 	}
 
-	return orders[0], err
+	return orders[0], nil
 }
 
 // PoolQueryByTime ...
@@ -178,9 +197,105 @@ func (dao *OrderDAO) FindByID(id string) (models.SellOrder, error) {
 	return order, err
 }
 
+// orderCounters are only ever changed atomically by Reserve, Release and
+// Settle, so a full order update never overwrites them
+var orderCounters = []string{"amount_sold", "amount_left", "amount_reserved"}
+
 // Update an existing order
 func (dao *OrderDAO) Update(order models.SellOrder) error {
 	docID, _ := primitive.ObjectIDFromHex(order.ID.Hex())
-	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": docID}, bson.M{"$set": order})
+
+	var doc bson.M
+	obj, _ := bson.Marshal(order)
+	if err := bson.Unmarshal(obj, &doc); err != nil {
+		return err
+	}
+	for _, field := range orderCounters {
+		delete(doc, field)
+	}
+
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": docID}, bson.M{"$set": doc})
 	return err
 }
+
+// Reserve sets amount of a pending order aside for a trade, only if that
+// much is still available, reporting whether the reservation was made
+func (dao *OrderDAO) Reserve(id primitive.ObjectID, amount models.Money) (bool, error) {
+	res, err := dao.Collection.UpdateOne(dao.ctx, bson.M{
+		"_id":    id,
+		"status": models.OrderPending,
+		"$expr": bson.M{
+			"$gte": bson.A{
+				bson.M{"$subtract": bson.A{"$amount_left", bson.M{"$ifNull": bson.A{"$amount_reserved", 0}}}},
+				amount,
+			},
+		},
+	}, bson.M{
+		"$inc": bson.M{"amount_reserved": amount},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// Release returns an amount reserved for a trade that did not go through
+func (dao *OrderDAO) Release(id primitive.ObjectID, amount models.Money) error {
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{"amount_reserved": amount.Neg()},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// Settle moves an amount reserved for a confirmed trade to amount sold
+func (dao *OrderDAO) Settle(id primitive.ObjectID, amount models.Money) error {
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{
+			"amount_reserved": amount.Neg(),
+			"amount_sold":     amount,
+			"amount_left":     amount.Neg(),
+		},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// Withdraw takes an amount reserved for a trade off the order, the amount
+// was reversed to the seller rather than sold
+func (dao *OrderDAO) Withdraw(id primitive.ObjectID, amount models.Money) error {
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{
+			"amount_reserved": amount.Neg(),
+			"amount_left":     amount.Neg(),
+		},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// SetRate updates the exchange rate of a floating order
+func (dao *OrderDAO) SetRate(id primitive.ObjectID, rate models.Money) error {
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"ex_rate":    rate,
+		"updated_at": time.Now().UTC(),
+	}})
+	return err
+}
+
+// UpdateStatus moves an order to status `to` only if it is still in `from`,
+// reporting whether the update happened
+func (dao *OrderDAO) UpdateStatus(id primitive.ObjectID, from, to string) (bool, error) {
+	res, err := dao.Collection.UpdateOne(dao.ctx, bson.M{
+		"_id":    id,
+		"status": from,
+	}, bson.M{"$set": bson.M{
+		"status":     to,
+		"updated_at": time.Now().UTC(),
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
@@ -0,0 +1,176 @@
+package dao
+
+import (
+	"context"
+	"vhennpay-bend/models"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrInvalidPage is returned for a page request a list can't serve
+var ErrInvalidPage = errors.New("invalid page request")
+
+// Sort orders of a page
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// Page requests the page of a list after Cursor, sorted on Sort then by id
+// An empty Cursor requests the first page
+type Page struct {
+	Limit  int
+	Sort   string
+	Desc   bool
+	Cursor string
+}
+
+// NewPage reads a page request from the limit, sort, order and cursor
+// parameters of v, sorts are the fields the list may be sorted on and the
+// first of them is its default
+// Lists are sorted in descending order unless order is asc, limit defaults
+// to DefaultPageSize and is capped at MaxPageSize
+func NewPage(v url.Values, sorts ...string) (Page, error) {
+	page := Page{
+		Limit:  models.DefaultPageSize,
+		Sort:   sorts[0],
+		Desc:   true,
+		Cursor: v.Get("cursor"),
+	}
+
+	if limit := v.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return page, ErrInvalidPage
+		}
+		page.Limit = n
+	}
+	if page.Limit > models.MaxPageSize {
+		page.Limit = models.MaxPageSize
+	}
+
+	if sort := v.Get("sort"); sort != "" {
+		allowed := false
+		for _, field := range sorts {
+			allowed = allowed || field == sort
+		}
+		if !allowed {
+			return page, ErrInvalidPage
+		}
+		page.Sort = sort
+	}
+
+	switch v.Get("order") {
+	case "", SortDesc:
+	case SortAsc:
+		page.Desc = false
+	default:
+		return page, ErrInvalidPage
+	}
+
+	return page, nil
+}
+
+// pageCursor is the position after the last document of a page, it is only
+// valid for the sort it was made for
+type pageCursor struct {
+	Sort  string        `bson:"s"`
+	Desc  bool          `bson:"d"`
+	Value bson.RawValue `bson:"v"`
+	ID    bson.RawValue `bson:"i"`
+}
+
+func (c pageCursor) encode() (string, error) {
+	b, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidPage
+	}
+	if err := bson.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidPage
+	}
+	return c, nil
+}
+
+// paginate runs pipeline on collection and decodes the page of its results
+// requested into out, a pointer to a slice
+// The page is cut before the after stages run, so lookups that neither
+// filter nor sort can be left to them
+func paginate(ctx context.Context, collection *mongo.Collection, page Page, out interface{}, pipeline []bson.M, after ...bson.M) (models.PageInfo, error) {
+	info := models.PageInfo{Limit: page.Limit, Sort: page.Sort, Order: SortAsc}
+	dir, cmp := 1, "$gt"
+	if page.Desc {
+		info.Order, dir, cmp = SortDesc, -1, "$lt"
+	}
+
+	stages := append([]bson.M{}, pipeline...)
+	if page.Cursor != "" {
+		c, err := decodePageCursor(page.Cursor)
+		if err != nil {
+			return info, err
+		}
+		if c.Sort != page.Sort || c.Desc != page.Desc {
+			return info, ErrInvalidPage
+		}
+		stages = append(stages, bson.M{"$match": bson.M{"$or": bson.A{
+			bson.M{page.Sort: bson.M{cmp: c.Value}},
+			bson.M{page.Sort: c.Value, "_id": bson.M{cmp: c.ID}},
+		}}})
+	}
+	stages = append(stages,
+		bson.M{"$sort": bson.D{{Key: page.Sort, Value: dir}, {Key: "_id", Value: dir}}},
+		bson.M{"$limit": page.Limit + 1},
+	)
+	stages = append(stages, after...)
+
+	cursor, err := collection.Aggregate(ctx, stages)
+	if err != nil {
+		return info, err
+	}
+	var docs []bson.Raw
+	if err := cursor.All(ctx, &docs); err != nil {
+		return info, err
+	}
+
+	if len(docs) > page.Limit {
+		docs = docs[:page.Limit]
+		last := docs[len(docs)-1]
+		info.HasMore = true
+		info.NextCursor, err = pageCursor{
+			Sort:  page.Sort,
+			Desc:  page.Desc,
+			Value: last.Lookup(strings.Split(page.Sort, ".")...),
+			ID:    last.Lookup("_id"),
+		}.encode()
+		if err != nil {
+			return info, err
+		}
+	}
+
+	items := reflect.ValueOf(out).Elem()
+	items.Set(reflect.MakeSlice(items.Type(), 0, len(docs)))
+	for _, doc := range docs {
+		item := reflect.New(items.Type().Elem())
+		if err := bson.Unmarshal(doc, item.Interface()); err != nil {
+			return info, err
+		}
+		items.Set(reflect.Append(items, item.Elem()))
+	}
+
+	return info, nil
+}
@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"vhennpay-bend/models"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewPage(t *testing.T) {
+	sorts := []string{"created_at", "ex_rate"}
+
+	page, err := NewPage(url.Values{}, sorts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Limit != models.DefaultPageSize || page.Sort != "created_at" || !page.Desc {
+		t.Errorf("default page = %+v", page)
+	}
+
+	page, err = NewPage(url.Values{"limit": {"1000"}, "sort": {"ex_rate"}, "order": {"asc"}}, sorts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Limit != models.MaxPageSize || page.Sort != "ex_rate" || page.Desc {
+		t.Errorf("page = %+v", page)
+	}
+
+	for _, v := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"ten"}},
+		{"sort": {"password"}},
+		{"order": {"up"}},
+	} {
+		if _, err := NewPage(v, sorts...); err != ErrInvalidPage {
+			t.Errorf("NewPage(%v) error = %v, want ErrInvalidPage", v, err)
+		}
+	}
+}
+
+func TestPageCursor(t *testing.T) {
+	doc, _ := bson.Marshal(bson.M{"_id": primitive.NewObjectID(), "ex_rate": models.Money(150000000)})
+	raw := bson.Raw(doc)
+
+	s, err := pageCursor{Sort: "ex_rate", Desc: true, Value: raw.Lookup("ex_rate"), ID: raw.Lookup("_id")}.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := decodePageCursor(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Sort != "ex_rate" || !c.Desc || !c.Value.Equal(raw.Lookup("ex_rate")) || !c.ID.Equal(raw.Lookup("_id")) {
+		t.Errorf("decoded cursor = %+v", c)
+	}
+
+	if _, err := decodePageCursor("not a cursor"); err != ErrInvalidPage {
+		t.Errorf("decodePageCursor error = %v, want ErrInvalidPage", err)
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	query := bson.M{}
+	err := ListFilter(url.Values{
+		"currency":       {"ngn"},
+		"min_rate":       {"400"},
+		"max_rate":       {"400"},
+		"payment_option": {"2"},
+		"to":             {"2021-03-01"},
+	}, query, FilterCurrency, FilterRate, FilterPaymentOption, FilterDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rate := query["ex_rate"].(bson.M)
+	if rate["$gte"] != models.Money(40000000000) || rate["$lte"] != models.Money(40000000000) {
+		t.Errorf("ex_rate = %v", rate)
+	}
+	if query["payment_option"] != int32(2) {
+		t.Errorf("payment_option = %v", query["payment_option"])
+	}
+	to := time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)
+	if created := query["created_at"].(bson.M); !created["$lt"].(time.Time).Equal(to) {
+		t.Errorf("created_at = %v, want before %v", created, to)
+	}
+
+	if err := ListFilter(url.Values{"min_rate": {"cheap"}}, bson.M{}, FilterRate); err != ErrInvalidPage {
+		t.Errorf("ListFilter error = %v, want ErrInvalidPage", err)
+	}
+}
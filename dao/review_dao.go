@@ -0,0 +1,154 @@
+package dao
+
+import (
+	"context"
+	"vhennpay-bend/models"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReviewDAO represents the trade reviews DAO
+type ReviewDAO struct {
+	ctx        context.Context
+	db         *mongo.Database
+	Collection *mongo.Collection
+}
+
+// NewReviewDAO returns a new ReviewDAO
+func NewReviewDAO(ctx context.Context, db *mongo.Database) *ReviewDAO {
+	dao := &ReviewDAO{
+		ctx:        context.TODO(),
+		db:         db,
+		Collection: db.Collection("reviews"),
+	}
+
+	_, err := dao.Collection.Indexes().CreateOne(dao.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "trade_id", Value: 1}, {Key: "reviewer_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("reviews: failed to create trade reviewer index: %v", err)
+	}
+
+	return dao
+}
+
+// Insert inserts a trade review, a second review of the same trade by the
+// same reviewer results in a duplicate key error
+func (dao *ReviewDAO) Insert(review models.Review) error {
+	_, err := dao.Collection.InsertOne(dao.ctx, review)
+	return err
+}
+
+// Query retrieves the reviews a user received, newest first
+func (dao *ReviewDAO) Query(revieweeID primitive.ObjectID) ([]models.Review, error) {
+	var reviews []models.Review
+
+	opts := options.Find()
+	opts.SetSort(bson.M{"created_at": -1})
+
+	cursor, err := dao.Collection.Find(dao.ctx, bson.M{"reviewee_id": revieweeID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &reviews)
+
+	return reviews, err
+}
+
+// closedTradeStatuses are the states of trades that won't move again
+var closedTradeStatuses = []string{models.TradeReleased, models.TradeCancelled, models.TradeExpired}
+
+// Reputation builds a user's reputation from the reviews they received and
+// the trades they took part in
+func (dao *ReviewDAO) Reputation(userID primitive.ObjectID) (models.Reputation, error) {
+	rep := models.Reputation{UpdatedAt: time.Now().UTC()}
+
+	var reviews []struct {
+		Count    int     `bson:"count"`
+		Average  float64 `bson:"average"`
+		Positive int     `bson:"positive"`
+		Negative int     `bson:"negative"`
+	}
+	err := dao.aggregate("reviews", &reviews,
+		bson.M{"$match": bson.M{"reviewee_id": userID}},
+		bson.M{"$group": bson.M{
+			"_id":      nil,
+			"count":    bson.M{"$sum": 1},
+			"average":  bson.M{"$avg": "$score"},
+			"positive": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$score", models.PositiveReviewScore}}, 1, 0}}},
+			"negative": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$lte": bson.A{"$score", models.NegativeReviewScore}}, 1, 0}}},
+		}},
+	)
+	if err != nil {
+		return rep, err
+	}
+	if len(reviews) > 0 {
+		r := reviews[0]
+		rep.Reviews, rep.AverageScore = r.Count, r.Average
+		rep.Positive, rep.Negative = r.Positive, r.Negative
+		rep.Neutral = r.Count - r.Positive - r.Negative
+	}
+
+	var trades []struct {
+		Closed    int `bson:"closed"`
+		Completed int `bson:"completed"`
+	}
+	err = dao.aggregate("buy_trade", &trades,
+		bson.M{"$match": bson.M{
+			"$or":    bson.A{bson.M{"buyer_id": userID}, bson.M{"seller_id": userID}},
+			"status": bson.M{"$in": closedTradeStatuses},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":       nil,
+			"closed":    bson.M{"$sum": 1},
+			"completed": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", models.TradeReleased}}, 1, 0}}},
+		}},
+	)
+	if err != nil {
+		return rep, err
+	}
+	if len(trades) > 0 && trades[0].Closed > 0 {
+		rep.ClosedTrades, rep.CompletedTrades = trades[0].Closed, trades[0].Completed
+		rep.CompletionRate = float64(rep.CompletedTrades) / float64(rep.ClosedTrades)
+	}
+
+	// trades released before buyers marked them paid count from when they
+	// were opened
+	var releases []struct {
+		Average float64 `bson:"average"`
+	}
+	err = dao.aggregate("buy_trade", &releases,
+		bson.M{"$match": bson.M{"seller_id": userID, "status": models.TradeReleased}},
+		bson.M{"$group": bson.M{
+			"_id": nil,
+			"average": bson.M{"$avg": bson.M{"$subtract": bson.A{
+				"$processed_at",
+				bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$paid_at", time.Time{}}}, "$paid_at", "$lock_time"}},
+			}}},
+		}},
+	)
+	if err != nil {
+		return rep, err
+	}
+	if len(releases) > 0 {
+		rep.AverageReleaseSeconds = int64(releases[0].Average / 1000)
+	}
+
+	return rep, nil
+}
+
+// aggregate runs pipeline on collection ckey decoding the results into out
+func (dao *ReviewDAO) aggregate(ckey string, out interface{}, pipeline ...bson.M) error {
+	cursor, err := dao.db.Collection(ckey).Aggregate(dao.ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(dao.ctx, out)
+}
@@ -38,6 +38,47 @@ func (dao *OrderDAO) UpdateTrade(trade models.BuyTrade) error {
 	return err
 }
 
+// TransitionTrade sets the fields in set on a trade only if it is still in
+// status `from`, reporting whether it was updated
+// Only the fields a move changes are set so stamps written concurrently,
+// like reminders, aren't overwritten
+func (dao *OrderDAO) TransitionTrade(id primitive.ObjectID, from string, set bson.M) (bool, error) {
+	collection := dao.db.Collection("buy_trade")
+	res, err := collection.UpdateOne(dao.ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// MarkTradeReminded stamps field with at on a trade still in status that
+// wasn't stamped yet, reporting whether it was stamped
+func (dao *OrderDAO) MarkTradeReminded(id primitive.ObjectID, status, field string, at time.Time) (bool, error) {
+	collection := dao.db.Collection("buy_trade")
+	res, err := collection.UpdateOne(dao.ctx,
+		bson.M{"_id": id, "status": status, field: bson.M{"$in": bson.A{time.Time{}, nil}}},
+		bson.M{"$set": bson.M{field: at}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// MarkTradeSettled clears a closed trade's settling flag once the escrow
+// transfer closing it was queued, reporting whether it was still set
+func (dao *OrderDAO) MarkTradeSettled(id primitive.ObjectID) (bool, error) {
+	collection := dao.db.Collection("buy_trade")
+	res, err := collection.UpdateOne(dao.ctx,
+		bson.M{"_id": id, "settling": true},
+		bson.M{"$unset": bson.M{"settling": ""}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
 // PoolTradesByTime ...
 func (dao *OrderDAO) PoolTradesByTime(interval time.Time, field, status string) ([]models.BuyTrade, error) {
 	var trades []models.BuyTrade
@@ -81,23 +122,92 @@ func (dao *OrderDAO) QueryTrades(filter bson.M) ([]models.BuyTrade, error) {
 	return trades, err
 }
 
-// QueryTradeMessages ...
-func (dao *OrderDAO) QueryTradeMessages(id primitive.ObjectID) ([]models.TradeChat, error) {
+// PageTrades retrieves a page of the trades matching filter
+func (dao *OrderDAO) PageTrades(filter bson.M, page Page) ([]models.BuyTrade, models.PageInfo, error) {
+	var trades []models.BuyTrade
+	info, err := paginate(dao.ctx, dao.db.Collection("buy_trade"), page, &trades, []bson.M{{"$match": filter}})
+	return trades, info, err
+}
+
+// PageTradeViews retrieves a page of the trades matching filter as listed to
+// userID, one of their parties, with the counterparty and order of each
+func (dao *OrderDAO) PageTradeViews(userID primitive.ObjectID, filter bson.M, page Page) ([]models.TradeView, models.PageInfo, error) {
+	var trades []models.TradeView
+
+	party := bson.M{"$addFields": bson.M{
+		"role": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$buyer_id", userID}}, models.TradeActorBuyer, models.TradeActorSeller,
+		}},
+		"counterparty_id": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$buyer_id", userID}}, "$seller_id", "$buyer_id",
+		}},
+	}}
+	counterparty := bson.M{"$lookup": bson.M{
+		"from": "user",
+		"let":  bson.M{"id": "$counterparty_id"},
+		"pipeline": bson.A{
+			bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$id"}}}},
+			bson.M{"$project": bson.M{"username": 1, "tier": 1, "reputation": 1}},
+		},
+		"as": "counterparty",
+	}}
+	order := bson.M{"$lookup": bson.M{
+		"from":         "orders",
+		"localField":   "order_id",
+		"foreignField": "_id",
+		"as":           "order",
+	}}
+
+	info, err := paginate(dao.ctx, dao.db.Collection("buy_trade"), page, &trades, []bson.M{{"$match": filter}},
+		party,
+		counterparty,
+		bson.M{"$unwind": bson.M{"path": "$counterparty", "preserveNullAndEmptyArrays": true}},
+		order,
+		bson.M{"$unwind": bson.M{"path": "$order", "preserveNullAndEmptyArrays": true}},
+	)
+	return trades, info, err
+}
+
+// PageTradeMessages retrieves a page of the chat messages matching filter
+func (dao *OrderDAO) PageTradeMessages(filter bson.M, page Page) ([]models.TradeChat, models.PageInfo, error) {
 	var messages []models.TradeChat
+	info, err := paginate(dao.ctx, dao.db.Collection("trade_chat"), page, &messages, []bson.M{{"$match": filter}})
+	return messages, info, err
+}
 
-	collection := dao.db.Collection("trade_chat")
-	opts := options.Find()
-	opts.SetSort(bson.M{"created_at": -1})
+// FindTradeAttachment retrieves a file attached to a trade's chat
+func (dao *OrderDAO) FindTradeAttachment(tradeID, id primitive.ObjectID) (models.TradeAttachment, error) {
+	var msg models.TradeChat
 
-	filter := bson.M{
-		"trade_id": id,
+	collection := dao.db.Collection("trade_chat")
+	err := collection.FindOne(dao.ctx, bson.M{"trade_id": tradeID, "attachment.id": id}).Decode(&msg)
+	if err != nil {
+		return models.TradeAttachment{}, err
 	}
+	return *msg.Attachment, nil
+}
 
-	cursor, err := collection.Find(dao.ctx, filter, opts)
+// InsertTradeEvent records a trade's move between states
+func (dao *OrderDAO) InsertTradeEvent(event models.TradeEvent) error {
+	collection := dao.db.Collection("trade_events")
+	_, err := collection.InsertOne(dao.ctx, event)
+	return err
+}
+
+// QueryTradeEvents returns a trade's moves between states, oldest first
+func (dao *OrderDAO) QueryTradeEvents(id primitive.ObjectID) ([]models.TradeEvent, error) {
+	var events []models.TradeEvent
+
+	collection := dao.db.Collection("trade_events")
+	opts := options.Find()
+	opts.SetSort(bson.M{"created_at": 1})
+
+	cursor, err := collection.Find(dao.ctx, bson.M{"trade_id": id}, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	err = cursor.All(dao.ctx, &messages)
-	return messages, err
+	err = cursor.All(dao.ctx, &events)
+
+	return events, err
 }
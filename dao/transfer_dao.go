@@ -0,0 +1,212 @@
+package dao
+
+import (
+	"context"
+	"vhennpay-bend/models"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TransferDAO represents the transfer outbox DAO
+type TransferDAO struct {
+	ctx        context.Context
+	db         *mongo.Database
+	Collection *mongo.Collection
+}
+
+// NewTransferDAO returns a new TransferDAO
+func NewTransferDAO(ctx context.Context, db *mongo.Database) *TransferDAO {
+	dao := &TransferDAO{
+		ctx:        context.TODO(),
+		db:         db,
+		Collection: db.Collection("transfers"),
+	}
+
+	_, err := dao.Collection.Indexes().CreateOne(dao.ctx, mongo.IndexModel{
+		Keys:    bson.M{"key": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("transfers: failed to create key index: %v", err)
+	}
+
+	return dao
+}
+
+// Insert a transfer into database, a transfer with the same key already
+// existing results in a duplicate key error
+func (dao *TransferDAO) Insert(transfer models.Transfer) error {
+	obj, _ := bson.Marshal(transfer)
+	_, err := dao.Collection.InsertOne(dao.ctx, obj)
+	return err
+}
+
+// FindByKey retrieves a transfer by its idempotency key
+func (dao *TransferDAO) FindByKey(key string) (models.Transfer, error) {
+	var transfer models.Transfer
+	err := dao.Collection.FindOne(dao.ctx, bson.M{"key": key}).Decode(&transfer)
+	return transfer, err
+}
+
+// FindByID retrieves a transfer by its id
+func (dao *TransferDAO) FindByID(id string) (models.Transfer, error) {
+	var transfer models.Transfer
+	docID, _ := primitive.ObjectIDFromHex(id)
+	err := dao.Collection.FindOne(dao.ctx, bson.M{"_id": docID}).Decode(&transfer)
+	return transfer, err
+}
+
+// Query takes a bson.M filters map and applies the query on the transfers
+// collection
+func (dao *TransferDAO) Query(filter bson.M) ([]models.Transfer, error) {
+	var transfers []models.Transfer
+
+	opts := options.Find()
+	opts.SetSort(bson.M{"created_at": -1})
+
+	cursor, err := dao.Collection.Find(dao.ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &transfers)
+
+	return transfers, err
+}
+
+// Claim atomically moves a transfer matching filter into submitting and
+// counts the attempt, mongo.ErrNoDocuments is returned when nothing matched
+func (dao *TransferDAO) Claim(filter bson.M) (models.Transfer, error) {
+	var transfer models.Transfer
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := dao.Collection.FindOneAndUpdate(dao.ctx, filter, bson.M{
+		"$set": bson.M{
+			"status":     models.TransferSubmitting,
+			"updated_at": time.Now().UTC(),
+		},
+		"$inc": bson.M{"attempts": 1},
+	}, opts).Decode(&transfer)
+
+	return transfer, err
+}
+
+// Transition updates a transfer only if it is still in the from status,
+// reporting whether the update happened
+func (dao *TransferDAO) Transition(id primitive.ObjectID, from models.TransferStatus, set bson.M) (bool, error) {
+	set["updated_at"] = time.Now().UTC()
+	res, err := dao.Collection.UpdateOne(dao.ctx, bson.M{
+		"_id":    id,
+		"status": from,
+	}, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// Expire moves every transfer matching filter to status, recording reason
+func (dao *TransferDAO) Expire(filter bson.M, status models.TransferStatus, reason string) (int64, error) {
+	res, err := dao.Collection.UpdateMany(dao.ctx, filter, bson.M{"$set": bson.M{
+		"status":     status,
+		"last_error": reason,
+		"updated_at": time.Now().UTC(),
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// ExpireStale parks transfers left in submitting since before, a worker died
+// mid submission so their outcome can't be told
+func (dao *TransferDAO) ExpireStale(before time.Time) (int64, error) {
+	return dao.Expire(bson.M{
+		"status":     models.TransferSubmitting,
+		"updated_at": bson.M{"$lte": before},
+	}, models.TransferUnknown, "submission interrupted")
+}
+
+// Abandoned returns the pending deposits the seller never signed before they
+// expired
+func (dao *TransferDAO) Abandoned(now time.Time) ([]models.Transfer, error) {
+	return dao.Query(bson.M{
+		"status":     models.TransferPending,
+		"kind":       models.TransferDeposit,
+		"signature":  bson.M{"$exists": false},
+		"expires_at": bson.M{"$lte": now},
+	})
+}
+
+// Unapplied returns confirmed transfers whose effects were never recorded
+func (dao *TransferDAO) Unapplied() ([]models.Transfer, error) {
+	return dao.Query(bson.M{
+		"status":  models.TransferConfirmed,
+		"applied": false,
+	})
+}
+
+// ClaimDue claims the next pending transfer due by now, deposits are only
+// due once signed by the seller
+func (dao *TransferDAO) ClaimDue(now time.Time) (models.Transfer, error) {
+	return dao.Claim(bson.M{
+		"status": models.TransferPending,
+		"$or": bson.A{
+			bson.M{"kind": bson.M{"$ne": models.TransferDeposit}},
+			bson.M{"signature": bson.M{"$exists": true}},
+		},
+		"next_attempt_at": bson.M{"$lte": now},
+	})
+}
+
+// ClaimPending claims a transfer by id if it is still pending
+func (dao *TransferDAO) ClaimPending(id primitive.ObjectID) (models.Transfer, error) {
+	return dao.Claim(bson.M{"_id": id, "status": models.TransferPending})
+}
+
+// InFlight sums, per kind and status, the transfers that may have moved funds
+// on the chain before their effects were recorded
+func (dao *TransferDAO) InFlight() ([]models.TransferTotal, error) {
+	var totals []models.TransferTotal
+
+	matches := bson.M{
+		"$match": bson.M{"$or": bson.A{
+			bson.M{"status": bson.M{"$in": bson.A{
+				models.TransferSubmitting,
+				models.TransferSettled,
+				models.TransferUnknown,
+			}}},
+			bson.M{"status": models.TransferConfirmed, "applied": false},
+		}},
+	}
+	group := bson.M{
+		"$group": bson.M{
+			"_id":    bson.M{"kind": "$kind", "status": "$status"},
+			"amount": bson.M{"$sum": "$amount"},
+			"count":  bson.M{"$sum": 1},
+		},
+	}
+	project := bson.M{
+		"$project": bson.M{
+			"_id":    0,
+			"kind":   "$_id.kind",
+			"status": "$_id.status",
+			"amount": 1,
+			"count":  1,
+		},
+	}
+
+	cursor, err := dao.Collection.Aggregate(dao.ctx, []bson.M{matches, group, project})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(dao.ctx, &totals)
+
+	return totals, err
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"context"
 	"vhennpay-bend/models"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -36,6 +37,17 @@ func (dao *UserDAO) FindAll() ([]models.User, error) {
 	return users, err
 }
 
+// FindAdmins returns every admin user
+func (dao *UserDAO) FindAdmins() ([]models.User, error) {
+	var users []models.User
+	cursor, err := dao.Collection.Find(dao.ctx, bson.M{"admin": true})
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(dao.ctx, &users)
+	return users, err
+}
+
 // FindByID ... get a user by its id
 func (dao *UserDAO) FindByID(id string) (models.User, error) {
 	var user models.User
@@ -64,3 +76,36 @@ func (dao *UserDAO) Update(user models.User) error {
 	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": docID}, bson.M{"$set": user})
 	return err
 }
+
+// SetTier sets the fee tier a user is charged at, leaving the rest of the
+// user as it is
+func (dao *UserDAO) SetTier(id primitive.ObjectID, tier string) (bool, error) {
+	res, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"tier":       tier,
+		"updated_at": time.Now().UTC(),
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// CountTransaction adds a completed transaction to a user's count
+func (dao *UserDAO) CountTransaction(id primitive.ObjectID) error {
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{"num_transactions": 1},
+	})
+	return err
+}
+
+// SetReputation saves a user's reputation, the user's positive and negative
+// ratings follow their reviews
+func (dao *UserDAO) SetReputation(userID primitive.ObjectID, rep models.Reputation) error {
+	_, err := dao.Collection.UpdateOne(dao.ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{
+		"reputation":       rep,
+		"positive_ratings": rep.Positive,
+		"negative_ratings": rep.Negative,
+	}})
+	return err
+}
+
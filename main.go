@@ -2,13 +2,20 @@ package main
 
 import (
 	"context"
+	"vhennpay-bend/api/admin"
 	"vhennpay-bend/api/callbacks"
 	"vhennpay-bend/api/order"
 	"vhennpay-bend/api/user"
 	"vhennpay-bend/dao"
 	"vhennpay-bend/models"
 	"vhennpay-bend/utils"
+	"vhennpay-bend/utils/blob"
 	"vhennpay-bend/utils/escrow"
+	"vhennpay-bend/utils/fees"
+	"vhennpay-bend/utils/ledger"
+	"vhennpay-bend/utils/lid"
+	"vhennpay-bend/utils/pricing"
+	"vhennpay-bend/utils/scheduler"
 	"errors"
 	"fmt"
 	"log"
@@ -18,6 +25,7 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -26,9 +34,17 @@ var (
 	userDAO          *dao.UserDAO
 	factoryDAO       *dao.FactoryDAO
 	orderDAO         *dao.OrderDAO
+	reviewDAO        *dao.ReviewDAO
+	ledgerDAO        *dao.LedgerDAO
+	transferDAO      *dao.TransferDAO
+	feeDAO           *dao.FeeDAO
+	jobDAO           *dao.JobDAO
 	userService      *user.Service
 	orderService     *order.Service
 	callbacksService *callbacks.Service
+	adminService     *admin.Service
+	escrowService    *escrow.Escrow
+	jobScheduler     *scheduler.Scheduler
 	jwtSecret        string
 	dbname           = "dils"
 )
@@ -61,12 +77,13 @@ func main() {
 	initServices(client.Database(dbname))
 
 	r := initRoutes()
+	r.Use(useSocketToken)
 	r.Use(func(next http.Handler) http.Handler {
 		return handlers.LoggingHandler(os.Stdout, next)
 	})
 
 	// background services
-	go orderService.AutoCancellationJob()
+	go jobScheduler.Start()
 
 	port := os.Getenv("PORT")
 	log.Println("Running server on port", port)
@@ -91,12 +108,15 @@ func initRoutes() *mux.Router {
 	v1 := r.PathPrefix("/api/v1").Subrouter()
 	userRouter := v1.PathPrefix("/user").Subrouter()
 	ordersRouter := v1.PathPrefix("/orders").Subrouter()
+	buyOrdersRouter := v1.PathPrefix("/buy-orders").Subrouter()
 	tradesRouter := v1.PathPrefix("/trades").Subrouter()
 	supportRouter := v1.PathPrefix("/support").Subrouter()
 	callbacksRouter := v1.PathPrefix("/callbacks").Subrouter()
+	adminRouter := v1.PathPrefix("/admin").Subrouter()
 
 	//utils
 	v1.HandleFunc("/currencies", userService.Currencies).Methods("GET")
+	v1.HandleFunc("/transfers", useAuth(orderService.GetTransfers)).Methods("GET")
 	callbacksRouter.HandleFunc("/paypal-confirm",
 		callbacksService.ConfirmPaypalPayment).Methods("POST")
 
@@ -112,10 +132,21 @@ func initRoutes() *mux.Router {
 	ordersRouter.HandleFunc("", useAuth(orderService.GetUserOrders)).Methods("GET")
 	ordersRouter.HandleFunc("/create", useAuth(orderService.CreateSellOrder)).Methods("POST")
 	ordersRouter.HandleFunc("/pending", useAuth(orderService.GetPendingOrders)).Methods("GET")
+	ordersRouter.HandleFunc("/book", useAuth(orderService.GetOrderBook)).Methods("GET")
 	ordersRouter.HandleFunc("/{id}", useAuth(orderService.ViewOrder)).Methods("GET")
 	ordersRouter.HandleFunc("/{id}/cancel", useAuth(orderService.CancelOrder)).Methods("PUT")
+	ordersRouter.HandleFunc("/{id}/deposit", useAuth(orderService.SubmitDeposit)).Methods("POST")
 	ordersRouter.HandleFunc("/{id}/trades", useAuth(orderService.ViewOrderTrades)).Methods("GET")
 
+	// Buy orders
+	buyOrdersRouter.HandleFunc("", useAuth(orderService.GetUserBuyOrders)).Methods("GET")
+	buyOrdersRouter.HandleFunc("/create", useAuth(orderService.CreateBuyOrder)).Methods("POST")
+	buyOrdersRouter.HandleFunc("/pending", useAuth(orderService.GetPendingBuyOrders)).Methods("GET")
+	buyOrdersRouter.HandleFunc("/{id}", useAuth(orderService.ViewBuyOrder)).Methods("GET")
+	buyOrdersRouter.HandleFunc("/{id}/fill", useAuth(orderService.FillBuyOrder)).Methods("POST")
+	buyOrdersRouter.HandleFunc("/{id}/cancel", useAuth(orderService.CancelBuyOrder)).Methods("PUT")
+	buyOrdersRouter.HandleFunc("/{id}/trades", useAuth(orderService.ViewBuyOrderTrades)).Methods("GET")
+
 	// Trades
 	tradesRouter.HandleFunc("", useAuth(orderService.GetTrades)).Methods("GET")
 	tradesRouter.HandleFunc("/create", useAuth(orderService.CreateBuyTrade)).Methods("POST")
@@ -124,6 +155,13 @@ func initRoutes() *mux.Router {
 	tradesRouter.HandleFunc("/{id}/cancel", useAuth(orderService.CancelTrade)).Methods("PUT")
 	tradesRouter.HandleFunc("/{id}/messages", useAuth(orderService.NewMessage)).Methods("POST")
 	tradesRouter.HandleFunc("/{id}/messages", useAuth(orderService.GetTradeMessages)).Methods("GET")
+	tradesRouter.HandleFunc("/{id}/ws", useAuth(orderService.TradeChatSocket)).Methods("GET")
+	tradesRouter.HandleFunc("/{id}/attachments/{attachmentId}", useAuth(orderService.GetTradeAttachment)).Methods("GET")
+	tradesRouter.HandleFunc("/{id}/timeline", useAuth(orderService.GetTradeTimeline)).Methods("GET")
+	tradesRouter.HandleFunc("/{id}/reviews", useAuth(orderService.ReviewTrade)).Methods("POST")
+	tradesRouter.HandleFunc("/{id}/dispute", useAuth(orderService.OpenDispute)).Methods("POST")
+	tradesRouter.HandleFunc("/{id}/dispute/evidence", useAuth(orderService.AddDisputeEvidence)).Methods("POST")
+	tradesRouter.HandleFunc("/{id}/dispute", useAuth(orderService.GetTradeDispute)).Methods("GET")
 	tradesRouter.HandleFunc("/{id}", useAuth(orderService.GetBuyTrade)).Methods("GET")
 
 	// Users
@@ -136,13 +174,34 @@ func initRoutes() *mux.Router {
 	userRouter.HandleFunc("/passwords/reset", userService.ResetPassword).Methods("POST")
 	userRouter.HandleFunc("/payment-options", useAuth(userService.AddPaymentOption)).Methods("POST")
 	userRouter.HandleFunc("/payment-options/info", useAuth(userService.RetrievePaymentOption)).Methods("POST")
-	userRouter.HandleFunc("/{id}/rate", useAuth(userService.RateUser)).Methods("POST")
+	userRouter.HandleFunc("/{id}/reviews", useAuth(orderService.GetUserReviews)).Methods("GET")
 
 	userRouter.HandleFunc("/notifications", useAuth(userService.Notifications)).Methods("GET")
 	userRouter.HandleFunc("/wallets", useAuth(userService.AddWallet)).Methods("POST")
 	userRouter.HandleFunc("/wallets", useAuth(userService.GetWallets)).Methods("GET")
 	userRouter.HandleFunc("/wallets/{id}", useAuth(userService.DeleteWallet)).Methods("DELETE")
 
+	// Admin
+	adminRouter.HandleFunc("/ledger/accounts", useAdmin(adminService.GetLedgerBalances)).Methods("GET")
+	adminRouter.HandleFunc("/ledger/accounts/{account}", useAdmin(adminService.GetLedgerAccount)).Methods("GET")
+	adminRouter.HandleFunc("/ledger/accounts/{account}/entries", useAdmin(adminService.GetLedgerAccountEntries)).Methods("GET")
+	adminRouter.HandleFunc("/ledger/orders/{id}", useAdmin(adminService.GetOrderLedgerEntries)).Methods("GET")
+	adminRouter.HandleFunc("/transfers", useAdmin(adminService.GetTransfers)).Methods("GET")
+	adminRouter.HandleFunc("/transfers/{id}/resolve", useAdmin(adminService.ResolveTransfer)).Methods("PUT")
+	adminRouter.HandleFunc("/reconciliations", useAdmin(adminService.GetReconciliations)).Methods("GET")
+	adminRouter.HandleFunc("/reconciliations", useAdmin(adminService.Reconcile)).Methods("POST")
+	adminRouter.HandleFunc("/alerts", useAdmin(adminService.GetAlerts)).Methods("GET")
+	adminRouter.HandleFunc("/fees/rules", useAdmin(adminService.GetFeeRules)).Methods("GET")
+	adminRouter.HandleFunc("/fees/rules", useAdmin(adminService.CreateFeeRule)).Methods("POST")
+	adminRouter.HandleFunc("/fees/rules/{id}", useAdmin(adminService.UpdateFeeRule)).Methods("PUT")
+	adminRouter.HandleFunc("/fees/rules/{id}", useAdmin(adminService.DeleteFeeRule)).Methods("DELETE")
+	adminRouter.HandleFunc("/fees/income", useAdmin(adminService.GetFeeIncome)).Methods("GET")
+	adminRouter.HandleFunc("/users/{id}/tier", useAdmin(adminService.SetUserTier)).Methods("PUT")
+	adminRouter.HandleFunc("/jobs", useAdmin(adminService.GetJobs)).Methods("GET")
+	adminRouter.HandleFunc("/disputes", useAdmin(orderService.GetDisputes)).Methods("GET")
+	adminRouter.HandleFunc("/disputes/{id}", useAdmin(orderService.GetDispute)).Methods("GET")
+	adminRouter.HandleFunc("/disputes/{id}/ruling", useAdmin(orderService.RuleDispute)).Methods("PUT")
+
 	return r
 }
 
@@ -162,6 +221,10 @@ func initDatabase() (*mongo.Client, error) {
 
 	initCollections(ctx, client)
 
+	if err := dao.RunMigrations(client.Database(dbname)); err != nil {
+		return nil, err
+	}
+
 	return client, nil
 }
 
@@ -170,13 +233,64 @@ func initCollections(ctx context.Context, client *mongo.Client) {
 	userDAO = dao.NewUserDAO(ctx, db)
 	factoryDAO = dao.NewFactoryDAO(ctx, db)
 	orderDAO = dao.NewOrderDAO(ctx, db)
+	reviewDAO = dao.NewReviewDAO(ctx, db)
+	ledgerDAO = dao.NewLedgerDAO(ctx, db)
+	transferDAO = dao.NewTransferDAO(ctx, db)
+	feeDAO = dao.NewFeeDAO(ctx, db)
+	jobDAO = dao.NewJobDAO(ctx, db)
 }
 
 func initServices(db *mongo.Database) {
 	userService = user.NewUserService(userDAO, factoryDAO)
-	escrowSrv := escrow.InitEscrow(db)
-	orderService = order.NewOrderService(orderDAO, escrowSrv, factoryDAO)
-	callbacksService = callbacks.NewCallbacksService(factoryDAO)
+	chain := lid.NewHTTPClient(os.Getenv("LID_SERVER_ADDR"))
+	ledgerSrv := ledger.NewLedger(ledgerDAO)
+	escrowService = escrow.InitEscrow(db, ledgerSrv, transferDAO, chain)
+	feeEngine := fees.NewEngine(feeDAO, ledgerSrv)
+	attachmentsDir := os.Getenv("ATTACHMENTS_DIR")
+	if attachmentsDir == "" {
+		attachmentsDir = "attachments"
+	}
+	blobs, err := blob.NewLocalStore(attachmentsDir)
+	if err != nil {
+		log.Fatalf("failed to initialize attachment store: %v", err)
+	}
+	priceCurrency := os.Getenv("PRICE_CURRENCY")
+	if priceCurrency == "" {
+		priceCurrency = "USD"
+	}
+	prices := pricing.NewService(chain, priceCurrency, pricing.DefaultTTL, pricing.DefaultMaxAge)
+	orderService = order.NewOrderService(orderDAO, escrowService, feeEngine, blobs, prices, userDAO, reviewDAO, factoryDAO)
+	callbacksService = callbacks.NewCallbacksService(factoryDAO, feeEngine, escrowService, chain)
+	jobScheduler = scheduler.NewScheduler(jobDAO)
+	adminService = admin.NewAdminService(ledgerSrv, escrowService, feeEngine, jobScheduler, userDAO, factoryDAO)
+
+	orderService.RegisterJobs(jobScheduler)
+	escrowService.RegisterJobs(jobScheduler)
+	adminService.RegisterJobs(jobScheduler)
+}
+
+// useSocketToken takes the token query parameter off requests so it is never
+// written to the request log, browsers can't set headers on WebSocket
+// handshakes so sockets send their token there and it is moved to the
+// Authorization header for useAuth
+func useSocketToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		token := query.Get("token")
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		query.Del("token")
+		r.URL.RawQuery = query.Encode()
+		r.RequestURI = r.URL.RequestURI()
+		if r.Header.Get("Authorization") == "" && websocket.IsWebSocketUpgrade(r) {
+			r.Header.Set("Authorization", token)
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // useAuth validates a token for protected routes
@@ -226,3 +340,18 @@ func useAuth(nextHandler http.HandlerFunc) http.HandlerFunc {
 		utils.RespondWithError(w, http.StatusUnauthorized, "An authorized error occurred")
 	})
 }
+
+// useAdmin validates a token and restricts the route to admin users
+func useAdmin(nextHandler http.HandlerFunc) http.HandlerFunc {
+	return useAuth(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(models.ContextKey("user_id"))
+
+		user, err := userDAO.FindByID(userID.(string))
+		if err != nil || !user.Admin {
+			utils.RespondWithError(w, http.StatusUnauthorized, "You are not authorized")
+			return
+		}
+
+		nextHandler.ServeHTTP(w, r)
+	})
+}
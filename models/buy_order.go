@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BuyOrder represents coins a buyer wants to buy, sellers fill it and each
+// fill is sold to the buyer through a fill SellOrder funded by the seller's
+// escrow deposit
+// Buy orders go through the order statuses from pending, AmountReserved is
+// what fills in progress hold and AmountFilled what they sold to the buyer
+type BuyOrder struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id"`
+	CreatedBy      primitive.ObjectID `json:"created_by" bson:"created_by"`
+	ExRate         Money              `json:"ex_rate" bson:"ex_rate"`
+	Amount         Money              `json:"amount" bson:"amount"`
+	AmountFilled   Money              `json:"amount_filled" bson:"amount_filled"`
+	AmountLeft     Money              `json:"amount_left" bson:"amount_left"`
+	AmountReserved Money              `json:"amount_reserved" bson:"amount_reserved"`
+	Currency       string             `json:"currency" bson:"currency"`
+	WalletID       string             `json:"wallet_id" bson:"wallet_id"`
+	PaymentOptions []int32            `json:"payment_options" bson:"payment_options"`
+	Note           string             `json:"note" bson:"note"`
+	PaymentWindow  int64              `json:"payment_window_minutes" bson:"payment_window_minutes"`
+	Status         string             `json:"status" bson:"status"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Accepts reports whether the buyer accepts paying with option
+func (o BuyOrder) Accepts(option int32) bool {
+	for _, accepted := range o.PaymentOptions {
+		if accepted == option {
+			return true
+		}
+	}
+	return false
+}
+
+// BuyOrderView is a buy order joined with its buyer, as listed to sellers
+type BuyOrderView struct {
+	BuyOrder `bson:",inline"`
+	// AmountAvailable is AmountLeft less AmountReserved
+	AmountAvailable Money                  `json:"amount_available" bson:"amount_available"`
+	UserData        map[string]interface{} `json:"user_data" bson:"user_data"`
+}
+
+// BuyOrderReq represents the create buy order request payload
+type BuyOrderReq struct {
+	ExRate         Money   `json:"ex_rate"`
+	Amount         Money   `json:"amount"`
+	Currency       string  `json:"currency"`
+	WalletID       string  `json:"wallet_id"`
+	PaymentOptions []int32 `json:"payment_options"`
+	Note           string  `json:"note"`
+	// PaymentWindow is how many minutes the buyer needs to pay a fill, the
+	// default of the payment option the seller picks applies when it is zero
+	PaymentWindow int64 `json:"payment_window_minutes"`
+}
+
+// FillBuyOrderReq represents a seller's fill of a buy order, the buyer pays
+// with PaymentOption into the seller's PaymentOptionID account
+type FillBuyOrderReq struct {
+	Amount          Money  `json:"amount"`
+	WalletID        string `json:"wallet_id"`
+	PhoneNumber     string `json:"phone_number"`
+	PaymentOption   int32  `json:"payment_option"`
+	PaymentOptionID string `json:"payment_option_id"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Dispute statuses
+const (
+	DisputeOpen     = "open"
+	DisputeResolved = "resolved"
+)
+
+// DisputeRuling represents who an arbitrated dispute was settled for
+type DisputeRuling string
+
+// Dispute rulings
+const (
+	// RuleForBuyer releases the trade's escrowed coins to the buyer
+	RuleForBuyer DisputeRuling = "buyer"
+	// RuleForSeller reverses the trade's escrowed coins to the seller
+	RuleForSeller DisputeRuling = "seller"
+)
+
+// Dispute represents a disputed trade awaiting or after arbitration, the
+// trade's escrow is frozen while it is open
+type Dispute struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	TradeID      primitive.ObjectID `json:"trade_id" bson:"trade_id"`
+	OrderID      primitive.ObjectID `json:"order_id" bson:"order_id"`
+	OpenedBy     primitive.ObjectID `json:"opened_by" bson:"opened_by"`
+	OpenedByRole TradeActor         `json:"opened_by_role" bson:"opened_by_role"`
+	Reason       string             `json:"reason" bson:"reason"`
+	Status       string             `json:"status" bson:"status"`
+	Ruling       DisputeRuling      `json:"ruling,omitempty" bson:"ruling,omitempty"`
+	RulingNote   string             `json:"ruling_note,omitempty" bson:"ruling_note,omitempty"`
+	ResolvedBy   primitive.ObjectID `json:"resolved_by,omitempty" bson:"resolved_by,omitempty"`
+	ResolvedAt   time.Time          `json:"resolved_at,omitempty" bson:"resolved_at,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// DisputeEvidence is a message submitted to a dispute by a party or an admin
+type DisputeEvidence struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	DisputeID primitive.ObjectID `json:"dispute_id" bson:"dispute_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Role      TradeActor         `json:"role" bson:"role"`
+	Message   string             `json:"message" bson:"message"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// DisputeView is a dispute with its trade and evidence
+type DisputeView struct {
+	Dispute  Dispute           `json:"dispute"`
+	Trade    BuyTrade          `json:"trade"`
+	Evidence []DisputeEvidence `json:"evidence"`
+}
+
+// OpenDisputeReq represents the request payload to dispute a trade, Message
+// is recorded as the first evidence
+type OpenDisputeReq struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// DisputeEvidenceReq represents an evidence message sent to a dispute
+type DisputeEvidenceReq struct {
+	Message string `json:"message"`
+}
+
+// DisputeRulingReq represents an admin ruling on a dispute
+type DisputeRulingReq struct {
+	Ruling DisputeRuling `json:"ruling"`
+	Note   string        `json:"note"`
+}
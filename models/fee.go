@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FeeScope represents what a fee rule is charged on
+type FeeScope string
+
+// Fee scopes
+const (
+	// FeeScopeTrade fees are taken from a trade when it is released
+	FeeScopeTrade FeeScope = "trade"
+	// FeeScopeICO fees are taken from the coins of an ICO purchase
+	FeeScopeICO FeeScope = "ico"
+)
+
+// User tiers, users without a tier are charged at TierStandard
+const (
+	TierStandard = "standard"
+	TierVerified = "verified"
+	TierPro      = "pro"
+)
+
+// FeeSchedule is a percent and a flat part, Percent is a percentage so 0.5
+// charges half a percent, Flat is in QC
+type FeeSchedule struct {
+	Percent Money `json:"percent" bson:"percent"`
+	Flat    Money `json:"flat" bson:"flat"`
+}
+
+var hundred = MoneyFromFloat(100)
+
+// Apply returns the fee charged on amount, it is never more than amount
+// ErrInvalidMoney is returned when amount is too large to work the fee out
+func (f FeeSchedule) Apply(amount Money) (Money, error) {
+	fee, err := amount.Mul(f.Percent)
+	if err != nil {
+		return 0, err
+	}
+	fee, err = fee.Div(hundred)
+	if err != nil {
+		return 0, err
+	}
+
+	fee = fee.Add(f.Flat).Round(QC)
+	if fee.Cmp(amount) > 0 {
+		return amount, nil
+	}
+	if fee < 0 {
+		return 0, nil
+	}
+	return fee, nil
+}
+
+// FeeRule sets the fee schedule for a scope, Currency, PaymentOption and
+// Tier narrow down where it applies and are wildcards when empty, the most
+// specific active rule wins
+type FeeRule struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	Scope         FeeScope           `json:"scope" bson:"scope"`
+	Currency      string             `json:"currency" bson:"currency"`
+	PaymentOption *PaymentOption     `json:"payment_option" bson:"payment_option"`
+	Tier          string             `json:"tier" bson:"tier"`
+	FeeSchedule   `bson:",inline"`
+	Active        bool      `json:"active" bson:"active"`
+	CreatedAt     time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// FeeRuleReq represents the request payload to create or update a fee rule
+type FeeRuleReq struct {
+	Scope         FeeScope       `json:"scope"`
+	Currency      string         `json:"currency"`
+	PaymentOption *PaymentOption `json:"payment_option"`
+	Tier          string         `json:"tier"`
+	Percent       Money          `json:"percent"`
+	Flat          Money          `json:"flat"`
+	Active        bool           `json:"active"`
+}
+
+// UserTierReq represents an admin change of a user's fee tier
+type UserTierReq struct {
+	Tier string `json:"tier"`
+}
+
+// FeeQuery describes a charge to find the fee rule for
+type FeeQuery struct {
+	Scope         FeeScope
+	Currency      string
+	PaymentOption PaymentOption
+	Tier          string
+}
+
+// FeeIncome is the fee income of a period
+type FeeIncome struct {
+	Period    string `json:"period" bson:"_id"`
+	TradeFees Money  `json:"trade_fees" bson:"trade_fees"`
+	ICOFees   Money  `json:"ico_fees" bson:"ico_fees"`
+	Total     Money  `json:"total" bson:"-"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Job represents a scheduled background job, Name is its id
+// A job runs on one instance at a time, the instance holding the lease
+// LeaseOwner until LeaseUntil, failed runs are retried with backoff
+type Job struct {
+	Name                string    `json:"name" bson:"_id"`
+	IntervalSeconds     int64     `json:"interval_seconds" bson:"interval_seconds"`
+	LeaseOwner          string    `json:"lease_owner" bson:"lease_owner"`
+	LeaseUntil          time.Time `json:"lease_until" bson:"lease_until"`
+	NextRunAt           time.Time `json:"next_run_at" bson:"next_run_at"`
+	LastRunAt           time.Time `json:"last_run_at" bson:"last_run_at"`
+	LastSuccessAt       time.Time `json:"last_success_at" bson:"last_success_at"`
+	LastError           string    `json:"last_error" bson:"last_error"`
+	LastDurationMs      int64     `json:"last_duration_ms" bson:"last_duration_ms"`
+	TotalDurationMs     int64     `json:"total_duration_ms" bson:"total_duration_ms"`
+	Runs                int64     `json:"runs" bson:"runs"`
+	Failures            int64     `json:"failures" bson:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures" bson:"consecutive_failures"`
+	CreatedAt           time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// JobRun is the outcome of a job run
+type JobRun struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	Err       error
+	NextRunAt time.Time
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LedgerAccountType represents the kind of a ledger account
+type LedgerAccountType string
+
+// Ledger account types
+const (
+	// EscrowWalletAccount mirrors the on-chain ESCROW_WALLET balance
+	EscrowWalletAccount LedgerAccountType = "escrow_wallet"
+	// SellerHoldAccount holds a seller's deposit for a single order
+	SellerHoldAccount LedgerAccountType = "seller_hold"
+	// BuyerPayoutAccount holds amounts released to a buyer
+	BuyerPayoutAccount LedgerAccountType = "buyer_payout"
+	// SellerRefundAccount holds amounts reversed back to a seller
+	SellerRefundAccount LedgerAccountType = "seller_refund"
+	// FeesAccount collects platform fee income
+	FeesAccount LedgerAccountType = "fees"
+	// FeeWalletAccount mirrors the on-chain FEE_WALLET balance
+	FeeWalletAccount LedgerAccountType = "fee_wallet"
+	// ICOWalletAccount holds the fees taken on ICO purchases until they are
+	// swept from the ICO_WALLET to the fee wallet
+	ICOWalletAccount LedgerAccountType = "ico_wallet"
+)
+
+// JournalEntryKind represents the business event behind a journal entry
+type JournalEntryKind string
+
+// Journal entry kinds
+const (
+	EntryDeposit  JournalEntryKind = "deposit"
+	EntryRelease  JournalEntryKind = "release"
+	EntryReversal JournalEntryKind = "reversal"
+	// EntryPayout records a release leaving the escrow wallet on-chain
+	EntryPayout JournalEntryKind = "payout"
+	// EntryRefund records a reversal leaving the escrow wallet on-chain
+	EntryRefund JournalEntryKind = "refund"
+	// EntryFeeSweep records fees leaving the escrow or ICO wallet for the fee
+	// wallet
+	EntryFeeSweep JournalEntryKind = "fee_sweep"
+	// EntryICOFee records the fee taken on an ICO purchase
+	EntryICOFee JournalEntryKind = "ico_fee"
+)
+
+// DebitNormal reports whether an account of this type grows with debits
+// (assets) rather than credits (liabilities and income)
+func (t LedgerAccountType) DebitNormal() bool {
+	return t == EscrowWalletAccount || t == FeeWalletAccount || t == ICOWalletAccount
+}
+
+// LedgerAccount identifies a ledger account, an empty Owner denotes a
+// platform wide account
+type LedgerAccount struct {
+	Type  LedgerAccountType `json:"type" bson:"type"`
+	Owner string            `json:"owner,omitempty" bson:"owner,omitempty"`
+}
+
+// Code returns the unique account code (type or type:owner)
+func (a LedgerAccount) Code() string {
+	if a.Owner == "" {
+		return string(a.Type)
+	}
+	return string(a.Type) + ":" + a.Owner
+}
+
+// ParseLedgerAccount parses an account code as returned by Code
+func ParseLedgerAccount(code string) LedgerAccount {
+	parts := strings.SplitN(code, ":", 2)
+	account := LedgerAccount{Type: LedgerAccountType(parts[0])}
+	if len(parts) > 1 {
+		account.Owner = parts[1]
+	}
+	return account
+}
+
+// Posting is a single debit or credit line of a journal entry
+type Posting struct {
+	Account     string            `json:"account" bson:"account"`
+	AccountType LedgerAccountType `json:"account_type" bson:"account_type"`
+	Debit       Money             `json:"debit" bson:"debit"`
+	Credit      Money             `json:"credit" bson:"credit"`
+}
+
+// JournalEntry is an immutable, balanced set of postings, Reference is unique
+// so the same business event is never recorded twice
+type JournalEntry struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Reference string             `json:"reference" bson:"reference"`
+	Kind      JournalEntryKind   `json:"kind" bson:"kind"`
+	OrderID   primitive.ObjectID `json:"order_id" bson:"order_id"`
+	TradeID   primitive.ObjectID `json:"trade_id,omitempty" bson:"trade_id,omitempty"`
+	Memo      string             `json:"memo" bson:"memo"`
+	Postings  []Posting          `json:"postings" bson:"postings"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AccountBalance summarises the postings made against an account
+type AccountBalance struct {
+	Account     string            `json:"account" bson:"_id"`
+	AccountType LedgerAccountType `json:"account_type" bson:"account_type"`
+	Debits      Money             `json:"debits" bson:"debits"`
+	Credits     Money             `json:"credits" bson:"credits"`
+	Balance     Money             `json:"balance" bson:"-"`
+	Entries     int64             `json:"entries" bson:"entries"`
+}
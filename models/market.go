@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// MarketWindow is how far back an order book's trade volume goes
+const MarketWindow = 24 * time.Hour
+
+// PriceLevel is the amount listed at one exchange rate and how many orders
+// list it
+type PriceLevel struct {
+	ExRate Money `json:"ex_rate" bson:"ex_rate"`
+	Amount Money `json:"amount" bson:"amount"`
+	Orders int   `json:"orders" bson:"orders"`
+}
+
+// MarketVolume is what trades released on a currency's orders since a point
+// in time sold, Value is its worth in the currency and LastRate the
+// exchange rate of the latest of them
+type MarketVolume struct {
+	Currency string `json:"-" bson:"_id"`
+	Amount   Money  `json:"amount" bson:"amount"`
+	Value    Money  `json:"value" bson:"value"`
+	Trades   int    `json:"trades" bson:"trades"`
+	LastRate Money  `json:"last_rate" bson:"last_rate"`
+}
+
+// OrderBook is the market for a currency, Asks are the amounts available on
+// pending sell orders cheapest first and Bids what pending buy orders still
+// want dearest first
+// BestAsk, BestBid and Spread are zero when a side of the book is empty,
+// Volume covers the MarketWindow up to UpdatedAt
+type OrderBook struct {
+	Currency  string       `json:"currency"`
+	Asks      []PriceLevel `json:"asks"`
+	Bids      []PriceLevel `json:"bids"`
+	AskDepth  Money        `json:"ask_depth"`
+	BidDepth  Money        `json:"bid_depth"`
+	BestAsk   Money        `json:"best_ask"`
+	BestBid   Money        `json:"best_bid"`
+	Spread    Money        `json:"spread"`
+	Volume    MarketVolume `json:"volume_24h"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
@@ -6,15 +6,53 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// TradeChat ...
+// TradeChat is a message between a trade's parties, ImageURL is set for
+// messages with an image attached
 type TradeChat struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id"`
-	TradeID   primitive.ObjectID `json:"trade_id" bson:"trade_id"`
-	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
-	Message   string             `json:"message" bson:"message"`
-	ImageURL  string             `json:"image_url"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	TradeID    primitive.ObjectID `json:"trade_id" bson:"trade_id"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Message    string             `json:"message" bson:"message"`
+	ImageURL   string             `json:"image_url" bson:"image_url"`
+	Attachment *TradeAttachment   `json:"attachment,omitempty" bson:"attachment,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// TradeAttachment is a file attached to a trade chat message, such as a
+// payment receipt, Key and ThumbnailKey locate it and its thumbnail in the
+// blob store while URL and ThumbnailURL download them for the trade's parties
+type TradeAttachment struct {
+	ID           primitive.ObjectID `json:"id" bson:"id"`
+	Name         string             `json:"name" bson:"name"`
+	ContentType  string             `json:"content_type" bson:"content_type"`
+	Size         int64              `json:"size" bson:"size"`
+	Key          string             `json:"-" bson:"key"`
+	ThumbnailKey string             `json:"-" bson:"thumbnail_key,omitempty"`
+	URL          string             `json:"url" bson:"url"`
+	ThumbnailURL string             `json:"thumbnail_url,omitempty" bson:"thumbnail_url,omitempty"`
+}
+
+// Chat event types, clients send message and typing events over a trade's
+// chat socket and receive every type
+const (
+	ChatEventMessage = "message"
+	ChatEventTyping  = "typing"
+	ChatEventStatus  = "status"
+	ChatEventError   = "error"
+)
+
+// ChatEvent is a frame sent over a trade's chat socket, Text is the text of
+// a message sent by a client and Message the saved message sent to clients
+type ChatEvent struct {
+	Type    string      `json:"type"`
+	TradeID string      `json:"trade_id,omitempty"`
+	UserID  string      `json:"user_id,omitempty"`
+	Text    string      `json:"text,omitempty"`
+	Message *TradeChat  `json:"message,omitempty"`
+	Status  string      `json:"status,omitempty"`
+	Action  TradeAction `json:"action,omitempty"`
+	Error   string      `json:"error,omitempty"`
 }
 
 // SupportChat ...
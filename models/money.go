@@ -0,0 +1,275 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// MoneyScale is the number of decimal places every Money value carries
+const MoneyScale = 8
+
+var scaleFactor = big.NewInt(100000000)
+
+// ErrInvalidMoney is returned when a value can't be read as Money
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// Money is a fixed-point decimal amount with MoneyScale decimal places
+// It is stored as a BSON Decimal128 and sent over JSON as a string
+type Money int64
+
+// Asset describes a currency or coin and the precision it settles in
+type Asset struct {
+	Code      string `json:"code"`
+	Precision int    `json:"precision"`
+}
+
+// QC is the Quicoin asset
+var QC = Asset{Code: "QC", Precision: 8}
+
+// zeroDecimalCurrencies settle in whole units
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true,
+}
+
+// FiatAsset returns the asset for a fiat currency code
+func FiatAsset(code string) Asset {
+	code = strings.ToUpper(code)
+	if zeroDecimalCurrencies[code] {
+		return Asset{Code: code, Precision: 0}
+	}
+	return Asset{Code: code, Precision: 2}
+}
+
+// ParseMoney reads a decimal string such as "12.5"
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidMoney
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, ErrInvalidMoney
+	}
+
+	return moneyFromRat(r)
+}
+
+// MoneyFromFloat converts a float, rounding half away from zero
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * math.Pow10(MoneyScale)))
+}
+
+// Float64 returns the nearest float, for display and logging only
+func (m Money) Float64() float64 {
+	return float64(m) / math.Pow10(MoneyScale)
+}
+
+// String returns the decimal representation without trailing zeros
+func (m Money) String() string {
+	neg := m < 0
+	u := uint64(m)
+	if neg {
+		u = uint64(-m)
+	}
+
+	s := strconv.FormatUint(u, 10)
+	for len(s) <= MoneyScale {
+		s = "0" + s
+	}
+	whole, frac := s[:len(s)-MoneyScale], strings.TrimRight(s[len(s)-MoneyScale:], "0")
+
+	if frac != "" {
+		whole += "." + frac
+	}
+	if neg {
+		whole = "-" + whole
+	}
+	return whole
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) Money {
+	return m + o
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) Money {
+	return m - o
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return -m
+}
+
+// Cmp compares m and o and returns -1, 0 or +1
+func (m Money) Cmp(o Money) int {
+	switch {
+	case m < o:
+		return -1
+	case m > o:
+		return 1
+	}
+	return 0
+}
+
+// IsZero reports whether m is zero
+func (m Money) IsZero() bool {
+	return m == 0
+}
+
+// IsPositive reports whether m is greater than zero
+func (m Money) IsPositive() bool {
+	return m > 0
+}
+
+// Round rounds m half away from zero to the precision of asset
+func (m Money) Round(asset Asset) Money {
+	if asset.Precision >= MoneyScale {
+		return m
+	}
+
+	unit := int64(math.Pow10(MoneyScale - asset.Precision))
+	v := int64(m)
+	rem := v % unit
+	v -= rem
+	if rem*2 >= unit {
+		v += unit
+	} else if rem*2 <= -unit {
+		v -= unit
+	}
+	return Money(v)
+}
+
+// Mul returns m * o, rounded half away from zero to MoneyScale
+// ErrInvalidMoney is returned when the product doesn't fit in Money
+func (m Money) Mul(o Money) (Money, error) {
+	r := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(o))), scaleFactor)
+	r.Quo(r, new(big.Rat).SetInt(scaleFactor))
+	return moneyFromRat(r)
+}
+
+// Div returns m / o, rounded half away from zero to MoneyScale
+// ErrInvalidMoney is returned when o is zero or the quotient doesn't fit in
+// Money
+func (m Money) Div(o Money) (Money, error) {
+	if o == 0 {
+		return 0, ErrInvalidMoney
+	}
+	r := new(big.Rat).SetFrac(big.NewInt(int64(m)), big.NewInt(int64(o)))
+	return moneyFromRat(r)
+}
+
+// MarshalJSON encodes m as a JSON string
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON reads m from a JSON string or number
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*m = 0
+		return nil
+	}
+
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// MarshalBSONValue encodes m as a Decimal128
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	d, ok := primitive.ParseDecimal128FromBigInt(big.NewInt(int64(m)), -MoneyScale)
+	if !ok {
+		return 0, nil, fmt.Errorf("money %s does not fit a decimal128", m)
+	}
+	return bsontype.Decimal128, bsoncore.AppendDecimal128(nil, d), nil
+}
+
+// UnmarshalBSONValue reads m from a Decimal128, double or integer so
+// documents written before the Decimal128 migration still decode
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Decimal128:
+		d, _, ok := bsoncore.ReadDecimal128(data)
+		if !ok {
+			return ErrInvalidMoney
+		}
+		bi, exp, err := d.BigInt()
+		if err != nil {
+			return err
+		}
+		r := new(big.Rat).SetInt(bi)
+		scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil))
+		if exp < 0 {
+			r.Quo(r, scale)
+		} else {
+			r.Mul(r, scale)
+		}
+		v, err := moneyFromRat(r)
+		if err != nil {
+			return err
+		}
+		*m = v
+	case bsontype.Double:
+		f, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return ErrInvalidMoney
+		}
+		*m = MoneyFromFloat(f)
+	case bsontype.Int32:
+		i, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return ErrInvalidMoney
+		}
+		*m = Money(int64(i) * scaleFactor.Int64())
+	case bsontype.Int64:
+		i, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return ErrInvalidMoney
+		}
+		*m = Money(i * scaleFactor.Int64())
+	case bsontype.Null, bsontype.Undefined:
+		*m = 0
+	default:
+		return fmt.Errorf("cannot decode %v into money", t)
+	}
+	return nil
+}
+
+// moneyFromRat scales r to MoneyScale, rounding half away from zero
+func moneyFromRat(r *big.Rat) (Money, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(scaleFactor))
+
+	num, den := scaled.Num(), scaled.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+
+	if !q.IsInt64() {
+		return 0, ErrInvalidMoney
+	}
+	return Money(q.Int64()), nil
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
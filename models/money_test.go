@@ -0,0 +1,133 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := map[string]string{
+		"12.5":        "12.5",
+		"0.1":         "0.1",
+		"-3":          "-3",
+		"0.000000015": "0.00000002",
+		"1.00":        "1",
+	}
+	for in, want := range cases {
+		m, err := ParseMoney(in)
+		if err != nil {
+			t.Fatalf("ParseMoney(%q): %v", in, err)
+		}
+		if got := m.String(); got != want {
+			t.Errorf("ParseMoney(%q) = %s, want %s", in, got, want)
+		}
+	}
+
+	if _, err := ParseMoney("abc"); err != ErrInvalidMoney {
+		t.Errorf("ParseMoney(abc) err = %v, want ErrInvalidMoney", err)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a, _ := ParseMoney("0.1")
+	b, _ := ParseMoney("0.2")
+	c, _ := ParseMoney("0.3")
+	if a.Add(b) != c {
+		t.Errorf("0.1 + 0.2 = %s, want 0.3", a.Add(b))
+	}
+	if c.Sub(a).Sub(b) != 0 {
+		t.Errorf("0.3 - 0.1 - 0.2 = %s, want 0", c.Sub(a).Sub(b))
+	}
+
+	ten, _ := ParseMoney("10")
+	three, _ := ParseMoney("3")
+	third, err := ten.Div(three)
+	if err != nil {
+		t.Fatalf("10 / 3: %v", err)
+	}
+	if got := third.String(); got != "3.33333333" {
+		t.Errorf("10 / 3 = %s, want 3.33333333", got)
+	}
+	if got := third.Round(FiatAsset("usd")).String(); got != "3.33" {
+		t.Errorf("round(10 / 3) = %s, want 3.33", got)
+	}
+	if got := third.Round(FiatAsset("jpy")).String(); got != "3" {
+		t.Errorf("round(10 / 3) = %s, want 3", got)
+	}
+	if got, err := ten.Mul(three); err != nil || got.String() != "30" {
+		t.Errorf("10 * 3 = %s (%v), want 30", got, err)
+	}
+}
+
+func TestMoneyOverflow(t *testing.T) {
+	huge, _ := ParseMoney("50000000000")
+	tiny, _ := ParseMoney("0.00000001")
+
+	if got, err := huge.Mul(huge); err != ErrInvalidMoney {
+		t.Errorf("overflowing Mul = %s, %v, want ErrInvalidMoney", got, err)
+	}
+	if got, err := huge.Div(tiny); err != ErrInvalidMoney {
+		t.Errorf("overflowing Div = %s, %v, want ErrInvalidMoney", got, err)
+	}
+	if got, err := huge.Div(0); err != ErrInvalidMoney {
+		t.Errorf("Div by zero = %s, %v, want ErrInvalidMoney", got, err)
+	}
+}
+
+func TestMoneyEncoding(t *testing.T) {
+	type doc struct {
+		Amount Money `json:"amount" bson:"amount"`
+	}
+	m, _ := ParseMoney("1234.56789")
+
+	b, _ := json.Marshal(doc{m})
+	if string(b) != `{"amount":"1234.56789"}` {
+		t.Errorf("json = %s", b)
+	}
+
+	var fromNumber doc
+	if err := json.Unmarshal([]byte(`{"amount":1234.56789}`), &fromNumber); err != nil || fromNumber.Amount != m {
+		t.Errorf("json number decoded to %s (%v), want %s", fromNumber.Amount, err, m)
+	}
+
+	raw, err := bson.Marshal(doc{m})
+	if err != nil {
+		t.Fatalf("bson marshal: %v", err)
+	}
+	var out doc
+	if err := bson.Unmarshal(raw, &out); err != nil || out.Amount != m {
+		t.Errorf("bson round trip = %s (%v), want %s", out.Amount, err, m)
+	}
+
+	// documents written before the Decimal128 migration hold doubles
+	legacy, _ := bson.Marshal(bson.M{"amount": 0.1})
+	if err := bson.Unmarshal(legacy, &out); err != nil || out.Amount.String() != "0.1" {
+		t.Errorf("legacy double decoded to %s (%v), want 0.1", out.Amount, err)
+	}
+}
+
+func TestFeeScheduleApply(t *testing.T) {
+	schedule := FeeSchedule{Percent: MoneyFromFloat(1.5), Flat: MoneyFromFloat(0.25)}
+
+	tests := []struct {
+		amount, want Money
+	}{
+		{MoneyFromFloat(100), MoneyFromFloat(1.75)},
+		{MoneyFromFloat(0.2), MoneyFromFloat(0.2)},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		if got, err := schedule.Apply(tt.amount); err != nil || got != tt.want {
+			t.Errorf("Apply(%s) = %s (%v), want %s", tt.amount, got, err, tt.want)
+		}
+	}
+	if got, err := (FeeSchedule{}).Apply(MoneyFromFloat(10)); err != nil || !got.IsZero() {
+		t.Errorf("empty schedule charged %s (%v)", got, err)
+	}
+	if got, err := schedule.Apply(Money(math.MaxInt64)); err != ErrInvalidMoney {
+		t.Errorf("Apply(max) = %s, %v, want ErrInvalidMoney", got, err)
+	}
+}
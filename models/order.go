@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -8,19 +9,44 @@ import (
 
 // Order statuses
 const (
-	OrderPending   = "pending"
+	// OrderFunding orders are waiting for their escrow deposit to settle
+	OrderFunding = "funding"
+	OrderPending = "pending"
+	// OrderClosing orders were cancelled while trades were in progress, they
+	// are cancelled once those trades finish
+	OrderClosing   = "closing"
 	OrderCancelled = "cancelled"
 	OrderCompleted = "completed"
+	// OrderFailed orders never got their escrow deposit
+	OrderFailed = "failed"
 )
 
-// Trade statuses
+// Trade statuses, see TradeTransitions for the moves between them
 const (
-	TradeInProgress = "in-progress"
-	TradePending    = "pending"
-	TradeProcessed  = "processed"
-	TradeCancelled  = "cancelled"
+	// TradeOpened trades are waiting for the buyer to pay
+	TradeOpened = "opened"
+	// TradePaid trades were marked paid by the buyer
+	TradePaid = "paid"
+	// TradeReleased trades had their coins released to the buyer
+	TradeReleased  = "released"
+	TradeCancelled = "cancelled"
+	// TradeDisputed trades are waiting for their dispute to be settled
+	TradeDisputed = "disputed"
+	// TradeExpired trades weren't paid in time
+	TradeExpired = "expired"
 )
 
+// Order price types, fixed orders sell at their ExRate and floating orders
+// at a Margin over the reference price
+const (
+	PriceFixed    = "fixed"
+	PriceFloating = "floating"
+)
+
+// MaxPriceMargin bounds the percent margin of floating orders either side of
+// the reference price
+const MaxPriceMargin Money = 50 * 100000000
+
 // CancelReason ...
 type CancelReason uint
 
@@ -30,14 +56,25 @@ const (
 	AutoCancellation
 )
 
-// SellOrder ...
+// SellOrder represents coins listed for sale, Fee is the fee schedule its
+// trades are charged at, fixed when the order is listed
+// Orders with a BuyOrderID are fills of that buy order, they aren't listed
+// and their whole amount is sold to the buy order's buyer in a single trade
+// Floating orders are priced at Margin percent over the reference price,
+// kept between FloorRate and CeilingRate when they are set, their ExRate is
+// the rate last worked out, Limits are the seller's rules for its trades
 type SellOrder struct {
 	ID                primitive.ObjectID `json:"id" bson:"_id"`
 	CreatedBy         primitive.ObjectID `json:"created_by" bson:"created_by"`
-	ExRate            float64            `json:"ex_rate" bson:"ex_rate"`
-	Amount            float64            `json:"amount" bson:"amount"`
-	AmountSold        float64            `json:"amount_sold" bson:"amount_sold"`
-	AmountLeft        float64            `json:"amount_left" bson:"amount_left"`
+	ExRate            Money              `json:"ex_rate" bson:"ex_rate"`
+	PriceType         string             `json:"price_type" bson:"price_type"`
+	Margin            Money              `json:"margin" bson:"margin"`
+	FloorRate         Money              `json:"floor_rate" bson:"floor_rate"`
+	CeilingRate       Money              `json:"ceiling_rate" bson:"ceiling_rate"`
+	Amount            Money              `json:"amount" bson:"amount"`
+	AmountSold        Money              `json:"amount_sold" bson:"amount_sold"`
+	AmountLeft        Money              `json:"amount_left" bson:"amount_left"`
+	AmountReserved    Money              `json:"amount_reserved" bson:"amount_reserved"`
 	Currency          string             `json:"currency" bson:"currency"`
 	PhoneNumber       string             `json:"phone_number" bson:"phone_number"`
 	WalletID          string             `json:"wallet_id" bson:"wallet_id"`
@@ -45,29 +82,141 @@ type SellOrder struct {
 	PaymentOptionID   primitive.ObjectID `json:"payment_option_id" bson:"payment_option_id"`
 	PaymentOptionData interface{}        `json:"payment_option_data" bson:"-"`
 	Note              string             `json:"note" bson:"note"`
+	Fee               FeeSchedule        `json:"fee" bson:"fee"`
+	PaymentWindow     int64              `json:"payment_window_minutes" bson:"payment_window_minutes"`
+	Limits            TradeLimits        `json:"limits" bson:"limits"`
+	BuyOrderID        primitive.ObjectID `json:"buy_order_id,omitempty" bson:"buy_order_id,omitempty"`
 	Status            string             `json:"status" bson:"status"`
 	CreatedAt         time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt         time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
-// BuyTrade represents an initiated sell trade
+// PaymentDeadline returns how long buyers have to pay a trade on the order
+func (o SellOrder) PaymentDeadline() time.Duration {
+	if o.PaymentWindow <= 0 {
+		return DefaultPaymentWindow(PaymentOption(o.PaymentOption))
+	}
+	return time.Duration(o.PaymentWindow) * time.Minute
+}
+
+// Floating reports whether the order is priced off the reference price
+func (o SellOrder) Floating() bool {
+	return o.PriceType == PriceFloating
+}
+
+// FloatingRate returns the rate of a floating order when one Quicoin is
+// priced at reference, rounded to the currency's precision
+func (o SellOrder) FloatingRate(reference Money) (Money, error) {
+	margin, err := reference.Mul(o.Margin)
+	if err != nil {
+		return 0, err
+	}
+	margin, err = margin.Div(100 * 100000000)
+	if err != nil {
+		return 0, err
+	}
+
+	rate := reference.Add(margin)
+	if o.FloorRate.IsPositive() && rate.Cmp(o.FloorRate) < 0 {
+		rate = o.FloorRate
+	}
+	if o.CeilingRate.IsPositive() && rate.Cmp(o.CeilingRate) > 0 {
+		rate = o.CeilingRate
+	}
+	return rate.Round(FiatAsset(o.Currency)), nil
+}
+
+// Quote works out a trade on the order from either its QC amount or the
+// fiat amount the buyer pays at ExRate, whichever is given, the QC amount is
+// rounded to QC precision and the fiat amount to the currency's
+// Orders without a positive ExRate have no fiat value, ErrInvalidMoney is
+// returned when an amount is too large to be quoted
+func (o SellOrder) Quote(amount, fiat Money) (Money, Money, error) {
+	if !o.ExRate.IsPositive() {
+		return amount, 0, nil
+	}
+	asset := FiatAsset(o.Currency)
+	if fiat.IsPositive() && amount.IsZero() {
+		fiat = fiat.Round(asset)
+		amount, err := fiat.Div(o.ExRate)
+		if err != nil {
+			return 0, 0, err
+		}
+		return amount.Round(QC), fiat, nil
+	}
+	fiat, err := amount.Mul(o.ExRate)
+	if err != nil {
+		return 0, 0, err
+	}
+	return amount, fiat.Round(asset), nil
+}
+
+// SellOrderView is a sell order joined with its seller, as listed to buyers,
+// Ineligible is the error code of the order's limits refusing the buyer it
+// is listed to
+type SellOrderView struct {
+	SellOrder `bson:",inline"`
+	// AmountAvailable is AmountLeft less AmountReserved
+	AmountAvailable Money                  `json:"amount_available" bson:"amount_available"`
+	UserData        map[string]interface{} `json:"user_data" bson:"user_data"`
+	Eligible        bool                   `json:"eligible" bson:"-"`
+	Ineligible      string                 `json:"ineligible,omitempty" bson:"-"`
+}
+
+// BuyTrade represents an initiated sell trade, PayBy is when an opened trade
+// expires and ReleaseBy is when a paid trade the seller hasn't released is
+// escalated to support
+// PayRemindedAt and ReleaseRemindedAt record when the buyer was reminded to
+// pay and the seller to release
+// FiatAmount is what the buyer owes the seller in Currency for Amount at
+// ExRate, the order's rate when the trade was opened
 type BuyTrade struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id"`
 	SellerID    primitive.ObjectID `json:"seller_id" bson:"seller_id"`
 	BuyerID     primitive.ObjectID `json:"buyer_id" bson:"buyer_id"`
 	OrderID     primitive.ObjectID `json:"order_id" bson:"order_id"`
+	BuyOrderID  primitive.ObjectID `json:"buy_order_id,omitempty" bson:"buy_order_id,omitempty"`
 	BuyerWallet string             `json:"buyer_wallet" bson:"buyer_wallet"`
-	Amount      float64            `json:"amount" bson:"amount"`
-	Confirmed   bool               `json:"confirmed" bson:"confirmed"`
-	MarkPaid    bool               `json:"mark_paid" bson:"mark_paid"`
+	Amount      Money              `json:"amount" bson:"amount"`
+	FiatAmount  Money              `json:"fiat_amount" bson:"fiat_amount"`
+	Currency    string             `json:"currency" bson:"currency"`
+	ExRate      Money              `json:"ex_rate" bson:"ex_rate"`
+	Fee         Money              `json:"fee" bson:"fee"`
+	NetAmount   Money              `json:"net_amount" bson:"net_amount"`
 	Rating      uint               `json:"rating" bson:"rating"`
 	// LockTime to indicate when order was shown interest (buy/sell interest-action)
-	LockTime     time.Time `json:"lock_time" bson:"lock_time"`
-	Status       string    `json:"status" bson:"status"`
-	ProcessedAt  time.Time `json:"processed_at" bson:"processed_at"`
-	CancelReason `json:"cancel_reason" bson:"cancel_reason"`
-	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+	LockTime          time.Time `json:"lock_time" bson:"lock_time"`
+	Status            string    `json:"status" bson:"status"`
+	PayBy             time.Time `json:"pay_by" bson:"pay_by"`
+	PaidAt            time.Time `json:"paid_at" bson:"paid_at"`
+	PayRemindedAt     time.Time `json:"pay_reminded_at" bson:"pay_reminded_at"`
+	ReleaseRemindedAt time.Time `json:"release_reminded_at" bson:"release_reminded_at"`
+	ReleaseBy         time.Time `json:"release_by" bson:"release_by"`
+	ProcessedAt       time.Time `json:"processed_at" bson:"processed_at"`
+	CancelReason      `json:"cancel_reason" bson:"cancel_reason"`
+	CreatedAt         time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" bson:"updated_at"`
+	// Settling is set when a trade is closed and cleared once the escrow
+	// transfer closing it has been queued
+	Settling bool `json:"settling,omitempty" bson:"settling,omitempty"`
+}
+
+// AmountText describes the trade's amount for messages, with the fiat
+// amount owed when it is known
+func (t BuyTrade) AmountText() string {
+	if !t.FiatAmount.IsPositive() {
+		return t.Amount.String() + "QC"
+	}
+	return t.Amount.String() + "QC (" + t.FiatText() + ")"
+}
+
+// FiatText describes the fiat amount owed on the trade, it is empty when the
+// amount isn't known
+func (t BuyTrade) FiatText() string {
+	if !t.FiatAmount.IsPositive() {
+		return ""
+	}
+	return t.FiatAmount.String() + " " + strings.ToUpper(t.Currency)
 }
 
 // NewMessageReq ...
@@ -77,25 +226,62 @@ type NewMessageReq struct {
 
 // SellOrderReq ...
 type SellOrderReq struct {
-	ExRate           float64 `json:"ex_rate"`
-	Amount           float64 `json:"amount"`
-	Currency         string  `json:"currency"`
-	PhoneNumber      string  `json:"phone_number"`
-	WalletID         string  `json:"wallet_id" `
-	PaymentOption    int32   `json:"payment_option"`
-	PaymentOptionID  string  `json:"payment_option_id"`
-	WalletPrivateKey string  `json:"wallet_private_key"`
-	Note             string  `json:"note"`
+	ExRate          Money  `json:"ex_rate"`
+	Amount          Money  `json:"amount"`
+	Currency        string `json:"currency"`
+	PhoneNumber     string `json:"phone_number"`
+	WalletID        string `json:"wallet_id" `
+	PaymentOption   int32  `json:"payment_option"`
+	PaymentOptionID string `json:"payment_option_id"`
+	Note            string `json:"note"`
+	// PaymentWindow is how many minutes buyers have to pay, the payment
+	// option's default applies when it is zero
+	PaymentWindow int64 `json:"payment_window_minutes"`
+	// PriceType is fixed unless floating, floating orders ignore ExRate
+	PriceType   string      `json:"price_type"`
+	Margin      Money       `json:"margin"`
+	FloorRate   Money       `json:"floor_rate"`
+	CeilingRate Money       `json:"ceiling_rate"`
+	Limits      TradeLimits `json:"limits"`
+}
+
+// DepositPayload is the unsigned escrow deposit for an order, the seller
+// signs Message with their wallet key and submits the signature
+type DepositPayload struct {
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SellOrderRes represents a created order awaiting its signed deposit
+type SellOrderRes struct {
+	Order   SellOrder      `json:"order"`
+	Deposit DepositPayload `json:"deposit"`
+}
+
+// DepositReq represents a seller's signature over an order's deposit
+type DepositReq struct {
+	Signature string `json:"signature"`
 }
 
 // CancelOrderReq ...
 type CancelOrderReq struct {
 	Reason CancelReason `json:"reason"`
+	// Partial cancels an order with trades in progress, only the amount not
+	// reserved by those trades is reversed
+	Partial bool `json:"partial"`
+}
+
+// CancelOrderRes represents the outcome of an order cancellation
+type CancelOrderRes struct {
+	Order             SellOrder  `json:"order"`
+	OutstandingTrades []BuyTrade `json:"outstanding_trades"`
 }
 
-// CreateBuyTradeReq represents the request payload to buy from a sell trade
+// CreateBuyTradeReq represents the request payload to buy from a sell trade,
+// either the QC Amount or the FiatAmount the buyer pays is given
 type CreateBuyTradeReq struct {
-	OrderID  string  `json:"order_id"`
-	Amount   float64 `json:"amount"`
-	WalletID string  `json:"wallet_id"`
+	OrderID    string `json:"order_id"`
+	Amount     Money  `json:"amount"`
+	FiatAmount Money  `json:"fiat_amount"`
+	WalletID   string `json:"wallet_id"`
 }
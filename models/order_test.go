@@ -0,0 +1,92 @@
+package models
+
+import "testing"
+
+func TestSellOrderQuote(t *testing.T) {
+	m := func(s string) Money {
+		v, err := ParseMoney(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		rate, currency       string
+		amount, fiat         string
+		wantAmount, wantFiat string
+	}{
+		{"400", "NGN", "2.5", "0", "2.5", "1000"},
+		{"400", "NGN", "0", "1000", "2.5", "1000"},
+		// fiat is rounded to the currency before it is converted
+		{"3", "USD", "0", "1.005", "0.33666667", "1.01"},
+		{"3", "USD", "0.33333333", "0", "0.33333333", "1"},
+		{"110.5", "JPY", "1", "0", "1", "111"},
+		// no exchange rate, no fiat value
+		{"0", "NGN", "2", "0", "2", "0"},
+	}
+	for _, tt := range tests {
+		order := SellOrder{ExRate: m(tt.rate), Currency: tt.currency}
+		amount, fiat, err := order.Quote(m(tt.amount), m(tt.fiat))
+		if err != nil {
+			t.Errorf("Quote(%s, %s) at %s %s: %v", tt.amount, tt.fiat, tt.rate, tt.currency, err)
+			continue
+		}
+		if amount != m(tt.wantAmount) || fiat != m(tt.wantFiat) {
+			t.Errorf("Quote(%s, %s) at %s %s = %s, %s, want %s, %s",
+				tt.amount, tt.fiat, tt.rate, tt.currency, amount, fiat, tt.wantAmount, tt.wantFiat)
+		}
+	}
+
+	order := SellOrder{ExRate: m("1000000"), Currency: "NGN"}
+	if _, _, err := order.Quote(m("50000000000"), 0); err != ErrInvalidMoney {
+		t.Errorf("overflowing Quote err = %v, want ErrInvalidMoney", err)
+	}
+}
+
+func TestBuyTradeAmountText(t *testing.T) {
+	trade := BuyTrade{Amount: Money(250000000)}
+	if got := trade.AmountText(); got != "2.5QC" {
+		t.Errorf("AmountText() = %q, want 2.5QC", got)
+	}
+
+	trade.FiatAmount, trade.Currency = Money(100000000000), "ngn"
+	if got := trade.AmountText(); got != "2.5QC (1000 NGN)" {
+		t.Errorf("AmountText() = %q, want 2.5QC (1000 NGN)", got)
+	}
+}
+
+func TestSellOrderFloatingRate(t *testing.T) {
+	m := func(s string) Money {
+		v, err := ParseMoney(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		margin, floor, ceiling string
+		reference, want        string
+	}{
+		{"2.5", "0", "0", "2", "2.05"},
+		{"-10", "0", "0", "2", "1.8"},
+		{"0", "0", "0", "1.234", "1.23"},
+		{"-10", "1.9", "0", "2", "1.9"},
+		{"10", "0", "2.1", "2", "2.1"},
+		{"10", "1.5", "2.5", "2", "2.2"},
+	}
+	for _, tt := range tests {
+		order := SellOrder{
+			PriceType:   PriceFloating,
+			Currency:    "USD",
+			Margin:      m(tt.margin),
+			FloorRate:   m(tt.floor),
+			CeilingRate: m(tt.ceiling),
+		}
+		if got, err := order.FloatingRate(m(tt.reference)); err != nil || got != m(tt.want) {
+			t.Errorf("FloatingRate(%s) at %s%% [%s, %s] = %s (%v), want %s",
+				tt.reference, tt.margin, tt.floor, tt.ceiling, got, err, tt.want)
+		}
+	}
+}
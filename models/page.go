@@ -0,0 +1,17 @@
+package models
+
+// Page sizes of paginated lists
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// PageInfo describes a page of a list, NextCursor fetches the page after it
+// and is empty on the last page
+type PageInfo struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	Order      string `json:"order"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -18,6 +18,30 @@ const (
 	Stripe
 )
 
+// Payment window bounds, a seller can't give buyers less than
+// MinPaymentWindow or more than MaxPaymentWindow to pay
+const (
+	MinPaymentWindow = time.Minute * 5
+	MaxPaymentWindow = time.Hour * 24
+)
+
+// defaultPaymentWindows is how long buyers have to pay with each payment
+// option when the seller doesn't set a window
+var defaultPaymentWindows = map[PaymentOption]time.Duration{
+	Bank:   time.Hour,
+	PayPal: time.Minute * 30,
+	Stripe: time.Minute * 15,
+}
+
+// DefaultPaymentWindow returns how long buyers have to pay with option by
+// default
+func DefaultPaymentWindow(option PaymentOption) time.Duration {
+	if d, ok := defaultPaymentWindows[option]; ok {
+		return d
+	}
+	return time.Minute * 30
+}
+
 // PaymentOptionReq represents the payment_option create request payload
 type PaymentOptionReq struct {
 	Type          PaymentOption `json:"type"`
@@ -60,7 +84,9 @@ type PayPalPayment struct {
 	ID                 primitive.ObjectID `json:"id" bson:"_id"`
 	OrderID            string             `json:"order_id" bson:"order_id"`
 	WalletAddress      string             `json:"wallet_address" bson:"wallet_address"`
-	Amount             float64            `json:"amount" bson:"amount"`
+	Amount             Money              `json:"amount" bson:"amount"`
+	Coins              Money              `json:"coins" bson:"coins"`
+	Fee                Money              `json:"fee" bson:"fee"`
 	TransactionPayload string             `json:"transaction_payload" bson:"transaction_payload"`
 	CreatedAt          time.Time          `json:"created_at" bson:"created_at"`
 }
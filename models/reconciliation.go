@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReconciliationReport compares the on-chain escrow wallet with the ledger
+type ReconciliationReport struct {
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// ChainBalance is the ESCROW_WALLET balance reported by the chain
+	ChainBalance Money `json:"chain_balance" bson:"chain_balance"`
+	// LedgerBalance is the escrow_wallet account balance
+	LedgerBalance Money `json:"ledger_balance" bson:"ledger_balance"`
+	// PendingIn is the sum of deposits the chain settled that the ledger
+	// has not recorded yet
+	PendingIn Money `json:"pending_in" bson:"pending_in"`
+	// PendingOut is the sum of payouts, refunds and fee sweeps the chain
+	// settled that the ledger has not recorded yet
+	PendingOut Money `json:"pending_out" bson:"pending_out"`
+	// UnresolvedIn and UnresolvedOut sum the transfers being submitted or
+	// parked as unknown, they may or may not have reached the chain
+	UnresolvedIn  Money `json:"unresolved_in" bson:"unresolved_in"`
+	UnresolvedOut Money `json:"unresolved_out" bson:"unresolved_out"`
+	// Drift is ChainBalance less LedgerBalance once settled transfers the
+	// ledger is yet to record are accounted for, drift within the unresolved
+	// amounts is not flagged
+	Drift Money `json:"drift" bson:"drift"`
+	// SellerHolds is the sum of every seller_hold account balance
+	SellerHolds Money `json:"seller_holds" bson:"seller_holds"`
+	// UnreleasedDeposits is the sum of escrow deposits not yet released
+	UnreleasedDeposits Money `json:"unreleased_deposits" bson:"unreleased_deposits"`
+	// HoldDrift is SellerHolds less UnreleasedDeposits
+	HoldDrift        Money             `json:"hold_drift" bson:"hold_drift"`
+	OrphanedDeposits []OrphanedDeposit `json:"orphaned_deposits" bson:"orphaned_deposits"`
+	Drifted          bool              `json:"drifted" bson:"drifted"`
+	CreatedAt        time.Time         `json:"created_at" bson:"created_at"`
+}
+
+// OrphanedDeposit is an unreleased deposit whose order is no longer trading
+type OrphanedDeposit struct {
+	DepositID   primitive.ObjectID `json:"deposit_id" bson:"_id"`
+	OrderID     primitive.ObjectID `json:"order_id" bson:"order_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Unreleased  Money              `json:"unreleased" bson:"unreleased"`
+	OrderStatus string             `json:"order_status" bson:"order_status"`
+}
+
+// Alert represents an operational alert raised for admins
+type Alert struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Kind      string             `json:"kind" bson:"kind"`
+	Message   string             `json:"message" bson:"message"`
+	RefID     primitive.ObjectID `json:"ref_id" bson:"ref_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Review scores, reviews scoring PositiveReviewScore or more count as
+// positive and NegativeReviewScore or less as negative
+const (
+	MinReviewScore      = 1
+	MaxReviewScore      = 5
+	PositiveReviewScore = 4
+	NegativeReviewScore = 2
+
+	// MaxReviewComment is the longest comment a review may have
+	MaxReviewComment = 1000
+)
+
+// Review is a trade party's review of the other party, each party may
+// review a released trade once
+type Review struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	TradeID      primitive.ObjectID `json:"trade_id" bson:"trade_id"`
+	OrderID      primitive.ObjectID `json:"order_id" bson:"order_id"`
+	ReviewerID   primitive.ObjectID `json:"reviewer_id" bson:"reviewer_id"`
+	ReviewerRole TradeActor         `json:"reviewer_role" bson:"reviewer_role"`
+	RevieweeID   primitive.ObjectID `json:"reviewee_id" bson:"reviewee_id"`
+	Score        int                `json:"score" bson:"score"`
+	Comment      string             `json:"comment" bson:"comment"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// ReviewReq represents the trade review request payload
+type ReviewReq struct {
+	Score   int    `json:"score"`
+	Comment string `json:"comment"`
+}
+
+// Reputation summarises a user's reviews and trades, CompletionRate is the
+// share of the user's closed trades that were released and
+// AverageReleaseSeconds how long the user took to release trades they sold
+// once paid
+type Reputation struct {
+	Reviews               int       `json:"reviews" bson:"reviews"`
+	Positive              int       `json:"positive" bson:"positive"`
+	Neutral               int       `json:"neutral" bson:"neutral"`
+	Negative              int       `json:"negative" bson:"negative"`
+	AverageScore          float64   `json:"average_score" bson:"average_score"`
+	ClosedTrades          int       `json:"closed_trades" bson:"closed_trades"`
+	CompletedTrades       int       `json:"completed_trades" bson:"completed_trades"`
+	CompletionRate        float64   `json:"completion_rate" bson:"completion_rate"`
+	AverageReleaseSeconds int64     `json:"average_release_seconds" bson:"average_release_seconds"`
+	UpdatedAt             time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// UserReviews is a user's reputation with the reviews they received
+type UserReviews struct {
+	Reputation Reputation `json:"reputation"`
+	Reviews    []Review   `json:"reviews"`
+}
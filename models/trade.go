@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrTradeTransition is returned for a trade move its current state or the
+// actor doesn't allow
+var ErrTradeTransition = errors.New("trade operation not allowed")
+
+// TradeAction represents a move of a trade from one state to another
+type TradeAction string
+
+// Trade actions
+const (
+	TradeActionOpen    TradeAction = "open"
+	TradeActionPay     TradeAction = "pay"
+	TradeActionRelease TradeAction = "release"
+	TradeActionCancel  TradeAction = "cancel"
+	TradeActionDispute TradeAction = "dispute"
+	TradeActionExpire  TradeAction = "expire"
+)
+
+// TradeActor represents who makes a trade move
+type TradeActor string
+
+// Trade actors
+const (
+	TradeActorBuyer  TradeActor = "buyer"
+	TradeActorSeller TradeActor = "seller"
+	// TradeActorSystem moves are made by background jobs
+	TradeActorSystem TradeActor = "system"
+	TradeActorAdmin  TradeActor = "admin"
+)
+
+// TradeTransition allows By to move a trade in From to To with Action
+type TradeTransition struct {
+	Action TradeAction  `json:"action"`
+	From   string       `json:"from"`
+	To     string       `json:"to"`
+	By     []TradeActor `json:"by"`
+}
+
+// TradeTransitions is the trade state machine, a trade is opened by its
+// buyer, marked paid by the buyer and released by the seller
+// Only opened trades may be cancelled by the buyer, a paid trade can only be
+// released or disputed, paid trades the seller doesn't release in time are
+// disputed by the system, disputes are settled by an admin ruling a release or
+// a cancellation
+var TradeTransitions = []TradeTransition{
+	{Action: TradeActionOpen, From: "", To: TradeOpened, By: []TradeActor{TradeActorBuyer}},
+	{Action: TradeActionPay, From: TradeOpened, To: TradePaid, By: []TradeActor{TradeActorBuyer}},
+	{Action: TradeActionRelease, From: TradeOpened, To: TradeReleased, By: []TradeActor{TradeActorSeller}},
+	{Action: TradeActionRelease, From: TradePaid, To: TradeReleased, By: []TradeActor{TradeActorSeller}},
+	{Action: TradeActionRelease, From: TradeDisputed, To: TradeReleased, By: []TradeActor{TradeActorAdmin}},
+	{Action: TradeActionCancel, From: TradeOpened, To: TradeCancelled, By: []TradeActor{TradeActorBuyer}},
+	{Action: TradeActionCancel, From: TradeDisputed, To: TradeCancelled, By: []TradeActor{TradeActorAdmin}},
+	{Action: TradeActionDispute, From: TradePaid, To: TradeDisputed, By: []TradeActor{TradeActorBuyer, TradeActorSeller, TradeActorSystem}},
+	{Action: TradeActionExpire, From: TradeOpened, To: TradeExpired, By: []TradeActor{TradeActorSystem}},
+}
+
+// OpenTradeStatuses are the states of trades still holding a reservation on
+// their order
+var OpenTradeStatuses = []string{TradeOpened, TradePaid, TradeDisputed}
+
+// NextTradeStatus returns the state a trade in from moves to when actor
+// makes action
+func NextTradeStatus(from string, action TradeAction, actor TradeActor) (string, error) {
+	for _, t := range TradeTransitions {
+		if t.Action != action || t.From != from {
+			continue
+		}
+		for _, by := range t.By {
+			if by == actor {
+				return t.To, nil
+			}
+		}
+	}
+	return "", ErrTradeTransition
+}
+
+// AllowedTradeActions returns the actions actor may make on a trade in status
+func AllowedTradeActions(status string, actor TradeActor) []TradeAction {
+	actions := []TradeAction{}
+	for _, t := range TradeTransitions {
+		if t.From != status {
+			continue
+		}
+		for _, by := range t.By {
+			if by == actor {
+				actions = append(actions, t.Action)
+			}
+		}
+	}
+	return actions
+}
+
+// TradeEvent records a trade's move between states
+type TradeEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	TradeID   primitive.ObjectID `json:"trade_id" bson:"trade_id"`
+	OrderID   primitive.ObjectID `json:"order_id" bson:"order_id"`
+	Action    TradeAction        `json:"action" bson:"action"`
+	From      string             `json:"from" bson:"from"`
+	To        string             `json:"to" bson:"to"`
+	Actor     TradeActor         `json:"actor" bson:"actor"`
+	ActorID   primitive.ObjectID `json:"actor_id" bson:"actor_id,omitempty"`
+	Note      string             `json:"note" bson:"note"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// TradeTimeline is a trade with its moves between states and the actions
+// the requesting user may make next
+type TradeTimeline struct {
+	Trade   BuyTrade      `json:"trade"`
+	Events  []TradeEvent  `json:"events"`
+	Actions []TradeAction `json:"actions"`
+}
+
+// TradeNextStep returns the action a trade in status is waiting on and who
+// must make it, disputed trades wait on an admin ruling and closed trades
+// wait on nothing
+func TradeNextStep(status string) (TradeAction, TradeActor) {
+	switch status {
+	case TradeOpened:
+		return TradeActionPay, TradeActorBuyer
+	case TradePaid:
+		return TradeActionRelease, TradeActorSeller
+	case TradeDisputed:
+		return "", TradeActorAdmin
+	}
+	return "", ""
+}
+
+// TradeParty is the public profile of a trade's counterparty
+type TradeParty struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Username   string             `json:"username" bson:"username"`
+	Tier       string             `json:"tier" bson:"tier"`
+	Reputation Reputation         `json:"reputation" bson:"reputation"`
+}
+
+// TradeOrderSummary is the order a trade buys from as shown with the trade
+type TradeOrderSummary struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	ExRate        Money              `json:"ex_rate" bson:"ex_rate"`
+	Currency      string             `json:"currency" bson:"currency"`
+	PaymentOption int32              `json:"payment_option" bson:"payment_option"`
+	PaymentWindow int64              `json:"payment_window_minutes" bson:"payment_window_minutes"`
+	Status        string             `json:"status" bson:"status"`
+}
+
+// TradeView is a trade as listed to one of its parties, Role is the party's
+// side of the trade
+// NextAction is what the trade is waiting on and NextActor who must make it,
+// AwaitingUser is set when that is the party the trade is listed to
+type TradeView struct {
+	BuyTrade     `bson:",inline"`
+	Role         TradeActor        `json:"role" bson:"role"`
+	Counterparty TradeParty        `json:"counterparty" bson:"counterparty"`
+	Order        TradeOrderSummary `json:"order" bson:"order"`
+	NextAction   TradeAction       `json:"next_action" bson:"-"`
+	NextActor    TradeActor        `json:"next_actor" bson:"-"`
+	AwaitingUser bool              `json:"awaiting_user" bson:"-"`
+}
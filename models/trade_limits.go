@@ -0,0 +1,65 @@
+package models
+
+// Trade limit error codes, returned with the trades an order's limits refuse
+const (
+	ErrCodeTradeBelowMin   = "trade_below_minimum"
+	ErrCodeTradeAboveMax   = "trade_above_maximum"
+	ErrCodeBuyerReputation = "buyer_reputation_too_low"
+	ErrCodeBuyerTrades     = "buyer_too_few_trades"
+	ErrCodeBuyerUnverified = "buyer_not_verified"
+	ErrCodeInvalidLimits   = "invalid_trade_limits"
+)
+
+// TradeLimits are a seller's rules for trades on their order, zero values
+// set no limit
+// MinAmount and MaxAmount bound the QC amount of a trade, a trade for all
+// that is still available on the order may be below MinAmount
+// MinScore and MinTrades bound the buyer's average review score and
+// completed trades, VerifiedOnly admits buyers of the verified and pro tiers
+type TradeLimits struct {
+	MinAmount    Money   `json:"min_amount" bson:"min_amount"`
+	MaxAmount    Money   `json:"max_amount" bson:"max_amount"`
+	MinScore     float64 `json:"min_score" bson:"min_score"`
+	MinTrades    int     `json:"min_trades" bson:"min_trades"`
+	VerifiedOnly bool    `json:"verified_only" bson:"verified_only"`
+}
+
+// Validate returns the error code for limits a seller can't set, or an empty
+// string
+func (l TradeLimits) Validate() string {
+	switch {
+	case l.MinAmount.Cmp(0) < 0 || l.MaxAmount.Cmp(0) < 0:
+		return ErrCodeInvalidLimits
+	case l.MaxAmount.IsPositive() && l.MinAmount.Cmp(l.MaxAmount) > 0:
+		return ErrCodeInvalidLimits
+	case l.MinScore < 0 || l.MinScore > MaxReviewScore || l.MinTrades < 0:
+		return ErrCodeInvalidLimits
+	}
+	return ""
+}
+
+// CheckBuyer returns the error code for a buyer the limits refuse, or an
+// empty string
+func (l TradeLimits) CheckBuyer(buyer User) string {
+	switch {
+	case l.VerifiedOnly && !buyer.Verified():
+		return ErrCodeBuyerUnverified
+	case l.MinScore > 0 && buyer.Reputation.AverageScore < l.MinScore:
+		return ErrCodeBuyerReputation
+	case l.MinTrades > 0 && buyer.Reputation.CompletedTrades < l.MinTrades:
+		return ErrCodeBuyerTrades
+	}
+	return ""
+}
+
+// CheckAmount returns the error code for a trade amount the limits refuse
+// when available is left on the order, or an empty string
+func (l TradeLimits) CheckAmount(amount, available Money) string {
+	switch {
+	case l.MinAmount.IsPositive() && amount.Cmp(l.MinAmount) < 0 && amount != available:
+		return ErrCodeTradeBelowMin
+	case l.MaxAmount.IsPositive() && amount.Cmp(l.MaxAmount) > 0:
+		return ErrCodeTradeAboveMax
+	}
+	return ""
+}
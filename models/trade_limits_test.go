@@ -0,0 +1,65 @@
+package models
+
+import "testing"
+
+func TestTradeLimitsValidate(t *testing.T) {
+	tests := []struct {
+		limits TradeLimits
+		want   string
+	}{
+		{TradeLimits{}, ""},
+		{TradeLimits{MinAmount: 100, MaxAmount: 100, MinScore: 4, MinTrades: 3, VerifiedOnly: true}, ""},
+		{TradeLimits{MinAmount: 100}, ""},
+		{TradeLimits{MinAmount: 200, MaxAmount: 100}, ErrCodeInvalidLimits},
+		{TradeLimits{MaxAmount: -1}, ErrCodeInvalidLimits},
+		{TradeLimits{MinScore: 6}, ErrCodeInvalidLimits},
+		{TradeLimits{MinTrades: -1}, ErrCodeInvalidLimits},
+	}
+	for _, tt := range tests {
+		if got := tt.limits.Validate(); got != tt.want {
+			t.Errorf("%+v.Validate() = %q, want %q", tt.limits, got, tt.want)
+		}
+	}
+}
+
+func TestTradeLimitsCheck(t *testing.T) {
+	limits := TradeLimits{MinAmount: 100, MaxAmount: 500, MinScore: 4, MinTrades: 2, VerifiedOnly: true}
+
+	amounts := []struct {
+		amount, available Money
+		want              string
+	}{
+		{100, 1000, ""},
+		{500, 1000, ""},
+		{99, 1000, ErrCodeTradeBelowMin},
+		{501, 1000, ErrCodeTradeAboveMax},
+		// what is left on the order may always be bought
+		{50, 50, ""},
+	}
+	for _, tt := range amounts {
+		if got := limits.CheckAmount(tt.amount, tt.available); got != tt.want {
+			t.Errorf("CheckAmount(%d, %d) = %q, want %q", tt.amount, tt.available, got, tt.want)
+		}
+	}
+
+	trusted := Reputation{AverageScore: 4.5, CompletedTrades: 2}
+	buyers := []struct {
+		buyer User
+		want  string
+	}{
+		{User{Tier: TierVerified, Reputation: trusted}, ""},
+		{User{Tier: TierPro, Reputation: trusted}, ""},
+		{User{Tier: TierStandard, Reputation: trusted}, ErrCodeBuyerUnverified},
+		{User{Tier: TierVerified, Reputation: Reputation{AverageScore: 3, CompletedTrades: 5}}, ErrCodeBuyerReputation},
+		{User{Tier: TierVerified, Reputation: Reputation{AverageScore: 5, CompletedTrades: 1}}, ErrCodeBuyerTrades},
+	}
+	for _, tt := range buyers {
+		if got := limits.CheckBuyer(tt.buyer); got != tt.want {
+			t.Errorf("CheckBuyer(%+v) = %q, want %q", tt.buyer.Reputation, got, tt.want)
+		}
+	}
+
+	if got := (TradeLimits{}).CheckBuyer(User{}); got != "" {
+		t.Errorf("no limits CheckBuyer = %q, want none", got)
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import "testing"
+
+func TestNextTradeStatus(t *testing.T) {
+	tests := []struct {
+		from   string
+		action TradeAction
+		actor  TradeActor
+		want   string
+	}{
+		{TradeOpened, TradeActionPay, TradeActorBuyer, TradePaid},
+		{TradeOpened, TradeActionCancel, TradeActorBuyer, TradeCancelled},
+		{TradePaid, TradeActionRelease, TradeActorSeller, TradeReleased},
+		{TradePaid, TradeActionDispute, TradeActorSeller, TradeDisputed},
+		{TradeDisputed, TradeActionCancel, TradeActorAdmin, TradeCancelled},
+		{TradeOpened, TradeActionExpire, TradeActorSystem, TradeExpired},
+		{TradePaid, TradeActionDispute, TradeActorSystem, TradeDisputed},
+		// a buyer can't take back a payment they reported
+		{TradePaid, TradeActionCancel, TradeActorBuyer, ""},
+		{TradeOpened, TradeActionRelease, TradeActorBuyer, ""},
+		{TradeReleased, TradeActionCancel, TradeActorBuyer, ""},
+		{TradePaid, TradeActionExpire, TradeActorSystem, ""},
+		// disputes are only settled by arbitration
+		{TradeDisputed, TradeActionRelease, TradeActorSeller, ""},
+		{TradeDisputed, TradeActionCancel, TradeActorBuyer, ""},
+	}
+	for _, tt := range tests {
+		got, err := NextTradeStatus(tt.from, tt.action, tt.actor)
+		if tt.want == "" {
+			if err != ErrTradeTransition {
+				t.Errorf("%s %s by %s = %q, want ErrTradeTransition", tt.from, tt.action, tt.actor, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s %s by %s = %q, %v, want %q", tt.from, tt.action, tt.actor, got, err, tt.want)
+		}
+	}
+}
+
+func TestTradeNextStep(t *testing.T) {
+	tests := []struct {
+		status string
+		action TradeAction
+		actor  TradeActor
+	}{
+		{TradeOpened, TradeActionPay, TradeActorBuyer},
+		{TradePaid, TradeActionRelease, TradeActorSeller},
+		{TradeDisputed, "", TradeActorAdmin},
+		{TradeReleased, "", ""},
+		{TradeExpired, "", ""},
+	}
+	for _, tt := range tests {
+		action, actor := TradeNextStep(tt.status)
+		if action != tt.action || actor != tt.actor {
+			t.Errorf("TradeNextStep(%s) = %q, %q, want %q, %q", tt.status, action, actor, tt.action, tt.actor)
+		}
+		if tt.action == "" {
+			continue
+		}
+		if _, err := NextTradeStatus(tt.status, action, actor); err != nil {
+			t.Errorf("%s %s by %s is not a trade transition", tt.status, action, actor)
+		}
+	}
+}
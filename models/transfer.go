@@ -0,0 +1,98 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TransferKind represents the escrow movement a transfer belongs to
+type TransferKind string
+
+// Transfer kinds
+const (
+	TransferDeposit  TransferKind = "deposit"
+	TransferRelease  TransferKind = "release"
+	TransferReversal TransferKind = "reversal"
+	// TransferFee sweeps a trade's fee from the escrow wallet to the fee wallet
+	TransferFee TransferKind = "fee"
+	// TransferICOFee sweeps an ICO purchase's fee from the ICO wallet to the
+	// fee wallet, it never touches escrow
+	TransferICOFee TransferKind = "ico_fee"
+)
+
+// TransferStatus represents the state of a transfer in the outbox
+type TransferStatus string
+
+// Transfer statuses
+const (
+	// TransferPending transfers are waiting to be submitted to the chain
+	TransferPending TransferStatus = "pending"
+	// TransferSubmitting transfers have been claimed and are being submitted
+	TransferSubmitting TransferStatus = "submitting"
+	// TransferSettled transfers were accepted by the chain and are waiting
+	// for enough confirmations
+	TransferSettled TransferStatus = "settled"
+	// TransferConfirmed transfers are final on the chain, their effects are
+	// only recorded once confirmed
+	TransferConfirmed TransferStatus = "confirmed"
+	// TransferFailed transfers were rejected by the chain and won't be retried
+	TransferFailed TransferStatus = "failed"
+	// TransferUnknown transfers may or may not have reached the chain, they
+	// are never resent automatically
+	TransferUnknown TransferStatus = "unknown"
+)
+
+// Inbound reports whether transfers of this kind move funds into escrow
+func (k TransferKind) Inbound() bool {
+	return k == TransferDeposit
+}
+
+// Transfer represents a chain transfer recorded in the outbox before it is
+// submitted, Key makes enqueueing idempotent
+// Client-signed transfers carry the Message their sender signed, TxID is the
+// chain transaction tracked until it is final
+type Transfer struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	Key           string             `json:"key" bson:"key"`
+	Kind          TransferKind       `json:"kind" bson:"kind"`
+	OrderID       primitive.ObjectID `json:"order_id" bson:"order_id"`
+	TradeID       primitive.ObjectID `json:"trade_id,omitempty" bson:"trade_id,omitempty"`
+	UserID        primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Sender        string             `json:"sender" bson:"sender"`
+	Receiver      string             `json:"receiver" bson:"receiver"`
+	Amount        Money              `json:"amount" bson:"amount"`
+	Message       string             `json:"message,omitempty" bson:"message,omitempty"`
+	PublicKey     string             `json:"public_key,omitempty" bson:"public_key,omitempty"`
+	Signature     string             `json:"signature,omitempty" bson:"signature,omitempty"`
+	ExpiresAt     time.Time          `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	Status        TransferStatus     `json:"status" bson:"status"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	LastError     string             `json:"last_error" bson:"last_error"`
+	Response      string             `json:"response" bson:"response"`
+	TxID          string             `json:"tx_id" bson:"tx_id"`
+	TxStatus      string             `json:"tx_status" bson:"tx_status"`
+	Confirmations int                `json:"confirmations" bson:"confirmations"`
+	Applied       bool               `json:"applied" bson:"applied"`
+	NextAttemptAt time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	SettledAt     time.Time          `json:"settled_at" bson:"settled_at"`
+	ConfirmedAt   time.Time          `json:"confirmed_at" bson:"confirmed_at"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// ResolveTransferReq represents an admin resolution of an unknown transfer
+type ResolveTransferReq struct {
+	Status TransferStatus `json:"status"`
+	// TxID of a transfer found on the chain, it is tracked to finality
+	TxID string `json:"tx_id"`
+}
+
+// TransferTotal sums the transfers of a kind in a status, confirmed totals
+// only count transfers whose effects were not applied yet
+type TransferTotal struct {
+	Kind   TransferKind   `json:"kind" bson:"kind"`
+	Status TransferStatus `json:"status" bson:"status"`
+	Amount Money          `json:"amount" bson:"amount"`
+	Count  int64          `json:"count" bson:"count"`
+}
@@ -14,14 +14,22 @@ type User struct {
 	Password        string             `json:"-" bson:"password"`
 	FCMToken        string             `json:"fcm_token" bson:"fcm_token"`
 	Confirmed       bool               `json:"confirmed" bson:"confirmed"`
+	Admin           bool               `json:"-" bson:"admin"`
 	PassCode        int                `json:"-" bson:"pass_code"`
 	PositiveRatings int                `json:"positive_ratings" bson:"positive_ratings"`
 	NegativeRatings int                `json:"negative_ratings" bson:"negative_ratings"`
 	NumTransactions int                `json:"num_transactions" bson:"num_transactions"`
+	Tier            string             `json:"tier" bson:"tier"`
+	Reputation      Reputation         `json:"reputation" bson:"reputation"`
 	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
+// Verified reports whether the user is of a verified tier
+func (u User) Verified() bool {
+	return u.Tier == TierVerified || u.Tier == TierPro
+}
+
 // UserWallet ...
 type UserWallet struct {
 	ID        primitive.ObjectID `json:"id" bson:"_id"`
@@ -72,20 +80,6 @@ type FCMTokenReq struct {
 	Token string `json:"token"`
 }
 
-// RatingType ...
-type RatingType uint
-
-// Rating types
-const (
-	PositiveRating RatingType = iota
-	NegativeRating
-)
-
-// RateUserReq ...
-type RateUserReq struct {
-	Type RatingType `json:"type"`
-}
-
 // NewSupportChatReq ...
 type NewSupportChatReq struct {
 	Message    string `json:"message"`
@@ -0,0 +1,153 @@
+// Package attachments validates files uploaded to trade chats and prepares
+// them for storage
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxSize is the largest file accepted, in bytes
+	MaxSize = 5 << 20
+	// MaxPixels is the largest image accepted, in pixels, larger images are
+	// refused before being decoded
+	MaxPixels = 40000000
+	// ThumbnailSize is the longest side of a thumbnail, in pixels
+	ThumbnailSize = 256
+
+	jpegQuality = 90
+)
+
+// Accepted content types
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	PDF  = "application/pdf"
+)
+
+var (
+	// ErrEmpty is returned for an empty file
+	ErrEmpty = errors.New("file is empty")
+	// ErrTooLarge is returned for files over MaxSize or images over
+	// MaxPixels
+	ErrTooLarge = errors.New("file is too large")
+	// ErrUnsupportedType is returned for files that aren't JPEG or PNG
+	// images or PDF documents
+	ErrUnsupportedType = errors.New("file type not supported")
+	// ErrInvalidImage is returned for images that can't be decoded
+	ErrInvalidImage = errors.New("image could not be read")
+)
+
+// File is an accepted attachment ready for storage, Thumbnail is set for
+// images only and has the same content type
+type File struct {
+	Data        []byte
+	ContentType string
+	Thumbnail   []byte
+}
+
+// Process validates an uploaded file from its content rather than its
+// declared type, images are re-encoded to strip EXIF and other metadata
+// such as the location a photo was taken at, and given a thumbnail
+func Process(data []byte) (File, error) {
+	if len(data) == 0 {
+		return File{}, ErrEmpty
+	}
+	if len(data) > MaxSize {
+		return File{}, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case JPEG, PNG:
+		return processImage(data, contentType)
+	case PDF:
+		return File{Data: data, ContentType: PDF}, nil
+	}
+	return File{}, ErrUnsupportedType
+}
+
+// processImage decodes an image and encodes it again with a thumbnail, the
+// encoders write pixels only so no metadata survives
+func processImage(data []byte, contentType string) (File, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return File{}, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return File{}, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return File{}, ErrInvalidImage
+	}
+
+	clean, err := encode(img, contentType)
+	if err != nil {
+		return File{}, err
+	}
+	thumb, err := encode(thumbnail(img, ThumbnailSize), contentType)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Data: clean, ContentType: contentType, Thumbnail: thumb}, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == PNG {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	return buf.Bytes(), err
+}
+
+// thumbnail scales img down so its longest side is at most max, averaging
+// the source pixels each thumbnail pixel covers
+func thumbnail(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > max || h > max {
+		if w >= h {
+			tw, th = max, h*max/w
+		} else {
+			tw, th = w*max/h, max
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
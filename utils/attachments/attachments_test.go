@@ -0,0 +1,89 @@
+package attachments
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestProcessStripsExif(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(600, 300), nil); err != nil {
+		t.Fatal(err)
+	}
+	// insert an APP1 EXIF segment after the SOI marker
+	exif := append([]byte{0xFF, 0xE1, 0x00, 0x10}, []byte("Exif\x00\x00GPSDATA!")...)
+	data := append(append([]byte{}, buf.Bytes()[:2]...), exif...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	file, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if file.ContentType != JPEG {
+		t.Errorf("ContentType = %q, want %q", file.ContentType, JPEG)
+	}
+	if bytes.Contains(file.Data, []byte("Exif")) || bytes.Contains(file.Data, []byte("GPSDATA")) {
+		t.Error("processed image still carries EXIF data")
+	}
+
+	thumb, err := jpeg.DecodeConfig(bytes.NewReader(file.Thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail can't be decoded: %v", err)
+	}
+	if thumb.Width != ThumbnailSize || thumb.Height != ThumbnailSize/2 {
+		t.Errorf("thumbnail is %dx%d, want %dx%d", thumb.Width, thumb.Height, ThumbnailSize, ThumbnailSize/2)
+	}
+}
+
+func TestProcessSmallPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(40, 80)); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	thumb, err := png.DecodeConfig(bytes.NewReader(file.Thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail can't be decoded: %v", err)
+	}
+	if thumb.Width != 40 || thumb.Height != 80 {
+		t.Errorf("thumbnail is %dx%d, want 40x80", thumb.Width, thumb.Height)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrEmpty},
+		{"text", []byte("<html><body>not a receipt</body></html>"), ErrUnsupportedType},
+		{"too large", append([]byte("%PDF-1.4\n"), make([]byte, MaxSize)...), ErrTooLarge},
+		{"truncated jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00}, ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data); err != tt.want {
+				t.Errorf("Process() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+// Package blob stores files such as trade chat attachments behind a Store
+// so the backend holding them can be swapped
+package blob
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrNotFound is returned when no blob is stored under a key
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for keys that are empty or escape the store
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store saves and serves blobs by key, keys are slash separated paths such
+// as "trades/<id>/<file>"
+type Store interface {
+	// Put stores the content of r under key, replacing any blob already
+	// stored there
+	Put(key, contentType string, r io.Reader) error
+	// Get opens the blob stored under key, the caller closes it
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key, deleting a missing blob is
+	// not an error
+	Delete(key string) error
+}
@@ -0,0 +1,47 @@
+package blob
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put("trades/1/receipt.pdf", "application/pdf", strings.NewReader("receipt")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	r, err := store.Get("trades/1/receipt.pdf")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "receipt" {
+		t.Errorf("Get() = %q, want %q", data, "receipt")
+	}
+
+	if err := store.Delete("trades/1/receipt.pdf"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get("trades/1/receipt.pdf"); err != ErrNotFound {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "trades/../../outside", "trades//1", `trades\1`} {
+		if err := store.Put(key, "application/pdf", strings.NewReader("x")); err != ErrInvalidKey {
+			t.Errorf("Put(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+}
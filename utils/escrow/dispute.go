@@ -0,0 +1,122 @@
+package escrow
+
+import (
+	"context"
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/ledger"
+	"errors"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrEscrowFrozen is returned when moving escrow held for a disputed trade
+var ErrEscrowFrozen = errors.New("Operation not allowed, escrow is frozen while the trade is disputed")
+
+// Freeze stops a trade's share of its order deposit from being released or
+// reversed until it is unfrozen
+func (e *Escrow) Freeze(trade models.BuyTrade) error {
+	return e.setFrozen(trade, "$addToSet")
+}
+
+// Unfreeze lets a trade's share of its order deposit move again
+func (e *Escrow) Unfreeze(trade models.BuyTrade) error {
+	return e.setFrozen(trade, "$pull")
+}
+
+func (e *Escrow) setFrozen(trade models.BuyTrade, op string) error {
+	res, err := e.db.Collection("escrow").UpdateOne(context.TODO(), bson.M{
+		"order_id": trade.OrderID,
+		"user_id":  trade.SellerID,
+	}, bson.M{
+		op:     bson.M{"frozen_trades": trade.ID},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// frozen reports whether trade's share of escrow is frozen
+func frozen(escrow models.EscrowDeposit, tradeID primitive.ObjectID) bool {
+	for _, id := range escrow.FrozenTrades {
+		if id == tradeID {
+			return true
+		}
+	}
+	return false
+}
+
+// ReverseTrade sends a trade's share of its order deposit back to the seller,
+// it is used when a dispute is ruled for the seller and is never applied
+// twice for the same trade
+func (e *Escrow) ReverseTrade(order models.SellOrder, trade models.BuyTrade) error {
+	var escrow models.EscrowDeposit
+	key := "reversal:trade:" + trade.ID.Hex()
+
+	// retrieve deposit
+	err := e.db.Collection("escrow").FindOne(context.TODO(), bson.M{
+		"order_id": order.ID,
+		"user_id":  order.CreatedBy,
+	}).Decode(&escrow)
+	if err != nil {
+		return err
+	}
+
+	if frozen(escrow, trade.ID) {
+		return ErrEscrowFrozen
+	}
+
+	_, err = e.ledger.Entry(key)
+	if err == mongo.ErrNoDocuments {
+		hold, err := e.ledger.Balance(ledger.SellerHold(order.ID))
+		if err != nil {
+			return err
+		}
+
+		if hold.Balance.Cmp(trade.Amount) < 0 {
+			return errors.New("Deposit in escrow not enough to cover transaction")
+		}
+
+		err = e.ledger.Post(models.JournalEntry{
+			Reference: key,
+			Kind:      models.EntryReversal,
+			OrderID:   order.ID,
+			TradeID:   trade.ID,
+			Memo:      "trade reversal to " + order.WalletID,
+			Postings: []models.Posting{
+				ledger.Debit(ledger.SellerHold(order.ID), trade.Amount),
+				ledger.Credit(ledger.SellerRefund(order.CreatedBy), trade.Amount),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := e.syncDeposit(escrow); err != nil {
+		return err
+	}
+
+	_, err = e.enqueue(models.Transfer{
+		Key:      key,
+		Kind:     models.TransferReversal,
+		OrderID:  order.ID,
+		TradeID:  trade.ID,
+		UserID:   order.CreatedBy,
+		Sender:   os.Getenv("ESCROW_WALLET"),
+		Receiver: order.WalletID,
+		Amount:   trade.Amount,
+	})
+
+	return err
+}
@@ -1,92 +1,178 @@
 package escrow
 
 import (
-	"bytes"
 	"context"
 	"vhennpay-bend/models"
+	"vhennpay-bend/utils/ledger"
+	"vhennpay-bend/utils/lid"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // TODO: extract db calls to DAO methods
 
-// Lid network API endpoints
+// depositSignWindow is how long a seller has to sign an order's deposit
+const depositSignWindow = time.Minute * 15
+
+// Escrow errors
 var (
-	transferEndpoint string
+	// ErrNothingToReverse is returned when an order has nothing left in
+	// escrow to send back to the seller
+	ErrNothingToReverse = errors.New("Operation not allowed, nothing left in escrow to reverse")
+	// ErrDepositExpired is returned when a deposit is signed after its
+	// payload expired
+	ErrDepositExpired = errors.New("Deposit payload has expired")
+	// ErrDepositInFlight is returned when a signed deposit is already being
+	// relayed to the chain
+	ErrDepositInFlight = errors.New("Deposit is already being submitted")
 )
 
+// TransferStore is the transfer outbox the escrow relays transfers through,
+// dao.TransferDAO is the store backed by the database
+type TransferStore interface {
+	Insert(transfer models.Transfer) error
+	FindByKey(key string) (models.Transfer, error)
+	FindByID(id string) (models.Transfer, error)
+	Query(filter bson.M) ([]models.Transfer, error)
+	Transition(id primitive.ObjectID, from models.TransferStatus, set bson.M) (bool, error)
+	ExpireStale(before time.Time) (int64, error)
+	Abandoned(now time.Time) ([]models.Transfer, error)
+	Unapplied() ([]models.Transfer, error)
+	ClaimDue(now time.Time) (models.Transfer, error)
+	ClaimPending(id primitive.ObjectID) (models.Transfer, error)
+	InFlight() ([]models.TransferTotal, error)
+}
+
 // Escrow represents the escrow service
 type Escrow struct {
-	db *mongo.Database
+	db        *mongo.Database
+	ledger    *ledger.Ledger
+	transfers TransferStore
+	chain     lid.ChainClient
+	hooks     map[models.TransferKind][]func(models.Transfer)
+	failHooks map[models.TransferKind][]func(models.Transfer)
 }
 
 // InitEscrow ...
-func InitEscrow(db *mongo.Database) *Escrow {
-	base := fmt.Sprintf("%s/api/v1", os.Getenv("LID_SERVER_ADDR"))
-	transferEndpoint = base + "/wallet/transfer"
-	log.Println(transferEndpoint)
-	return &Escrow{db}
+func InitEscrow(db *mongo.Database, ledger *ledger.Ledger, transfers TransferStore, chain lid.ChainClient) *Escrow {
+	return &Escrow{
+		db:        db,
+		ledger:    ledger,
+		transfers: transfers,
+		chain:     chain,
+		hooks:     make(map[models.TransferKind][]func(models.Transfer)),
+		failHooks: make(map[models.TransferKind][]func(models.Transfer)),
+	}
 }
 
-// NewDeposit deposits N amount in escrow for Order O
-func (e *Escrow) NewDeposit(orderID, userID primitive.ObjectID, amount float64, walletID, walletSecret string) error {
-	escrow := models.EscrowDeposit{
-		ID:           primitive.NewObjectID(),
-		OrderID:      orderID,
-		UserID:       userID,
-		SourceWallet: walletID,
-		Amount:       amount,
-		CreatedAt:    time.Now().UTC(),
-	}
+// OnConfirmed registers fn to run once a transfer of the given kind is final
+// on the chain, fn may run more than once for the same transfer
+func (e *Escrow) OnConfirmed(kind models.TransferKind, fn func(models.Transfer)) {
+	e.hooks[kind] = append(e.hooks[kind], fn)
+}
 
-	// post transaction to chain
-	escrowWallet := os.Getenv("ESCROW_WALLET")
-	payload := map[string]string{
-		"sender_address":     walletID,
-		"reciever_address":   escrowWallet,
-		"amount":             strconv.FormatFloat(amount, 'f', -1, 64),
-		"sender_private_key": walletSecret,
-	}
-	resp, err := postToChain(transferEndpoint, payload)
+// OnFailed registers fn to run once a transfer of the given kind has failed
+// for good
+func (e *Escrow) OnFailed(kind models.TransferKind, fn func(models.Transfer)) {
+	e.failHooks[kind] = append(e.failHooks[kind], fn)
+}
+
+// PrepareDeposit records the escrow deposit for Order O and returns it with
+// the unsigned payload the seller signs on their device
+func (e *Escrow) PrepareDeposit(orderID, userID primitive.ObjectID, amount models.Money, walletID string) (models.Transfer, error) {
+	key := "deposit:" + orderID.Hex()
+	receiver := os.Getenv("ESCROW_WALLET")
+	expiresAt := time.Now().UTC().Add(depositSignWindow)
+
+	return e.enqueue(models.Transfer{
+		Key:       key,
+		Kind:      models.TransferDeposit,
+		OrderID:   orderID,
+		UserID:    userID,
+		Sender:    walletID,
+		Receiver:  receiver,
+		Amount:    amount,
+		Message:   lid.NewTransferPayload(walletID, receiver, amount, key, expiresAt).Message(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// SubmitDeposit verifies the seller's signature over an order's deposit
+// against their wallet's public key and relays the signed transfer
+func (e *Escrow) SubmitDeposit(orderID primitive.ObjectID, signature string) error {
+	transfer, err := e.transfers.FindByKey("deposit:" + orderID.Hex())
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		var d map[string]interface{}
-		err = json.NewDecoder(resp.Body).Decode(&d)
+	switch transfer.Status {
+	case models.TransferSettled, models.TransferConfirmed:
+		return nil
+	case models.TransferPending:
+	default:
+		return fmt.Errorf("escrow: deposit for order %s is %s", orderID.Hex(), transfer.Status)
+	}
+
+	if transfer.Signature == "" {
+		if time.Now().UTC().After(transfer.ExpiresAt) {
+			return ErrDepositExpired
+		}
+
+		wallet, err := e.chain.GetWallet(transfer.Sender)
+		if err != nil {
+			return err
+		}
+		if err := lid.Verify(wallet.PublicKey, transfer.Message, signature); err != nil {
+			return err
+		}
+
+		// the signature is kept so the outbox can relay the deposit again if
+		// the chain can't be reached
+		_, err = e.transfers.Transition(transfer.ID, models.TransferPending, bson.M{
+			"public_key": wallet.PublicKey,
+			"signature":  signature,
+		})
 		if err != nil {
-			log.Printf("failed to post tx to chain: %v", err)
-			return errors.New("Failed to read transaction data from the QUI chain")
+			return err
 		}
-		log.Printf("error posting to chain, resp: %v", d)
-		return errors.New("Error posting transaction to QUI chain: " + d["error"].(string))
 	}
 
-	b, _ := bson.Marshal(escrow)
-	_, err = e.db.Collection("escrow").InsertOne(context.TODO(), b)
-	return err
+	transfer, err = e.transfers.ClaimPending(transfer.ID)
+	if err == mongo.ErrNoDocuments {
+		return ErrDepositInFlight
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.submit(transfer, "", true)
 }
 
 // ReverseDeposit reverses the deposited amount in escrow back to user's source
 // wallet
 // Actions like cancel trade will trigger this method
 func (e *Escrow) ReverseDeposit(order models.SellOrder) error {
+	return e.reverse(order, "reversal:"+order.ID.Hex(), 0)
+}
+
+// ReverseUnreserved reverses what is left in escrow for an order less the
+// amount reserved by trades still in progress, those trades can still be
+// released once the order is closing
+func (e *Escrow) ReverseUnreserved(order models.SellOrder, reserved models.Money) error {
+	return e.reverse(order, "reversal:"+order.ID.Hex()+":unreserved", reserved)
+}
+
+func (e *Escrow) reverse(order models.SellOrder, key string, reserved models.Money) error {
 	var escrow models.EscrowDeposit
-	escrowWallet := os.Getenv("ESCROW_WALLET")
-	escrowWalletSecret := os.Getenv("ESCROW_WALLET_SECRET")
 
 	// retrieve deposit
 	err := e.db.Collection("escrow").FindOne(context.TODO(), bson.M{
@@ -97,69 +183,67 @@ func (e *Escrow) ReverseDeposit(order models.SellOrder) error {
 		return err
 	}
 
-	// confirm escrow hasn't been released
-	if escrow.Released {
-		return errors.New("Operation not allowed, escrow has already been released")
-	}
-
-	// build payload and transfer amount
-	reversalAmount := escrow.Amount - escrow.ReleasedAmount
-
-	payload := map[string]string{
-		"sender_address":     escrowWallet,
-		"reciever_address":   order.WalletID,
-		"amount":             strconv.FormatFloat(reversalAmount, 'f', -1, 64),
-		"sender_private_key": escrowWalletSecret,
-	}
-
-	resp, err := postToChain(transferEndpoint, payload)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	entry, err := e.ledger.Entry(key)
+	if err == mongo.ErrNoDocuments {
+		// confirm escrow hasn't been released
+		if escrow.Released {
+			return errors.New("Operation not allowed, escrow has already been released")
+		}
 
-	if resp.StatusCode >= 300 {
-		var d map[string]interface{}
-		err = json.NewDecoder(resp.Body).Decode(&d)
+		// the seller hold on the ledger is what is left to reverse
+		hold, err := e.ledger.Balance(ledger.SellerHold(order.ID))
 		if err != nil {
-			log.Printf("failed to post tx to chain: %v", err)
-			return errors.New("Failed to read transaction data from the QUI chain")
+			return err
 		}
-		log.Printf("error posting to chain, resp: %v", d)
-		return errors.New("Error posting transaction to QUI chain: " + d["error"].(string))
-	}
 
-	now := time.Now().UTC()
-	escrow.Released = true
-	escrow.UpdatedAt = now
+		amount := hold.Balance.Sub(reserved)
+		if !amount.IsPositive() {
+			return ErrNothingToReverse
+		}
 
-	_, err = e.db.Collection("escrow").
-		UpdateOne(context.TODO(), bson.M{"_id": escrow.ID}, bson.M{"$set": escrow})
-	if err != nil {
+		entry = models.JournalEntry{
+			Reference: key,
+			Kind:      models.EntryReversal,
+			OrderID:   order.ID,
+			Memo:      "reversal to " + order.WalletID,
+			Postings: []models.Posting{
+				ledger.Debit(ledger.SellerHold(order.ID), amount),
+				ledger.Credit(ledger.SellerRefund(order.CreatedBy), amount),
+			},
+		}
+		if err := e.ledger.Post(entry); err != nil {
+			return err
+		}
+	} else if err != nil {
 		return err
 	}
 
-	// create escrow release for reversal
-	escrowRelease := models.EscrowRelease{
-		ID:            primitive.NewObjectID(),
-		ParentID:      escrow.ID,
-		Recipient:     order.CreatedBy,
-		Amount:        reversalAmount,
-		WalletAddress: order.WalletID,
-		CreatedAt:     now,
+	// the deposit is only marked released once the reversal is queued, so a
+	// reversal that failed to queue is still listed as orphaned and retried
+	_, err = e.enqueue(models.Transfer{
+		Key:      key,
+		Kind:     models.TransferReversal,
+		OrderID:  order.ID,
+		UserID:   order.CreatedBy,
+		Sender:   os.Getenv("ESCROW_WALLET"),
+		Receiver: order.WalletID,
+		Amount:   entry.Postings[0].Debit,
+	})
+	if err != nil {
+		return err
 	}
 
-	b, _ := bson.Marshal(escrowRelease)
-	_, err = e.db.Collection("escrow_release").InsertOne(context.TODO(), b)
-
-	return err
+	return e.syncDeposit(escrow)
 }
 
 // ReleaseDeposit releases an escrowed amount to the trade receipient
+// The release is recorded on the ledger and queued on the outbox, calling it
+// again for the same trade never releases twice
+// The trade's fee is split off the release and swept to the FEE_WALLET
 func (e *Escrow) ReleaseDeposit(trade models.BuyTrade, receipient string) error {
 	var escrow models.EscrowDeposit
-	escrowWallet := os.Getenv("ESCROW_WALLET")
-	escrowWalletSecret := os.Getenv("ESCROW_WALLET_SECRET")
+	key := "release:" + trade.ID.Hex()
+	net := trade.Amount.Sub(trade.Fee)
 
 	// retrieve deposit
 	err := e.db.Collection("escrow").FindOne(context.TODO(), bson.M{
@@ -170,71 +254,162 @@ func (e *Escrow) ReleaseDeposit(trade models.BuyTrade, receipient string) error
 		return err
 	}
 
-	// skip if already released
-	if escrow.Released {
-		return errors.New("Escrow already released")
+	if frozen(escrow, trade.ID) {
+		return ErrEscrowFrozen
 	}
 
-	if (escrow.Amount - escrow.ReleasedAmount) < trade.Amount {
-		return errors.New("Deposit in escrow not enough to cover transaction")
-	}
+	_, err = e.ledger.Entry(key)
+	if err == mongo.ErrNoDocuments {
+		// skip if already released
+		if escrow.Released {
+			return errors.New("Escrow already released")
+		}
 
-	payload := map[string]string{
-		"sender_address":     escrowWallet,
-		"reciever_address":   receipient,
-		"amount":             strconv.FormatFloat(trade.Amount, 'f', -1, 64),
-		"sender_private_key": escrowWalletSecret,
-	}
+		hold, err := e.ledger.Balance(ledger.SellerHold(trade.OrderID))
+		if err != nil {
+			return err
+		}
 
-	resp, err := postToChain(transferEndpoint, payload)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+		if hold.Balance.Cmp(trade.Amount) < 0 {
+			return errors.New("Deposit in escrow not enough to cover transaction")
+		}
+
+		postings := []models.Posting{
+			ledger.Debit(ledger.SellerHold(trade.OrderID), trade.Amount),
+			ledger.Credit(ledger.BuyerPayout(trade.BuyerID), net),
+		}
+		if trade.Fee.IsPositive() {
+			postings = append(postings, ledger.Credit(ledger.Fees(), trade.Fee))
+		}
 
-	if resp.StatusCode >= 300 {
-		var d map[string]interface{}
-		err = json.NewDecoder(resp.Body).Decode(&d)
+		err = e.ledger.Post(models.JournalEntry{
+			Reference: key,
+			Kind:      models.EntryRelease,
+			OrderID:   trade.OrderID,
+			TradeID:   trade.ID,
+			Memo:      "release to " + receipient,
+			Postings:  postings,
+		})
 		if err != nil {
-			log.Printf("failed to post tx to chain: %v", err)
-			return errors.New("Failed to read transaction data from the QUI chain")
+			return err
 		}
-		return fmt.Errorf("Error posting to chain, resp: %v", d)
+	} else if err != nil {
+		return err
 	}
 
-	b, _ := ioutil.ReadAll(resp.Body)
-	log.Printf("escrow: tx posted to chain, resp: %v", string(b))
+	if err := e.syncDeposit(escrow); err != nil {
+		return err
+	}
 
-	// mark as released
-	escrow.ReleasedAmount = escrow.ReleasedAmount + trade.Amount
-	if (escrow.Amount - escrow.ReleasedAmount) == 0 {
-		escrow.Released = true
+	_, err = e.enqueue(models.Transfer{
+		Key:      key,
+		Kind:     models.TransferRelease,
+		OrderID:  trade.OrderID,
+		TradeID:  trade.ID,
+		UserID:   trade.BuyerID,
+		Sender:   os.Getenv("ESCROW_WALLET"),
+		Receiver: receipient,
+		Amount:   net,
+	})
+	if err != nil || !trade.Fee.IsPositive() {
+		return err
 	}
-	now := time.Now().UTC()
-	escrow.UpdatedAt = now
 
-	_, err = e.db.Collection("escrow").UpdateOne(context.TODO(), bson.M{"_id": escrow.ID}, bson.M{"$set": escrow})
+	_, err = e.enqueue(models.Transfer{
+		Key:      "fee:" + trade.ID.Hex(),
+		Kind:     models.TransferFee,
+		OrderID:  trade.OrderID,
+		TradeID:  trade.ID,
+		Sender:   os.Getenv("ESCROW_WALLET"),
+		Receiver: os.Getenv("FEE_WALLET"),
+		Amount:   trade.Fee,
+	})
+
+	return err
+}
+
+// SweepICOFee records the fee taken on ICO purchase purchaseID and queues it
+// to be swept from the ICO_WALLET to the FEE_WALLET, calling it again for the
+// same purchase never sweeps twice
+func (e *Escrow) SweepICOFee(purchaseID string, fee models.Money) error {
+	key := "ico_fee:" + purchaseID
+
+	err := e.ledger.Post(models.JournalEntry{
+		Reference: key,
+		Kind:      models.EntryICOFee,
+		Memo:      "fee on ico purchase " + purchaseID,
+		Postings: []models.Posting{
+			ledger.Debit(ledger.ICOWallet(), fee),
+			ledger.Credit(ledger.Fees(), fee),
+		},
+	})
 	if err != nil {
 		return err
 	}
 
-	// create escrow release for trade
-	escrowRelease := models.EscrowRelease{
-		ID:            primitive.NewObjectID(),
-		ParentID:      escrow.ID,
-		TradeID:       trade.ID,
-		Recipient:     trade.BuyerID,
-		Amount:        trade.Amount,
-		WalletAddress: receipient,
-		CreatedAt:     now,
+	_, err = e.enqueue(models.Transfer{
+		Key:      key,
+		Kind:     models.TransferICOFee,
+		Sender:   os.Getenv("ICO_WALLET"),
+		Receiver: os.Getenv("FEE_WALLET"),
+		Amount:   fee,
+	})
+
+	return err
+}
+
+// syncDeposit keeps the deposit summary in step with the seller hold on the
+// ledger
+func (e *Escrow) syncDeposit(escrow models.EscrowDeposit) error {
+	hold, err := e.ledger.Balance(ledger.SellerHold(escrow.OrderID))
+	if err != nil {
+		return err
 	}
 
-	b, _ = bson.Marshal(escrowRelease)
-	_, err = e.db.Collection("escrow_release").InsertOne(context.TODO(), b)
+	// only the release summary is set so frozen trades aren't overwritten
+	_, err = e.db.Collection("escrow").UpdateOne(context.TODO(), bson.M{"_id": escrow.ID}, bson.M{"$set": bson.M{
+		"released_amount": escrow.Amount.Sub(hold.Balance),
+		"released":        !hold.Balance.IsPositive(),
+		"updated_at":      time.Now().UTC(),
+	}})
 
 	return err
 }
 
+// applyDeposit records a settled deposit transfer
+func (e *Escrow) applyDeposit(t models.Transfer) error {
+	now := time.Now().UTC()
+	escrow := models.EscrowDeposit{
+		ID:           primitive.NewObjectID(),
+		OrderID:      t.OrderID,
+		UserID:       t.UserID,
+		SourceWallet: t.Sender,
+		Amount:       t.Amount,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	opts := options.Update().SetUpsert(true)
+	_, err := e.db.Collection("escrow").UpdateOne(context.TODO(), bson.M{
+		"order_id": t.OrderID,
+		"user_id":  t.UserID,
+	}, bson.M{"$setOnInsert": escrow}, opts)
+	if err != nil {
+		return err
+	}
+
+	return e.ledger.Post(models.JournalEntry{
+		Reference: t.Key,
+		Kind:      models.EntryDeposit,
+		OrderID:   t.OrderID,
+		Memo:      "seller deposit from " + t.Sender,
+		Postings: []models.Posting{
+			ledger.Debit(ledger.EscrowWallet(), t.Amount),
+			ledger.Credit(ledger.SellerHold(t.OrderID), t.Amount),
+		},
+	})
+}
+
 // GenCurrencyList ...
 func (e *Escrow) GenCurrencyList() {
 	dump := `
@@ -267,19 +442,3 @@ func (e *Escrow) GenCurrencyList() {
 	}
 
 }
-
-func postToChain(endpoint string, payload interface{}) (*http.Response, error) {
-	b, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
-	}
-
-	client := http.Client{Timeout: time.Second * 10}
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(b))
-	if err != nil {
-		return nil, err
-	}
-	req.Close = true
-	req.Header.Add("Content-Type", "application/json")
-	return client.Do(req)
-}
@@ -0,0 +1,361 @@
+package escrow
+
+import (
+	"vhennpay-bend/dao"
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/ledger"
+	"vhennpay-bend/utils/lid"
+	"vhennpay-bend/utils/scheduler"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	outboxInterval     = time.Second * 15
+	staleAfter         = time.Minute * 2
+	maxAttempts        = 10
+	maxBackoff         = time.Minute * 30
+	initialBackoffStep = time.Second * 10
+)
+
+// ErrOutcomeUnknown is returned when a transfer may or may not have reached
+// the chain, it is parked for review rather than resent
+var ErrOutcomeUnknown = errors.New("escrow: transfer outcome unknown, it is pending review")
+
+// enqueue records a pending transfer, enqueueing a key that already exists
+// returns the existing transfer untouched
+func (e *Escrow) enqueue(t models.Transfer) (models.Transfer, error) {
+	now := time.Now().UTC()
+	t.ID = primitive.NewObjectID()
+	t.Status = models.TransferPending
+	t.NextAttemptAt = now
+	t.CreatedAt = now
+	t.UpdatedAt = now
+
+	err := e.transfers.Insert(t)
+	if dao.IsDuplicateKey(err) {
+		return e.transfers.FindByKey(t.Key)
+	}
+
+	return t, err
+}
+
+// submit posts a claimed transfer to the chain and records the outcome
+// Transfers are only put back on the queue when the chain certainly didn't
+// apply them, anything else is parked as unknown so it's never sent twice
+// Client-signed transfers are relayed as signed, secret is only used for
+// transfers out of wallets we hold the key to
+func (e *Escrow) submit(t models.Transfer, secret string, retry bool) error {
+	var (
+		tx  lid.Transaction
+		err error
+	)
+	if t.Signature != "" {
+		tx, err = e.chain.TransferSigned(lid.SignedTransferReq{
+			Message:   t.Message,
+			PublicKey: t.PublicKey,
+			Signature: t.Signature,
+		})
+	} else {
+		tx, err = e.chain.Transfer(lid.TransferReq{
+			Sender:           t.Sender,
+			Receiver:         t.Receiver,
+			Amount:           t.Amount,
+			SenderPrivateKey: secret,
+		})
+	}
+
+	switch lid.KindOf(err) {
+	case lid.ErrTransport, lid.ErrUnavailable:
+		return e.fail(t, err, retry)
+	case lid.ErrRejected, lid.ErrNotFound:
+		return e.fail(t, err, false)
+	}
+	if err != nil {
+		if _, terr := e.transfers.Transition(t.ID, models.TransferSubmitting, bson.M{
+			"status":     models.TransferUnknown,
+			"last_error": err.Error(),
+		}); terr != nil {
+			log.Printf("escrow: failed to park transfer %s: %v", t.Key, terr)
+		}
+		log.Printf("escrow: transfer %s outcome unknown: %v", t.Key, err)
+		return ErrOutcomeUnknown
+	}
+
+	log.Printf("escrow: transfer %s posted to chain, tx %s", t.Key, tx.ID)
+
+	now := time.Now().UTC()
+	_, err = e.transfers.Transition(t.ID, models.TransferSubmitting, bson.M{
+		"status":        models.TransferSettled,
+		"response":      tx.Raw,
+		"tx_id":         tx.ID,
+		"tx_status":     tx.Status,
+		"confirmations": tx.Confirmations,
+		"last_error":    "",
+		"settled_at":    now,
+	})
+	if err != nil {
+		return err
+	}
+
+	t.Status = models.TransferSettled
+	t.TxID = tx.ID
+	t.SettledAt = now
+	return e.track(t, tx)
+}
+
+// fail puts a transfer back on the queue with backoff, or fails it for good
+func (e *Escrow) fail(t models.Transfer, cause error, retry bool) error {
+	set := bson.M{
+		"status":     models.TransferFailed,
+		"last_error": cause.Error(),
+	}
+
+	if retry && t.Attempts < maxAttempts {
+		set["status"] = models.TransferPending
+		set["next_attempt_at"] = time.Now().UTC().Add(backoff(t.Attempts))
+	}
+
+	ok, err := e.transfers.Transition(t.ID, models.TransferSubmitting, set)
+	if err != nil {
+		log.Printf("escrow: failed to update transfer %s: %v", t.Key, err)
+	}
+	if ok && set["status"] == models.TransferFailed {
+		e.failed(t)
+	}
+
+	return cause
+}
+
+// failed runs the hooks registered for a transfer that failed for good
+func (e *Escrow) failed(t models.Transfer) {
+	t.Status = models.TransferFailed
+	for _, fn := range e.failHooks[t.Kind] {
+		fn(t)
+	}
+}
+
+// apply records the effects of a confirmed transfer, it is safe to run more
+// than once for the same transfer
+func (e *Escrow) apply(t models.Transfer) error {
+	var err error
+
+	switch t.Kind {
+	case models.TransferDeposit:
+		err = e.applyDeposit(t)
+	case models.TransferRelease:
+		err = e.ledger.Post(models.JournalEntry{
+			Reference: "settled:" + t.Key,
+			Kind:      models.EntryPayout,
+			OrderID:   t.OrderID,
+			TradeID:   t.TradeID,
+			Memo:      "payout to " + t.Receiver,
+			Postings: []models.Posting{
+				ledger.Debit(ledger.BuyerPayout(t.UserID), t.Amount),
+				ledger.Credit(ledger.EscrowWallet(), t.Amount),
+			},
+		})
+	case models.TransferReversal:
+		err = e.ledger.Post(models.JournalEntry{
+			Reference: "settled:" + t.Key,
+			Kind:      models.EntryRefund,
+			OrderID:   t.OrderID,
+			Memo:      "refund to " + t.Receiver,
+			Postings: []models.Posting{
+				ledger.Debit(ledger.SellerRefund(t.UserID), t.Amount),
+				ledger.Credit(ledger.EscrowWallet(), t.Amount),
+			},
+		})
+	case models.TransferFee:
+		err = e.ledger.Post(models.JournalEntry{
+			Reference: "settled:" + t.Key,
+			Kind:      models.EntryFeeSweep,
+			OrderID:   t.OrderID,
+			TradeID:   t.TradeID,
+			Memo:      "fee sweep to " + t.Receiver,
+			Postings: []models.Posting{
+				ledger.Debit(ledger.FeeWallet(), t.Amount),
+				ledger.Credit(ledger.EscrowWallet(), t.Amount),
+			},
+		})
+	case models.TransferICOFee:
+		err = e.ledger.Post(models.JournalEntry{
+			Reference: "settled:" + t.Key,
+			Kind:      models.EntryFeeSweep,
+			Memo:      "ico fee sweep to " + t.Receiver,
+			Postings: []models.Posting{
+				ledger.Debit(ledger.FeeWallet(), t.Amount),
+				ledger.Credit(ledger.ICOWallet(), t.Amount),
+			},
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range e.hooks[t.Kind] {
+		fn(t)
+	}
+
+	_, err = e.transfers.Transition(t.ID, models.TransferConfirmed, bson.M{"applied": true})
+	return err
+}
+
+// ProcessOutbox submits due transfers and recovers interrupted ones
+func (e *Escrow) ProcessOutbox() error {
+	now := time.Now().UTC()
+
+	// a worker died mid submission, the outcome can't be told
+	n, err := e.transfers.ExpireStale(now.Add(-staleAfter))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("escrow: %d interrupted transfers need review", n)
+	}
+
+	// deposits the seller never signed
+	abandoned, err := e.transfers.Abandoned(now)
+	if err != nil {
+		return err
+	}
+	for _, t := range abandoned {
+		ok, err := e.transfers.Transition(t.ID, models.TransferPending, bson.M{
+			"status":     models.TransferFailed,
+			"last_error": "deposit was not signed in time",
+		})
+		if err != nil {
+			return err
+		}
+		if ok {
+			e.failed(t)
+		}
+	}
+
+	// confirmed transfers whose effects were never recorded
+	unapplied, err := e.transfers.Unapplied()
+	if err != nil {
+		return err
+	}
+	for _, t := range unapplied {
+		if err := e.apply(t); err != nil {
+			log.Printf("escrow: failed to apply transfer %s: %v", t.Key, err)
+		}
+	}
+
+	// deposits are only relayed once signed by the seller
+	for {
+		t, err := e.transfers.ClaimDue(now)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := e.submit(t, walletSecret(t), true); err != nil {
+			log.Printf("escrow: transfer %s not settled: %v", t.Key, err)
+		}
+	}
+}
+
+// RunOutbox processes the transfer outbox and tracks settled transfers
+func (e *Escrow) RunOutbox(now time.Time) error {
+	err := e.ProcessOutbox()
+	if err != nil {
+		log.Printf("error processing escrow outbox: %v", err)
+	}
+	if terr := e.TrackTransfers(); terr != nil {
+		log.Printf("error tracking escrow transfers: %v", terr)
+		if err == nil {
+			err = terr
+		}
+	}
+	return err
+}
+
+// RegisterJobs adds the escrow background jobs to sched
+func (e *Escrow) RegisterJobs(sched *scheduler.Scheduler) {
+	sched.Register("escrow_outbox", outboxInterval, e.RunOutbox)
+}
+
+// Transfers returns outbox transfers matching filter
+func (e *Escrow) Transfers(filter bson.M) ([]models.Transfer, error) {
+	return e.transfers.Query(filter)
+}
+
+// ResolveTransfer settles, requeues or fails a transfer parked as unknown
+// once its outcome has been checked on the chain, a settled transfer with a
+// tx id is tracked to finality and one without is taken as confirmed
+func (e *Escrow) ResolveTransfer(id string, status models.TransferStatus, txID string) error {
+	t, err := e.transfers.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	if t.Status != models.TransferUnknown {
+		return errors.New("Only transfers with an unknown outcome can be resolved")
+	}
+
+	set := bson.M{"status": status}
+	switch status {
+	case models.TransferSettled:
+		set["settled_at"] = time.Now().UTC()
+		if txID != "" {
+			set["tx_id"] = txID
+		} else {
+			set["status"] = models.TransferConfirmed
+			set["confirmed_at"] = time.Now().UTC()
+		}
+	case models.TransferPending:
+		if t.Kind == models.TransferDeposit && t.Signature == "" {
+			return errors.New("Unsigned deposits cannot be resubmitted")
+		}
+		set["next_attempt_at"] = time.Now().UTC()
+	case models.TransferFailed:
+	default:
+		return errors.New("Invalid transfer status")
+	}
+
+	ok, err := e.transfers.Transition(t.ID, models.TransferUnknown, set)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("Transfer has already been resolved")
+	}
+
+	switch set["status"] {
+	case models.TransferConfirmed:
+		t.Status = models.TransferConfirmed
+		return e.apply(t)
+	case models.TransferFailed:
+		e.failed(t)
+	}
+	return nil
+}
+
+// walletSecret returns the secret of the wallet t is sent from
+func walletSecret(t models.Transfer) string {
+	if t.Kind == models.TransferICOFee {
+		return os.Getenv("ICO_WALLET_SECRET")
+	}
+	return os.Getenv("ESCROW_WALLET_SECRET")
+}
+
+func backoff(attempts int) time.Duration {
+	d := initialBackoffStep
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,300 @@
+package escrow
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/lid"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memTransfers is an in-memory TransferStore enforcing the unique key index
+type memTransfers struct {
+	transfers []models.Transfer
+}
+
+func (s *memTransfers) Insert(transfer models.Transfer) error {
+	for _, t := range s.transfers {
+		if t.Key == transfer.Key {
+			return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+		}
+	}
+	s.transfers = append(s.transfers, transfer)
+	return nil
+}
+
+func (s *memTransfers) FindByKey(key string) (models.Transfer, error) {
+	for _, t := range s.transfers {
+		if t.Key == key {
+			return t, nil
+		}
+	}
+	return models.Transfer{}, mongo.ErrNoDocuments
+}
+
+func (s *memTransfers) FindByID(id string) (models.Transfer, error) {
+	for _, t := range s.transfers {
+		if t.ID.Hex() == id {
+			return t, nil
+		}
+	}
+	return models.Transfer{}, mongo.ErrNoDocuments
+}
+
+func (s *memTransfers) Query(filter bson.M) ([]models.Transfer, error) {
+	return s.where(func(t models.Transfer) bool {
+		status, ok := filter["status"]
+		return !ok || status == t.Status
+	}), nil
+}
+
+func (s *memTransfers) Transition(id primitive.ObjectID, from models.TransferStatus, set bson.M) (bool, error) {
+	for i, t := range s.transfers {
+		if t.ID != id || t.Status != from {
+			continue
+		}
+
+		// round trip through bson so set is applied the way $set would
+		var doc bson.M
+		raw, _ := bson.Marshal(t)
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return false, err
+		}
+		for k, v := range set {
+			doc[k] = v
+		}
+		doc["updated_at"] = time.Now().UTC()
+
+		var updated models.Transfer
+		raw, _ = bson.Marshal(doc)
+		if err := bson.Unmarshal(raw, &updated); err != nil {
+			return false, err
+		}
+		s.transfers[i] = updated
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *memTransfers) ExpireStale(before time.Time) (int64, error) {
+	var n int64
+	for i, t := range s.transfers {
+		if t.Status == models.TransferSubmitting && !t.UpdatedAt.After(before) {
+			s.transfers[i].Status = models.TransferUnknown
+			s.transfers[i].LastError = "submission interrupted"
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memTransfers) Abandoned(now time.Time) ([]models.Transfer, error) {
+	return s.where(func(t models.Transfer) bool {
+		return t.Status == models.TransferPending && t.Kind == models.TransferDeposit &&
+			t.Signature == "" && !t.ExpiresAt.After(now)
+	}), nil
+}
+
+func (s *memTransfers) Unapplied() ([]models.Transfer, error) {
+	return s.where(func(t models.Transfer) bool {
+		return t.Status == models.TransferConfirmed && !t.Applied
+	}), nil
+}
+
+func (s *memTransfers) ClaimDue(now time.Time) (models.Transfer, error) {
+	return s.claim(func(t models.Transfer) bool {
+		return t.Status == models.TransferPending && !t.NextAttemptAt.After(now) &&
+			(t.Kind != models.TransferDeposit || t.Signature != "")
+	})
+}
+
+func (s *memTransfers) ClaimPending(id primitive.ObjectID) (models.Transfer, error) {
+	return s.claim(func(t models.Transfer) bool {
+		return t.ID == id && t.Status == models.TransferPending
+	})
+}
+
+func (s *memTransfers) InFlight() ([]models.TransferTotal, error) {
+	return nil, nil
+}
+
+func (s *memTransfers) claim(match func(models.Transfer) bool) (models.Transfer, error) {
+	for i, t := range s.transfers {
+		if match(t) {
+			s.transfers[i].Status = models.TransferSubmitting
+			s.transfers[i].Attempts++
+			s.transfers[i].UpdatedAt = time.Now().UTC()
+			return s.transfers[i], nil
+		}
+	}
+	return models.Transfer{}, mongo.ErrNoDocuments
+}
+
+func (s *memTransfers) where(match func(models.Transfer) bool) []models.Transfer {
+	var transfers []models.Transfer
+	for _, t := range s.transfers {
+		if match(t) {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers
+}
+
+func newTestEscrow() (*Escrow, *memTransfers, *lid.FakeClient) {
+	store := &memTransfers{}
+	chain := lid.NewFakeClient(0)
+	return InitEscrow(nil, nil, store, chain), store, chain
+}
+
+func release(amount models.Money) models.Transfer {
+	return models.Transfer{
+		Key:      "release:" + primitive.NewObjectID().Hex(),
+		Kind:     models.TransferRelease,
+		OrderID:  primitive.NewObjectID(),
+		TradeID:  primitive.NewObjectID(),
+		UserID:   primitive.NewObjectID(),
+		Sender:   "escrow",
+		Receiver: "buyer",
+		Amount:   amount,
+	}
+}
+
+func TestEnqueueDuplicateKey(t *testing.T) {
+	e, store, _ := newTestEscrow()
+
+	first, err := e.enqueue(release(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dup := release(200)
+	dup.Key = first.Key
+	second, err := e.enqueue(dup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.transfers) != 1 {
+		t.Fatalf("transfers = %d, want 1", len(store.transfers))
+	}
+	if second.ID != first.ID || second.Amount != first.Amount {
+		t.Errorf("enqueue duplicate = %+v, want the existing transfer %+v", second, first)
+	}
+}
+
+func TestFailedSubmitBacksOff(t *testing.T) {
+	e, store, chain := newTestEscrow()
+
+	queued, err := e.enqueue(release(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain.Err = &lid.Error{Kind: lid.ErrTransport, Message: "connection refused"}
+	start := time.Now().UTC().Truncate(time.Millisecond)
+	if err := e.ProcessOutbox(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := store.FindByKey(queued.Key)
+	if got.Status != models.TransferPending {
+		t.Fatalf("status = %s, want %s", got.Status, models.TransferPending)
+	}
+	if got.Attempts != 1 || got.LastError == "" {
+		t.Errorf("attempts = %d, last error = %q, want 1 attempt with an error", got.Attempts, got.LastError)
+	}
+	if got.NextAttemptAt.Before(start.Add(initialBackoffStep)) {
+		t.Errorf("next attempt at %s, want no earlier than %s", got.NextAttemptAt, start.Add(initialBackoffStep))
+	}
+
+	// not due again until the backoff has passed
+	if err := e.ProcessOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.FindByKey(queued.Key); got.Attempts != 1 {
+		t.Errorf("attempts = %d, want the transfer left until due", got.Attempts)
+	}
+}
+
+func TestRejectedSubmitFails(t *testing.T) {
+	e, store, _ := newTestEscrow()
+
+	var failed []models.Transfer
+	e.OnFailed(models.TransferRelease, func(t models.Transfer) {
+		failed = append(failed, t)
+	})
+
+	// the fake chain rejects transfers from an empty wallet
+	queued, err := e.enqueue(release(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ProcessOutbox(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := store.FindByKey(queued.Key); got.Status != models.TransferFailed {
+		t.Errorf("status = %s, want %s", got.Status, models.TransferFailed)
+	}
+	if len(failed) != 1 || failed[0].Key != queued.Key {
+		t.Errorf("OnFailed ran for %v, want once for %s", failed, queued.Key)
+	}
+}
+
+func TestAbandonedDepositFails(t *testing.T) {
+	e, store, _ := newTestEscrow()
+
+	var failed []models.Transfer
+	e.OnFailed(models.TransferDeposit, func(t models.Transfer) {
+		failed = append(failed, t)
+	})
+
+	orderID := primitive.NewObjectID()
+	deposit, err := e.enqueue(models.Transfer{
+		Key:       "deposit:" + orderID.Hex(),
+		Kind:      models.TransferDeposit,
+		OrderID:   orderID,
+		Sender:    "seller",
+		Receiver:  "escrow",
+		Amount:    100,
+		ExpiresAt: time.Now().UTC().Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := e.ProcessOutbox(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, _ := store.FindByKey(deposit.Key)
+	if got.Status != models.TransferFailed || got.Attempts != 0 {
+		t.Errorf("status = %s after %d attempts, want %s without being sent", got.Status, got.Attempts, models.TransferFailed)
+	}
+	if len(failed) != 1 || failed[0].Status != models.TransferFailed {
+		t.Errorf("OnFailed ran %d times, want once with the failed deposit", len(failed))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, initialBackoffStep},
+		{1, initialBackoffStep},
+		{2, initialBackoffStep * 2},
+		{4, initialBackoffStep * 8},
+		{maxAttempts, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package escrow
+
+import (
+	"context"
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/ledger"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reconcile compares the on-chain escrow wallet balance with the ledger and
+// lists deposits left in escrow for orders that are no longer trading
+// Transfers the chain settled ahead of the ledger are taken out of the drift,
+// drift that transfers of unknown outcome could explain is not flagged
+func (e *Escrow) Reconcile() (models.ReconciliationReport, error) {
+	report := models.ReconciliationReport{
+		ID:        primitive.NewObjectID(),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	balance, err := e.chain.GetBalance(os.Getenv("ESCROW_WALLET"))
+	if err != nil {
+		return report, err
+	}
+	report.ChainBalance = balance.Balance
+
+	wallet, err := e.ledger.Balance(ledger.EscrowWallet())
+	if err != nil {
+		return report, err
+	}
+	report.LedgerBalance = wallet.Balance
+
+	inFlight, err := e.transfers.InFlight()
+	if err != nil {
+		return report, err
+	}
+	drifted := settleDrift(&report, inFlight)
+
+	holds, err := e.ledger.Balances(models.SellerHoldAccount)
+	if err != nil {
+		return report, err
+	}
+	for _, h := range holds {
+		report.SellerHolds = report.SellerHolds.Add(h.Balance)
+	}
+
+	report.UnreleasedDeposits, err = e.unreleasedDeposits()
+	if err != nil {
+		return report, err
+	}
+	report.HoldDrift = report.SellerHolds.Sub(report.UnreleasedDeposits)
+
+	report.OrphanedDeposits, err = e.OrphanedDeposits()
+	if err != nil {
+		return report, err
+	}
+
+	report.Drifted = drifted ||
+		!report.HoldDrift.IsZero() ||
+		len(report.OrphanedDeposits) > 0
+
+	return report, nil
+}
+
+// settleDrift sets the drift between the chain and ledger balances of report
+// once the transfers in flight are accounted for, reporting whether it is
+// more than the unresolved transfers could explain
+func settleDrift(report *models.ReconciliationReport, inFlight []models.TransferTotal) bool {
+	for _, t := range inFlight {
+		// ICO fee sweeps leave the ICO wallet, not escrow
+		if t.Kind == models.TransferICOFee {
+			continue
+		}
+		switch t.Status {
+		case models.TransferSettled, models.TransferConfirmed:
+			if t.Kind.Inbound() {
+				report.PendingIn = report.PendingIn.Add(t.Amount)
+			} else {
+				report.PendingOut = report.PendingOut.Add(t.Amount)
+			}
+		case models.TransferSubmitting, models.TransferUnknown:
+			if t.Kind.Inbound() {
+				report.UnresolvedIn = report.UnresolvedIn.Add(t.Amount)
+			} else {
+				report.UnresolvedOut = report.UnresolvedOut.Add(t.Amount)
+			}
+		}
+	}
+
+	report.Drift = report.ChainBalance.
+		Sub(report.LedgerBalance).
+		Sub(report.PendingIn).
+		Add(report.PendingOut)
+
+	return report.Drift.Cmp(report.UnresolvedIn) > 0 ||
+		report.Drift.Cmp(report.UnresolvedOut.Neg()) < 0
+}
+
+func (e *Escrow) unreleasedDeposits() (models.Money, error) {
+	var totals []struct {
+		Total models.Money `bson:"total"`
+	}
+
+	matches := bson.M{
+		"$match": bson.M{"released": false},
+	}
+	group := bson.M{
+		"$group": bson.M{
+			"_id":   nil,
+			"total": bson.M{"$sum": bson.M{"$subtract": []string{"$amount", "$released_amount"}}},
+		},
+	}
+
+	cursor, err := e.db.Collection("escrow").Aggregate(context.TODO(), []bson.M{matches, group})
+	if err != nil {
+		return 0, err
+	}
+	if err := cursor.All(context.TODO(), &totals); err != nil {
+		return 0, err
+	}
+
+	if len(totals) < 1 {
+		return 0, nil
+	}
+	return totals[0].Total, nil
+}
+
+// OrphanedDeposits lists the deposits left in escrow for orders that were
+// cancelled or failed
+func (e *Escrow) OrphanedDeposits() ([]models.OrphanedDeposit, error) {
+	deposits := []models.OrphanedDeposit{}
+
+	matches := bson.M{
+		"$match": bson.M{"released": false},
+	}
+	lookup := bson.M{
+		"$lookup": bson.M{
+			"from":         "orders",
+			"localField":   "order_id",
+			"foreignField": "_id",
+			"as":           "order",
+		},
+	}
+	unwind := bson.M{
+		"$unwind": "$order",
+	}
+	orphaned := bson.M{
+		"$match": bson.M{"order.status": bson.M{"$in": []string{models.OrderCancelled, models.OrderFailed}}},
+	}
+	project := bson.M{
+		"$project": bson.M{
+			"order_id":     1,
+			"user_id":      1,
+			"unreleased":   bson.M{"$subtract": []string{"$amount", "$released_amount"}},
+			"order_status": "$order.status",
+		},
+	}
+
+	pipeline := []bson.M{matches, lookup, unwind, orphaned, project}
+	cursor, err := e.db.Collection("escrow").Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(context.TODO(), &deposits)
+
+	return deposits, err
+}
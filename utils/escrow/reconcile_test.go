@@ -0,0 +1,48 @@
+package escrow
+
+import (
+	"vhennpay-bend/models"
+	"testing"
+)
+
+func TestSettleDrift(t *testing.T) {
+	tests := []struct {
+		name     string
+		chain    models.Money
+		ledger   models.Money
+		inFlight []models.TransferTotal
+		drift    models.Money
+		drifted  bool
+	}{
+		{"balanced", 500, 500, nil, 0, false},
+		{"deposit settled ahead of the ledger", 600, 500, []models.TransferTotal{
+			{Kind: models.TransferDeposit, Status: models.TransferSettled, Amount: 100},
+		}, 0, false},
+		{"release confirmed but not applied", 400, 500, []models.TransferTotal{
+			{Kind: models.TransferRelease, Status: models.TransferConfirmed, Amount: 70},
+			{Kind: models.TransferFee, Status: models.TransferSettled, Amount: 30},
+		}, 0, false},
+		{"release being submitted", 420, 500, []models.TransferTotal{
+			{Kind: models.TransferRelease, Status: models.TransferSubmitting, Amount: 80},
+		}, -80, false},
+		{"unknown deposit not on the chain", 500, 500, []models.TransferTotal{
+			{Kind: models.TransferDeposit, Status: models.TransferUnknown, Amount: 100},
+		}, 0, false},
+		{"more missing than in flight", 300, 500, []models.TransferTotal{
+			{Kind: models.TransferRelease, Status: models.TransferSettled, Amount: 100},
+			{Kind: models.TransferReversal, Status: models.TransferUnknown, Amount: 50},
+		}, -100, true},
+		{"unexplained surplus", 550, 500, nil, 50, true},
+		{"ico fee sweep", 500, 500, []models.TransferTotal{
+			{Kind: models.TransferICOFee, Status: models.TransferSettled, Amount: 10},
+		}, 0, false},
+	}
+
+	for _, tt := range tests {
+		report := models.ReconciliationReport{ChainBalance: tt.chain, LedgerBalance: tt.ledger}
+		drifted := settleDrift(&report, tt.inFlight)
+		if report.Drift != tt.drift || drifted != tt.drifted {
+			t.Errorf("%s: drift = %s, drifted = %v, want %s, %v", tt.name, report.Drift, drifted, tt.drift, tt.drifted)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package escrow
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/lid"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// defaultConfirmations is used when LID_MIN_CONFIRMATIONS isn't set
+	defaultConfirmations = 3
+	// txLostAfter is how long a transaction may stay unknown to the chain
+	// before it is parked for review
+	txLostAfter = time.Minute * 30
+)
+
+// minConfirmations returns the confirmations a transaction needs to be final
+func minConfirmations() int {
+	n, err := strconv.Atoi(os.Getenv("LID_MIN_CONFIRMATIONS"))
+	if err != nil || n < 1 {
+		return defaultConfirmations
+	}
+	return n
+}
+
+// TrackTransfers polls the chain for every settled transfer and confirms
+// those that have become final
+func (e *Escrow) TrackTransfers() error {
+	settled, err := e.transfers.Query(bson.M{"status": models.TransferSettled})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range settled {
+		if t.TxID == "" {
+			// the chain didn't return a transaction to follow
+			if err := e.track(t, lid.Transaction{Status: lid.TxConfirmed, Confirmations: minConfirmations()}); err != nil {
+				log.Printf("escrow: failed to confirm transfer %s: %v", t.Key, err)
+			}
+			continue
+		}
+
+		tx, err := e.chain.GetTransaction(t.TxID)
+		if lid.KindOf(err) == lid.ErrNotFound {
+			if time.Since(t.SettledAt) > txLostAfter {
+				e.park(t, "transaction "+t.TxID+" not found on chain")
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("escrow: failed to check tx %s: %v", t.TxID, err)
+			continue
+		}
+
+		if err := e.track(t, tx); err != nil {
+			log.Printf("escrow: failed to track transfer %s: %v", t.Key, err)
+		}
+	}
+	return nil
+}
+
+// track records the chain status of a settled transfer's transaction,
+// confirming the transfer once it's final and requeueing it if it failed
+func (e *Escrow) track(t models.Transfer, tx lid.Transaction) error {
+	if tx.Status == lid.TxFailed {
+		set := bson.M{
+			"status":     models.TransferFailed,
+			"tx_status":  tx.Status,
+			"last_error": "transaction " + t.TxID + " failed on chain",
+		}
+		if t.Attempts < maxAttempts {
+			set["status"] = models.TransferPending
+			set["next_attempt_at"] = time.Now().UTC().Add(backoff(t.Attempts))
+		}
+
+		ok, err := e.transfers.Transition(t.ID, models.TransferSettled, set)
+		if ok && set["status"] == models.TransferFailed {
+			e.failed(t)
+		}
+		return err
+	}
+
+	if tx.Status != lid.TxConfirmed || tx.Confirmations < minConfirmations() {
+		_, err := e.transfers.Transition(t.ID, models.TransferSettled, bson.M{
+			"tx_status":     tx.Status,
+			"confirmations": tx.Confirmations,
+		})
+		return err
+	}
+
+	now := time.Now().UTC()
+	ok, err := e.transfers.Transition(t.ID, models.TransferSettled, bson.M{
+		"status":        models.TransferConfirmed,
+		"tx_status":     tx.Status,
+		"confirmations": tx.Confirmations,
+		"confirmed_at":  now,
+	})
+	if err != nil || !ok {
+		return err
+	}
+
+	log.Printf("escrow: transfer %s confirmed, tx %s", t.Key, t.TxID)
+	t.Status = models.TransferConfirmed
+	t.ConfirmedAt = now
+	return e.apply(t)
+}
+
+// park moves a settled transfer whose transaction can't be found to unknown
+// for review
+func (e *Escrow) park(t models.Transfer, reason string) {
+	_, err := e.transfers.Transition(t.ID, models.TransferSettled, bson.M{
+		"status":     models.TransferUnknown,
+		"last_error": reason,
+	})
+	if err != nil {
+		log.Printf("escrow: failed to park transfer %s: %v", t.Key, err)
+	}
+	log.Printf("escrow: transfer %s needs review: %s", t.Key, reason)
+}
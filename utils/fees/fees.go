@@ -0,0 +1,205 @@
+package fees
+
+import (
+	"vhennpay-bend/dao"
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/ledger"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fee engine errors
+var (
+	ErrInvalidRule   = errors.New("fees: rule must have a scope and a non-negative percent and flat")
+	ErrInvalidPeriod = errors.New("fees: period must be day or month")
+)
+
+// periods maps a reporting period to its $dateToString format
+var periods = map[string]string{
+	"day":   "%Y-%m-%d",
+	"month": "%Y-%m",
+}
+
+// Engine looks up the fee schedule charged on trades and ICO purchases
+type Engine struct {
+	dao    *dao.FeeDAO
+	ledger *ledger.Ledger
+}
+
+// NewEngine returns a new fee Engine
+func NewEngine(dao *dao.FeeDAO, ledger *ledger.Ledger) *Engine {
+	return &Engine{dao, ledger}
+}
+
+// Schedule returns the schedule of the most specific active rule matching q,
+// no fee is charged when there's none
+func (e *Engine) Schedule(q models.FeeQuery) (models.FeeSchedule, error) {
+	rules, err := e.dao.Query(bson.M{"scope": q.Scope, "active": true})
+	if err != nil {
+		return models.FeeSchedule{}, err
+	}
+	return pick(rules, q), nil
+}
+
+// pick returns the schedule of the most specific of rules matching q, the
+// first of equally specific rules wins
+func pick(rules []models.FeeRule, q models.FeeQuery) models.FeeSchedule {
+	best := -1
+	var schedule models.FeeSchedule
+	for _, rule := range rules {
+		score, ok := match(rule, q)
+		if ok && score > best {
+			best = score
+			schedule = rule.FeeSchedule
+		}
+	}
+	return schedule
+}
+
+// match reports whether rule applies to q and how specific it is, rules are
+// queried most recently updated first so ties go to the newest
+func match(rule models.FeeRule, q models.FeeQuery) (int, bool) {
+	score := 0
+	if rule.Currency != "" {
+		if !strings.EqualFold(rule.Currency, q.Currency) {
+			return 0, false
+		}
+		score++
+	}
+	if rule.PaymentOption != nil {
+		if *rule.PaymentOption != q.PaymentOption {
+			return 0, false
+		}
+		score++
+	}
+	if rule.Tier != "" {
+		if rule.Tier != tierOf(q.Tier) {
+			return 0, false
+		}
+		score++
+	}
+	return score, true
+}
+
+// tierOf returns the tier users without one are charged at
+func tierOf(tier string) string {
+	if tier == "" {
+		return models.TierStandard
+	}
+	return tier
+}
+
+// Rules returns the fee rules matching filter
+func (e *Engine) Rules(filter bson.M) ([]models.FeeRule, error) {
+	return e.dao.Query(filter)
+}
+
+// CreateRule validates and stores a new fee rule
+func (e *Engine) CreateRule(req models.FeeRuleReq) (models.FeeRule, error) {
+	now := time.Now().UTC()
+	rule := models.FeeRule{
+		ID:        primitive.NewObjectID(),
+		CreatedAt: now,
+	}
+	fill(&rule, req, now)
+	if err := validate(rule); err != nil {
+		return rule, err
+	}
+
+	return rule, e.dao.Insert(rule)
+}
+
+// UpdateRule replaces the fee rule with id by req
+func (e *Engine) UpdateRule(id string, req models.FeeRuleReq) (models.FeeRule, error) {
+	rule, err := e.dao.FindByID(id)
+	if err != nil {
+		return rule, err
+	}
+
+	fill(&rule, req, time.Now().UTC())
+	if err := validate(rule); err != nil {
+		return rule, err
+	}
+
+	return rule, e.dao.Update(rule)
+}
+
+// DeleteRule removes the fee rule with id
+func (e *Engine) DeleteRule(id string) error {
+	rule, err := e.dao.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return e.dao.Remove(rule.ID)
+}
+
+func fill(rule *models.FeeRule, req models.FeeRuleReq, now time.Time) {
+	rule.Scope = req.Scope
+	rule.Currency = req.Currency
+	rule.PaymentOption = req.PaymentOption
+	rule.Tier = req.Tier
+	rule.Percent = req.Percent
+	rule.Flat = req.Flat
+	rule.Active = req.Active
+	rule.UpdatedAt = now
+}
+
+func validate(rule models.FeeRule) error {
+	if rule.Scope != models.FeeScopeTrade && rule.Scope != models.FeeScopeICO {
+		return ErrInvalidRule
+	}
+	if rule.Percent < 0 || rule.Flat < 0 || rule.Percent.Cmp(models.MoneyFromFloat(100)) > 0 {
+		return ErrInvalidRule
+	}
+	return nil
+}
+
+// Income returns the fee income per period between from and to, read from
+// the ledger fees account, ICO fees are the ones recorded by ICO purchases
+// and trade fees the rest
+func (e *Engine) Income(from, to time.Time, period string) ([]models.FeeIncome, error) {
+	format, ok := periods[period]
+	if !ok {
+		return nil, ErrInvalidPeriod
+	}
+
+	totals, err := e.ledger.PeriodTotals(ledger.Fees(), from, to, format)
+	if err != nil {
+		return nil, err
+	}
+	ico, err := e.ledger.PeriodTotals(ledger.Fees(), from, to, format, models.EntryICOFee)
+	if err != nil {
+		return nil, err
+	}
+
+	byPeriod := make(map[string]*models.FeeIncome)
+	var keys []string
+	get := func(p string) *models.FeeIncome {
+		if i, ok := byPeriod[p]; ok {
+			return i
+		}
+		byPeriod[p] = &models.FeeIncome{Period: p}
+		keys = append(keys, p)
+		return byPeriod[p]
+	}
+	for _, t := range totals {
+		get(t.Account).Total = t.Balance
+	}
+	for _, t := range ico {
+		get(t.Account).ICOFees = t.Balance
+	}
+
+	sort.Strings(keys)
+	income := make([]models.FeeIncome, 0, len(keys))
+	for _, k := range keys {
+		i := byPeriod[k]
+		i.TradeFees = i.Total.Sub(i.ICOFees)
+		income = append(income, *i)
+	}
+	return income, nil
+}
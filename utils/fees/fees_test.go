@@ -0,0 +1,96 @@
+package fees
+
+import (
+	"vhennpay-bend/models"
+	"testing"
+)
+
+func money(s string) models.Money {
+	m, err := models.ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestMatch(t *testing.T) {
+	bank, paypal := models.Bank, models.PayPal
+
+	tests := []struct {
+		name  string
+		rule  models.FeeRule
+		query models.FeeQuery
+		score int
+		ok    bool
+	}{
+		{"wildcard", models.FeeRule{}, models.FeeQuery{Currency: "NGN"}, 0, true},
+		{"currency", models.FeeRule{Currency: "NGN"}, models.FeeQuery{Currency: "NGN"}, 1, true},
+		{"currency in another case", models.FeeRule{Currency: "ngn"}, models.FeeQuery{Currency: "NGN"}, 1, true},
+		{"other currency", models.FeeRule{Currency: "USD"}, models.FeeQuery{Currency: "NGN"}, 0, false},
+		{"payment option", models.FeeRule{PaymentOption: &bank}, models.FeeQuery{PaymentOption: models.Bank}, 1, true},
+		{"other payment option", models.FeeRule{PaymentOption: &paypal}, models.FeeQuery{PaymentOption: models.Bank}, 0, false},
+		{"standard tier", models.FeeRule{Tier: models.TierStandard}, models.FeeQuery{}, 1, true},
+		{"other tier", models.FeeRule{Tier: models.TierPro}, models.FeeQuery{Tier: models.TierVerified}, 0, false},
+		{"every field", models.FeeRule{Currency: "NGN", PaymentOption: &bank, Tier: models.TierPro},
+			models.FeeQuery{Currency: "ngn", PaymentOption: models.Bank, Tier: models.TierPro}, 3, true},
+	}
+	for _, tt := range tests {
+		score, ok := match(tt.rule, tt.query)
+		if score != tt.score || ok != tt.ok {
+			t.Errorf("%s: match = %d, %v, want %d, %v", tt.name, score, ok, tt.score, tt.ok)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	bank := models.Bank
+	rule := func(currency string, option *models.PaymentOption, tier, percent, flat string) models.FeeRule {
+		return models.FeeRule{
+			Currency:      currency,
+			PaymentOption: option,
+			Tier:          tier,
+			FeeSchedule:   models.FeeSchedule{Percent: money(percent), Flat: money(flat)},
+		}
+	}
+
+	// rules come most recently updated first
+	rules := []models.FeeRule{
+		rule("", nil, "", "1", "0"),
+		rule("", nil, "", "9", "0"),
+		rule("NGN", nil, "", "0.5", "0"),
+		rule("NGN", &bank, "", "0.25", "0"),
+		rule("usd", nil, models.TierPro, "0", "5"),
+		rule("USD", &bank, models.TierPro, "2", "1"),
+	}
+
+	tests := []struct {
+		name         string
+		query        models.FeeQuery
+		amount, want string
+		wantPercent  string
+		wantFlat     string
+	}{
+		{"newest of the wildcards", models.FeeQuery{Currency: "GHS"}, "100", "1", "1", "0"},
+		{"currency over wildcard", models.FeeQuery{Currency: "ngn", PaymentOption: models.PayPal}, "100", "0.5", "0.5", "0"},
+		{"currency and option over currency", models.FeeQuery{Currency: "NGN", PaymentOption: models.Bank}, "100", "0.25", "0.25", "0"},
+		{"most specific", models.FeeQuery{Currency: "USD", PaymentOption: models.Bank, Tier: models.TierPro}, "100", "3", "2", "1"},
+		{"flat fee clamped to the amount", models.FeeQuery{Currency: "USD", PaymentOption: models.PayPal, Tier: models.TierPro}, "2", "2", "0", "5"},
+		{"tier not matched", models.FeeQuery{Currency: "USD", PaymentOption: models.PayPal}, "100", "1", "1", "0"},
+	}
+	for _, tt := range tests {
+		schedule := pick(rules, tt.query)
+		if schedule.Percent != money(tt.wantPercent) || schedule.Flat != money(tt.wantFlat) {
+			t.Errorf("%s: pick = %+v, want percent %s flat %s", tt.name, schedule, tt.wantPercent, tt.wantFlat)
+			continue
+		}
+
+		fee, err := schedule.Apply(money(tt.amount))
+		if err != nil || fee != money(tt.want) {
+			t.Errorf("%s: Apply(%s) = %s (%v), want %s", tt.name, tt.amount, fee, err, tt.want)
+		}
+	}
+
+	if schedule := pick(nil, models.FeeQuery{Currency: "NGN"}); schedule != (models.FeeSchedule{}) {
+		t.Errorf("pick without rules = %+v, want no fee", schedule)
+	}
+}
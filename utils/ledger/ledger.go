@@ -0,0 +1,194 @@
+package ledger
+
+import (
+	"vhennpay-bend/dao"
+	"vhennpay-bend/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ledger errors
+var (
+	ErrUnbalancedEntry = errors.New("ledger: journal entry debits and credits do not balance")
+	ErrInvalidPosting  = errors.New("ledger: posting must carry a single positive debit or credit")
+	ErrMissingRef      = errors.New("ledger: journal entry has no reference")
+)
+
+// Store records journal entries and sums their postings, dao.LedgerDAO is the
+// store backed by the database
+type Store interface {
+	Insert(entry models.JournalEntry) error
+	FindByReference(reference string) (models.JournalEntry, error)
+	Entries(filter bson.M) ([]models.JournalEntry, error)
+	Balances(filter bson.M) ([]models.AccountBalance, error)
+	PeriodTotals(account string, from, to time.Time, format string, kinds ...models.JournalEntryKind) ([]models.AccountBalance, error)
+}
+
+// Ledger represents the double-entry escrow ledger
+type Ledger struct {
+	dao Store
+}
+
+// NewLedger returns a new Ledger
+func NewLedger(dao Store) *Ledger {
+	return &Ledger{dao}
+}
+
+// EscrowWallet returns the account mirroring the on-chain escrow wallet
+func EscrowWallet() models.LedgerAccount {
+	return models.LedgerAccount{Type: models.EscrowWalletAccount}
+}
+
+// SellerHold returns the account holding a seller's deposit for an order
+func SellerHold(orderID primitive.ObjectID) models.LedgerAccount {
+	return models.LedgerAccount{Type: models.SellerHoldAccount, Owner: orderID.Hex()}
+}
+
+// BuyerPayout returns the account of amounts released to a buyer
+func BuyerPayout(buyerID primitive.ObjectID) models.LedgerAccount {
+	return models.LedgerAccount{Type: models.BuyerPayoutAccount, Owner: buyerID.Hex()}
+}
+
+// SellerRefund returns the account of amounts reversed to a seller
+func SellerRefund(sellerID primitive.ObjectID) models.LedgerAccount {
+	return models.LedgerAccount{Type: models.SellerRefundAccount, Owner: sellerID.Hex()}
+}
+
+// Fees returns the platform fee income account
+func Fees() models.LedgerAccount {
+	return models.LedgerAccount{Type: models.FeesAccount}
+}
+
+// FeeWallet returns the account mirroring the on-chain FEE_WALLET balance
+func FeeWallet() models.LedgerAccount {
+	return models.LedgerAccount{Type: models.FeeWalletAccount}
+}
+
+// ICOWallet returns the account of ICO fees not yet swept to the FEE_WALLET
+func ICOWallet() models.LedgerAccount {
+	return models.LedgerAccount{Type: models.ICOWalletAccount}
+}
+
+// Debit returns a debit posting against account
+func Debit(account models.LedgerAccount, amount models.Money) models.Posting {
+	return models.Posting{Account: account.Code(), AccountType: account.Type, Debit: amount}
+}
+
+// Credit returns a credit posting against account
+func Credit(account models.LedgerAccount, amount models.Money) models.Posting {
+	return models.Posting{Account: account.Code(), AccountType: account.Type, Credit: amount}
+}
+
+// Post validates and records a journal entry, posting an entry whose
+// reference was already recorded is a no-op
+func (l *Ledger) Post(entry models.JournalEntry) error {
+	if entry.Reference == "" {
+		return ErrMissingRef
+	}
+
+	if len(entry.Postings) < 2 {
+		return ErrUnbalancedEntry
+	}
+
+	var debits, credits models.Money
+	for _, p := range entry.Postings {
+		if p.Debit < 0 || p.Credit < 0 || p.Debit.IsPositive() == p.Credit.IsPositive() {
+			return ErrInvalidPosting
+		}
+		debits = debits.Add(p.Debit)
+		credits = credits.Add(p.Credit)
+	}
+
+	if debits != credits {
+		return ErrUnbalancedEntry
+	}
+
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now().UTC()
+
+	err := l.dao.Insert(entry)
+	if dao.IsDuplicateKey(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ledger: failed to record %s entry: %v", entry.Kind, err)
+	}
+	return nil
+}
+
+// Entry retrieves the journal entry recorded under reference
+func (l *Ledger) Entry(reference string) (models.JournalEntry, error) {
+	return l.dao.FindByReference(reference)
+}
+
+// Balance returns the balance of a single account
+func (l *Ledger) Balance(account models.LedgerAccount) (models.AccountBalance, error) {
+	balances, err := l.dao.Balances(bson.M{"postings.account": account.Code()})
+	if err != nil {
+		return models.AccountBalance{}, err
+	}
+
+	if len(balances) < 1 {
+		return models.AccountBalance{Account: account.Code(), AccountType: account.Type}, nil
+	}
+
+	return withBalance(balances[0]), nil
+}
+
+// Balances returns the balance of every account of the given type, or of
+// every account when accountType is empty
+func (l *Ledger) Balances(accountType models.LedgerAccountType) ([]models.AccountBalance, error) {
+	filter := bson.M{}
+	if accountType != "" {
+		filter["postings.account_type"] = accountType
+	}
+
+	balances, err := l.dao.Balances(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range balances {
+		balances[i] = withBalance(balances[i])
+	}
+	return balances, nil
+}
+
+// History returns every journal entry that touched account, newest first
+func (l *Ledger) History(account models.LedgerAccount) ([]models.JournalEntry, error) {
+	return l.dao.Entries(bson.M{"postings.account": account.Code()})
+}
+
+// OrderEntries returns every journal entry recorded for an order
+func (l *Ledger) OrderEntries(orderID primitive.ObjectID) ([]models.JournalEntry, error) {
+	return l.dao.Entries(bson.M{"order_id": orderID})
+}
+
+// PeriodTotals returns the balance movement of account per period between
+// from and to, the period of each total is held in its Account field
+// Only entries of the given kinds are totalled when any are given
+func (l *Ledger) PeriodTotals(account models.LedgerAccount, from, to time.Time, format string, kinds ...models.JournalEntryKind) ([]models.AccountBalance, error) {
+	totals, err := l.dao.PeriodTotals(account.Code(), from, to, format, kinds...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range totals {
+		totals[i].AccountType = account.Type
+		totals[i] = withBalance(totals[i])
+	}
+	return totals, nil
+}
+
+func withBalance(b models.AccountBalance) models.AccountBalance {
+	if b.AccountType.DebitNormal() {
+		b.Balance = b.Debits.Sub(b.Credits)
+	} else {
+		b.Balance = b.Credits.Sub(b.Debits)
+	}
+	return b
+}
@@ -0,0 +1,190 @@
+package ledger
+
+import (
+	"vhennpay-bend/models"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memStore is an in-memory Store enforcing the unique reference index
+type memStore struct {
+	entries []models.JournalEntry
+}
+
+func (s *memStore) Insert(entry models.JournalEntry) error {
+	for _, e := range s.entries {
+		if e.Reference == entry.Reference {
+			return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+		}
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *memStore) FindByReference(reference string) (models.JournalEntry, error) {
+	for _, e := range s.entries {
+		if e.Reference == reference {
+			return e, nil
+		}
+	}
+	return models.JournalEntry{}, mongo.ErrNoDocuments
+}
+
+func (s *memStore) Entries(filter bson.M) ([]models.JournalEntry, error) {
+	var entries []models.JournalEntry
+	for _, e := range s.entries {
+		for _, p := range e.Postings {
+			if matchPosting(p, filter) {
+				entries = append(entries, e)
+				break
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (s *memStore) Balances(filter bson.M) ([]models.AccountBalance, error) {
+	totals := make(map[string]models.AccountBalance)
+	for _, e := range s.entries {
+		for _, p := range e.Postings {
+			if !matchPosting(p, filter) {
+				continue
+			}
+			b := totals[p.Account]
+			b.Account = p.Account
+			b.AccountType = p.AccountType
+			b.Debits = b.Debits.Add(p.Debit)
+			b.Credits = b.Credits.Add(p.Credit)
+			b.Entries++
+			totals[p.Account] = b
+		}
+	}
+
+	var balances []models.AccountBalance
+	for _, b := range totals {
+		balances = append(balances, b)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Account < balances[j].Account })
+	return balances, nil
+}
+
+func (s *memStore) PeriodTotals(account string, from, to time.Time, format string, kinds ...models.JournalEntryKind) ([]models.AccountBalance, error) {
+	return nil, nil
+}
+
+func matchPosting(p models.Posting, filter bson.M) bool {
+	if v, ok := filter["postings.account"]; ok && v != p.Account {
+		return false
+	}
+	if v, ok := filter["postings.account_type"]; ok && v != p.AccountType {
+		return false
+	}
+	return true
+}
+
+func money(s string) models.Money {
+	m, err := models.ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func deposit(ref string, orderID primitive.ObjectID, amount models.Money) models.JournalEntry {
+	return models.JournalEntry{
+		Reference: ref,
+		Kind:      models.EntryDeposit,
+		OrderID:   orderID,
+		Postings: []models.Posting{
+			Debit(EscrowWallet(), amount),
+			Credit(SellerHold(orderID), amount),
+		},
+	}
+}
+
+func TestPostDuplicateReference(t *testing.T) {
+	store := &memStore{}
+	l := NewLedger(store)
+	orderID := primitive.NewObjectID()
+	amount := money("25")
+
+	for i := 0; i < 2; i++ {
+		if err := l.Post(deposit("deposit:"+orderID.Hex(), orderID, amount)); err != nil {
+			t.Fatalf("Post #%d: %v", i+1, err)
+		}
+	}
+
+	if len(store.entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(store.entries))
+	}
+
+	wallet, err := l.Balance(EscrowWallet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Balance != amount {
+		t.Errorf("escrow wallet = %s, want %s", wallet.Balance, amount)
+	}
+
+	hold, err := l.Balance(SellerHold(orderID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hold.Balance != amount {
+		t.Errorf("seller hold = %s, want %s", hold.Balance, amount)
+	}
+}
+
+func TestPostRejectsInvalidEntries(t *testing.T) {
+	orderID := primitive.NewObjectID()
+	ten := money("10")
+
+	tests := []struct {
+		name  string
+		entry models.JournalEntry
+		want  error
+	}{
+		{"no reference", deposit("", orderID, ten), ErrMissingRef},
+		{"single posting", models.JournalEntry{
+			Reference: "one",
+			Postings:  []models.Posting{Debit(EscrowWallet(), ten)},
+		}, ErrUnbalancedEntry},
+		{"unbalanced", models.JournalEntry{
+			Reference: "unbalanced",
+			Postings: []models.Posting{
+				Debit(EscrowWallet(), ten),
+				Credit(SellerHold(orderID), money("9")),
+			},
+		}, ErrUnbalancedEntry},
+		{"zero posting", models.JournalEntry{
+			Reference: "zero",
+			Postings: []models.Posting{
+				Debit(EscrowWallet(), 0),
+				Credit(SellerHold(orderID), 0),
+			},
+		}, ErrInvalidPosting},
+		{"two sided posting", models.JournalEntry{
+			Reference: "two sided",
+			Postings: []models.Posting{
+				{Account: EscrowWallet().Code(), Debit: ten, Credit: ten},
+				Credit(SellerHold(orderID), ten),
+				Debit(Fees(), ten),
+			},
+		}, ErrInvalidPosting},
+	}
+
+	for _, tt := range tests {
+		store := &memStore{}
+		if err := NewLedger(store).Post(tt.entry); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if len(store.entries) != 0 {
+			t.Errorf("%s: invalid entry was recorded", tt.name)
+		}
+	}
+}
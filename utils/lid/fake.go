@@ -0,0 +1,142 @@
+package lid
+
+import (
+	"vhennpay-bend/models"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// FakeClient is an in-memory ChainClient for tests and local development
+type FakeClient struct {
+	mu           sync.Mutex
+	Price        Price
+	Balances     map[string]models.Money
+	Transactions map[string]Transaction
+	// PublicKeys maps wallet addresses to hex encoded ed25519 public keys
+	PublicKeys map[string]string
+	// Err, when set, is returned by the next call and then cleared
+	Err error
+}
+
+// NewFakeClient returns an empty FakeClient quoting price
+func NewFakeClient(price models.Money) *FakeClient {
+	return &FakeClient{
+		Price:        Price{CurrentPrice: price},
+		Balances:     make(map[string]models.Money),
+		Transactions: make(map[string]Transaction),
+		PublicKeys:   make(map[string]string),
+	}
+}
+
+// Transfer ...
+func (c *FakeClient) Transfer(req TransferReq) (Transaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.takeErr(); err != nil {
+		return Transaction{}, err
+	}
+
+	return c.transfer(req)
+}
+
+// TransferSigned ...
+func (c *FakeClient) TransferSigned(req SignedTransferReq) (Transaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.takeErr(); err != nil {
+		return Transaction{}, err
+	}
+
+	var p TransferPayload
+	if err := json.Unmarshal([]byte(req.Message), &p); err != nil {
+		return Transaction{}, &Error{Kind: ErrRejected, StatusCode: 400, Message: "invalid transfer message"}
+	}
+	if c.PublicKeys[p.Sender] != req.PublicKey || Verify(req.PublicKey, req.Message, req.Signature) != nil {
+		return Transaction{}, &Error{Kind: ErrRejected, StatusCode: 400, Message: "invalid transfer signature"}
+	}
+
+	amount, err := models.ParseMoney(p.Amount)
+	if err != nil {
+		return Transaction{}, &Error{Kind: ErrRejected, StatusCode: 400, Message: "invalid transfer amount"}
+	}
+
+	return c.transfer(TransferReq{Sender: p.Sender, Receiver: p.Receiver, Amount: amount})
+}
+
+func (c *FakeClient) transfer(req TransferReq) (Transaction, error) {
+	if !req.Amount.IsPositive() || c.Balances[req.Sender].Cmp(req.Amount) < 0 {
+		return Transaction{}, &Error{Kind: ErrRejected, StatusCode: 400, Message: "Error posting transaction to QUI chain: insufficient balance"}
+	}
+
+	c.Balances[req.Sender] = c.Balances[req.Sender].Sub(req.Amount)
+	c.Balances[req.Receiver] = c.Balances[req.Receiver].Add(req.Amount)
+
+	tx := Transaction{
+		ID:            fmt.Sprintf("tx-%d", len(c.Transactions)+1),
+		Sender:        req.Sender,
+		Receiver:      req.Receiver,
+		Amount:        req.Amount,
+		Status:        "confirmed",
+		Confirmations: 1,
+	}
+	c.Transactions[tx.ID] = tx
+
+	return tx, nil
+}
+
+// GetWallet ...
+func (c *FakeClient) GetWallet(address string) (Wallet, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.takeErr(); err != nil {
+		return Wallet{}, err
+	}
+
+	key, ok := c.PublicKeys[address]
+	if !ok {
+		return Wallet{}, &Error{Kind: ErrNotFound, StatusCode: 404, Message: "wallet not found"}
+	}
+	return Wallet{Address: address, PublicKey: key}, nil
+}
+
+// GetPrice ...
+func (c *FakeClient) GetPrice() (Price, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.Price, c.takeErr()
+}
+
+// GetBalance ...
+func (c *FakeClient) GetBalance(address string) (Balance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Balance{Address: address, Balance: c.Balances[address]}, c.takeErr()
+}
+
+// GetTransaction ...
+func (c *FakeClient) GetTransaction(id string) (Transaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.takeErr(); err != nil {
+		return Transaction{}, err
+	}
+
+	tx, ok := c.Transactions[id]
+	if !ok {
+		return tx, &Error{Kind: ErrNotFound, StatusCode: 404, Message: "transaction not found"}
+	}
+	return tx, nil
+}
+
+func (c *FakeClient) takeErr() error {
+	err := c.Err
+	c.Err = nil
+	return err
+}
@@ -0,0 +1,196 @@
+package lid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Lid network API endpoints
+const (
+	transferPath       = "/api/v1/wallet/transfer"
+	signedTransferPath = "/api/v1/wallet/transfer/signed"
+	pricePath          = "/api/v1/price"
+	walletPath         = "/api/v1/wallet/%s"
+	balancePath        = "/api/v1/wallet/%s/balance"
+	transactionPath    = "/api/v1/transactions/%s"
+)
+
+type httpClient struct {
+	base   string
+	client *http.Client
+}
+
+// NewHTTPClient returns a ChainClient talking to the LID server at base
+func NewHTTPClient(base string) ChainClient {
+	return &httpClient{
+		base:   base,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+// Transfer ...
+func (c *httpClient) Transfer(req TransferReq) (Transaction, error) {
+	var tx Transaction
+
+	payload := map[string]string{
+		"sender_address":     req.Sender,
+		"reciever_address":   req.Receiver,
+		"amount":             req.Amount.String(),
+		"sender_private_key": req.SenderPrivateKey,
+	}
+
+	raw, err := c.do("POST", transferPath, payload, &tx)
+	if err != nil {
+		return tx, err
+	}
+
+	tx.Raw = raw
+	return tx, nil
+}
+
+// TransferSigned ...
+func (c *httpClient) TransferSigned(req SignedTransferReq) (Transaction, error) {
+	var tx Transaction
+
+	payload := map[string]string{
+		"message":    req.Message,
+		"public_key": req.PublicKey,
+		"signature":  req.Signature,
+	}
+
+	raw, err := c.do("POST", signedTransferPath, payload, &tx)
+	if err != nil {
+		return tx, err
+	}
+
+	tx.Raw = raw
+	return tx, nil
+}
+
+// GetWallet ...
+func (c *httpClient) GetWallet(address string) (Wallet, error) {
+	var wallet Wallet
+	_, err := c.do("GET", sprintfPath(walletPath, address), nil, &wallet)
+	wallet.Address = address
+	return wallet, err
+}
+
+// GetPrice ...
+func (c *httpClient) GetPrice() (Price, error) {
+	var price Price
+	_, err := c.do("GET", pricePath, nil, &price)
+	return price, err
+}
+
+// GetBalance ...
+func (c *httpClient) GetBalance(address string) (Balance, error) {
+	var balance Balance
+	_, err := c.do("GET", sprintfPath(balancePath, address), nil, &balance)
+	balance.Address = address
+	return balance, err
+}
+
+// GetTransaction ...
+func (c *httpClient) GetTransaction(id string) (Transaction, error) {
+	var tx Transaction
+	raw, err := c.do("GET", sprintfPath(transactionPath, id), nil, &tx)
+	tx.Raw = raw
+	return tx, err
+}
+
+// do sends a request and decodes the "data" member of the response into out,
+// failures are returned as *Error
+func (c *httpClient) do(method, path string, payload, out interface{}) (string, error) {
+	var body []byte
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return "", &Error{Kind: ErrTransport, Message: "failed to encode request", Err: err}
+		}
+		body = b
+	}
+
+	req, err := http.NewRequest(method, c.base+path, bytes.NewBuffer(body))
+	if err != nil {
+		return "", &Error{Kind: ErrTransport, Message: "failed to build request", Err: err}
+	}
+	req.Close = true
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		kind := ErrUnknown
+		if isDialError(err) || method == "GET" {
+			kind = ErrTransport
+		}
+		return "", &Error{Kind: kind, Message: "request to the QUI chain failed", Err: err}
+	}
+	defer resp.Body.Close()
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	raw := string(b)
+
+	if resp.StatusCode >= 300 {
+		return raw, responseError(method, resp.StatusCode, b)
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(b, &envelope); err != nil || out == nil {
+		// the chain accepted the request, an unreadable body doesn't change that
+		return raw, nil
+	}
+	if len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, out); err != nil && method == "GET" {
+			return raw, &Error{Kind: ErrUnknown, StatusCode: resp.StatusCode, Message: "failed to read data from the QUI chain", Err: err}
+		}
+	}
+
+	return raw, nil
+}
+
+// responseError classifies a failed response, a server error on a request
+// that moves coins may come from a proxy after the chain applied it so only
+// reads are retried on one
+func responseError(method string, status int, body []byte) error {
+	var d map[string]interface{}
+	msg := "Failed to read transaction data from the QUI chain"
+	if err := json.Unmarshal(body, &d); err == nil {
+		if m, ok := d["error"].(string); ok {
+			msg = "Error posting transaction to QUI chain: " + m
+		}
+	}
+
+	kind := ErrRejected
+	switch {
+	case status == http.StatusNotFound:
+		kind = ErrNotFound
+	case status >= 500 && method == "GET":
+		kind = ErrUnavailable
+	case status >= 500:
+		kind = ErrUnknown
+	}
+
+	return &Error{Kind: kind, StatusCode: status, Message: msg}
+}
+
+// isDialError reports whether err happened before the request reached the
+// chain
+func isDialError(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	operr, ok := err.(*net.OpError)
+	return ok && operr.Op == "dial"
+}
+
+func sprintfPath(format, arg string) string {
+	return fmt.Sprintf(format, url.PathEscape(arg))
+}
@@ -0,0 +1,70 @@
+package lid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPClientErrorKinds(t *testing.T) {
+	cases := []struct {
+		status int
+		get    bool
+		kind   ErrorKind
+	}{
+		{http.StatusBadRequest, false, ErrRejected},
+		{http.StatusNotFound, false, ErrNotFound},
+		// a proxy may fail a transfer the chain already applied
+		{http.StatusBadGateway, false, ErrUnknown},
+		{http.StatusGatewayTimeout, false, ErrUnknown},
+		{http.StatusBadGateway, true, ErrUnavailable},
+	}
+
+	for _, c := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			w.Write([]byte(`{"error": "nope"}`))
+		}))
+
+		client := NewHTTPClient(srv.URL)
+		var err error
+		if c.get {
+			_, err = client.GetTransaction("tx")
+		} else {
+			_, err = client.Transfer(TransferReq{Sender: "a", Receiver: "b", Amount: 1})
+		}
+		if KindOf(err) != c.kind {
+			t.Errorf("status %d (get %v): kind = %v, want %v", c.status, c.get, KindOf(err), c.kind)
+		}
+		srv.Close()
+	}
+}
+
+func TestHTTPClientGetPrice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != pricePath {
+			t.Errorf("path = %s, want %s", r.URL.Path, pricePath)
+		}
+		w.Write([]byte(`{"data": {"current_price": 1.5}}`))
+	}))
+	defer srv.Close()
+
+	price, err := NewHTTPClient(srv.URL).GetPrice()
+	if err != nil {
+		t.Fatalf("GetPrice: %v", err)
+	}
+	if price.CurrentPrice.String() != "1.5" {
+		t.Errorf("price = %s, want 1.5", price.CurrentPrice)
+	}
+}
+
+func TestHTTPClientUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := srv.URL
+	srv.Close()
+
+	_, err := NewHTTPClient(addr).Transfer(TransferReq{Sender: "a", Receiver: "b", Amount: 1})
+	if e, ok := err.(*Error); !ok || !e.Retryable() {
+		t.Errorf("err = %v, want retryable transport error", err)
+	}
+}
@@ -0,0 +1,118 @@
+package lid
+
+import (
+	"vhennpay-bend/models"
+	"fmt"
+)
+
+// ChainClient defines access to the LID network
+type ChainClient interface {
+	// Transfer posts a signed-by-key transfer to the chain
+	Transfer(req TransferReq) (Transaction, error)
+	// TransferSigned relays a transfer already signed by its sender
+	TransferSigned(req SignedTransferReq) (Transaction, error)
+	// GetWallet returns a wallet address and its public key
+	GetWallet(address string) (Wallet, error)
+	// GetPrice returns the current Quicoin reference price
+	GetPrice() (Price, error)
+	// GetBalance returns the balance held by a wallet address
+	GetBalance(address string) (Balance, error)
+	// GetTransaction retrieves a transaction by its id
+	GetTransaction(id string) (Transaction, error)
+}
+
+// TransferReq represents a transfer between two wallets
+type TransferReq struct {
+	Sender           string
+	Receiver         string
+	Amount           models.Money
+	SenderPrivateKey string
+}
+
+// Transaction statuses reported by the chain
+const (
+	TxPending   = "pending"
+	TxConfirmed = "confirmed"
+	TxFailed    = "failed"
+)
+
+// Transaction represents a transaction known to the chain
+type Transaction struct {
+	ID            string       `json:"id"`
+	Sender        string       `json:"sender_address"`
+	Receiver      string       `json:"reciever_address"`
+	Amount        models.Money `json:"amount"`
+	Status        string       `json:"status"`
+	Confirmations int          `json:"confirmations"`
+	// Raw holds the undecoded chain response
+	Raw string `json:"-"`
+}
+
+// Price represents the Quicoin reference price
+type Price struct {
+	CurrentPrice models.Money `json:"current_price"`
+}
+
+// Wallet represents a wallet known to the chain
+type Wallet struct {
+	Address   string `json:"address"`
+	PublicKey string `json:"public_key"`
+}
+
+// Balance represents a wallet balance
+type Balance struct {
+	Address string       `json:"address"`
+	Balance models.Money `json:"balance"`
+}
+
+// ErrorKind classifies chain errors by what they say about the request
+type ErrorKind int
+
+// Error kinds
+const (
+	// ErrTransport requests never reached the chain
+	ErrTransport ErrorKind = iota
+	// ErrUnknown requests may or may not have been applied by the chain
+	ErrUnknown
+	// ErrRejected requests were refused by the chain
+	ErrRejected
+	// ErrUnavailable requests failed on the chain side and can be retried
+	ErrUnavailable
+	// ErrNotFound requests referenced something the chain doesn't know
+	ErrNotFound
+)
+
+// Error represents a failed chain request
+type Error struct {
+	Kind       ErrorKind
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("lid: %s: %v", e.Message, e.Err)
+	}
+	return "lid: " + e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request certainly wasn't applied and may be
+// sent again
+func (e *Error) Retryable() bool {
+	return e.Kind == ErrTransport || e.Kind == ErrUnavailable
+}
+
+// KindOf returns the kind of a chain error, errors not raised by a
+// ChainClient are treated as ErrUnknown
+func KindOf(err error) ErrorKind {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return ErrUnknown
+}
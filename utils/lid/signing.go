@@ -0,0 +1,68 @@
+package lid
+
+import (
+	"vhennpay-bend/models"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a signed transfer doesn't verify
+// against the sender's public key
+var ErrInvalidSignature = errors.New("lid: transfer signature is invalid")
+
+// TransferPayload is an unsigned transfer, the sender signs the bytes of
+// Message on their own device so their private key never leaves it
+type TransferPayload struct {
+	Sender    string `json:"sender_address"`
+	Receiver  string `json:"reciever_address"`
+	Amount    string `json:"amount"`
+	Nonce     string `json:"nonce"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// NewTransferPayload returns the payload for sending amount from sender to
+// receiver, nonce must be unique to the transfer
+func NewTransferPayload(sender, receiver string, amount models.Money, nonce string, expiresAt time.Time) TransferPayload {
+	return TransferPayload{
+		Sender:    sender,
+		Receiver:  receiver,
+		Amount:    amount.String(),
+		Nonce:     nonce,
+		ExpiresAt: expiresAt.Unix(),
+	}
+}
+
+// Message returns the canonical message to sign
+func (p TransferPayload) Message() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// SignedTransferReq represents a transfer message and the sender's signature
+// over it, both hex encoded keys and signatures are ed25519
+type SignedTransferReq struct {
+	Message   string
+	PublicKey string
+	Signature string
+}
+
+// Verify checks signature is the ed25519 signature of message by publicKey
+func Verify(publicKey, message, signature string) error {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return ErrInvalidSignature
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), []byte(message), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
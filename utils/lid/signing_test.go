@@ -0,0 +1,43 @@
+package lid
+
+import (
+	"vhennpay-bend/models"
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestSignedTransfer(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := hex.EncodeToString(pub)
+
+	amount, _ := models.ParseMoney("12.5")
+	msg := NewTransferPayload("seller", "escrow", amount, "deposit:1", time.Now().Add(time.Minute)).Message()
+	sig := hex.EncodeToString(ed25519.Sign(priv, []byte(msg)))
+
+	if err := Verify(publicKey, msg, sig); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := Verify(publicKey, msg+" ", sig); err != ErrInvalidSignature {
+		t.Errorf("Verify tampered message err = %v, want ErrInvalidSignature", err)
+	}
+	if err := Verify("zz", msg, sig); err != ErrInvalidSignature {
+		t.Errorf("Verify bad key err = %v, want ErrInvalidSignature", err)
+	}
+
+	chain := NewFakeClient(0)
+	chain.Balances["seller"] = amount
+	chain.PublicKeys["seller"] = publicKey
+
+	tx, err := chain.TransferSigned(SignedTransferReq{Message: msg, PublicKey: publicKey, Signature: sig})
+	if err != nil {
+		t.Fatalf("TransferSigned: %v", err)
+	}
+	if tx.Amount != amount || chain.Balances["escrow"] != amount {
+		t.Errorf("escrow balance = %s, want %s", chain.Balances["escrow"], amount)
+	}
+}
@@ -1,13 +1,16 @@
 package notifications
 
 import (
+	"vhennpay-bend/models"
 	"vhennpay-bend/utils"
 )
 
-// GenericOrderData represents the OrderCreated email notification data
+// GenericOrderData represents the OrderCreated email notification data, Fiat
+// is the fiat amount of a trade when it is known
 type GenericOrderData struct {
 	OrderID string
-	Amount  float64
+	Amount  models.Money
+	Fiat    string
 	Name    string
 	Seller  string
 }
@@ -22,7 +25,8 @@ type GenericEmailData struct {
 type BuyIntentData struct {
 	Name          string
 	OrderID       string
-	Amount        float64
+	Amount        models.Money
+	Fiat          string
 	BuyerUsername string
 }
 
@@ -63,9 +63,9 @@ func (n *notifiable) SendOrderIntentNotification(trade models.BuyTrade, buyerid,
 	seller, err := n.getUser(sellerid)
 	cErr("rtv_seller", err)
 
-	message := fmt.Sprintf(orderNewIntentMsg, buyer.Username, trade.Amount)
+	message := fmt.Sprintf(orderNewIntentMsg, buyer.Username, trade.AmountText())
 
-	data := BuyIntentData{Name: seller.Username, OrderID: trade.OrderID.Hex(), BuyerUsername: buyer.Username, Amount: trade.Amount}
+	data := BuyIntentData{Name: seller.Username, OrderID: trade.OrderID.Hex(), BuyerUsername: buyer.Username, Amount: trade.Amount, Fiat: trade.FiatText()}
 	err = SendBuyIntentMail(seller.Email, data)
 	cErr("err_send_buyintent_mail", err)
 
@@ -83,8 +83,8 @@ func (n *notifiable) SendOrderConfirmedNotification(trade models.BuyTrade, buyer
 	seller, err := n.getUser(trade.SellerID.Hex())
 	cErr("rtv_seller", err)
 
-	message := fmt.Sprintf("Your trade for %fQC has been marked as confirmed", trade.Amount)
-	data := GenericOrderData{Name: buyer.Username, Amount: trade.Amount, Seller: seller.Username}
+	message := fmt.Sprintf("Your trade for %s has been marked as confirmed", trade.AmountText())
+	data := GenericOrderData{Name: buyer.Username, Amount: trade.Amount, Fiat: trade.FiatText(), Seller: seller.Username}
 	err = SendOrderConfirmedMail(buyer.Email, data)
 	cErr("err_order_confirmed_mail", err)
 
@@ -0,0 +1,78 @@
+package pricing
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/lid"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Default cache lifetimes
+const (
+	DefaultTTL    = time.Minute
+	DefaultMaxAge = 10 * time.Minute
+)
+
+// ErrNoPrice is returned when the chain quotes no usable price and no recent
+// enough price is cached
+var ErrNoPrice = errors.New("pricing: reference price unavailable")
+
+// Service serves the Quicoin reference price the LID chain quotes, cached so
+// pricing orders doesn't call the chain every time
+// Prices are cached for ttl, when the chain can't be reached a cached price
+// is served until it is maxAge old
+type Service struct {
+	chain    lid.ChainClient
+	currency string
+	ttl      time.Duration
+	maxAge   time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	price     models.Money
+	fetchedAt time.Time
+}
+
+// NewService returns a Service caching the price chain quotes in currency
+// for ttl, stale prices are served for up to maxAge
+func NewService(chain lid.ChainClient, currency string, ttl, maxAge time.Duration) *Service {
+	return &Service{
+		chain:    chain,
+		currency: currency,
+		ttl:      ttl,
+		maxAge:   maxAge,
+		now:      time.Now,
+	}
+}
+
+// Currency returns the currency the reference price is quoted in
+func (s *Service) Currency() string {
+	return s.currency
+}
+
+// Price returns the reference price of one Quicoin
+func (s *Service) Price() (models.Money, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	age := now.Sub(s.fetchedAt)
+	if s.price.IsPositive() && age < s.ttl {
+		return s.price, nil
+	}
+
+	p, err := s.chain.GetPrice()
+	if err == nil && !p.CurrentPrice.IsPositive() {
+		err = ErrNoPrice
+	}
+	if err != nil {
+		if s.price.IsPositive() && age < s.maxAge {
+			return s.price, nil
+		}
+		return 0, err
+	}
+
+	s.price, s.fetchedAt = p.CurrentPrice, now
+	return s.price, nil
+}
@@ -0,0 +1,48 @@
+package pricing
+
+import (
+	"vhennpay-bend/models"
+	"vhennpay-bend/utils/lid"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestServicePrice(t *testing.T) {
+	chain := lid.NewFakeClient(models.Money(200000000))
+	s := NewService(chain, "USD", time.Minute, 10*time.Minute)
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	if p, err := s.Price(); err != nil || p != models.Money(200000000) {
+		t.Fatalf("Price() = %s, %v, want 2", p, err)
+	}
+
+	// cached until the ttl runs out
+	chain.Price.CurrentPrice = models.Money(300000000)
+	now = now.Add(30 * time.Second)
+	if p, _ := s.Price(); p != models.Money(200000000) {
+		t.Errorf("cached Price() = %s, want 2", p)
+	}
+	now = now.Add(time.Minute)
+	if p, _ := s.Price(); p != models.Money(300000000) {
+		t.Errorf("refreshed Price() = %s, want 3", p)
+	}
+
+	// a stale price is served while the chain is down, up to maxAge
+	chain.Err = errors.New("unreachable")
+	now = now.Add(5 * time.Minute)
+	if p, err := s.Price(); err != nil || p != models.Money(300000000) {
+		t.Errorf("stale Price() = %s, %v, want 3", p, err)
+	}
+	chain.Err = errors.New("unreachable")
+	now = now.Add(10 * time.Minute)
+	if _, err := s.Price(); err == nil {
+		t.Error("Price() past maxAge succeeded, want error")
+	}
+
+	chain.Price.CurrentPrice = 0
+	if _, err := s.Price(); err != ErrNoPrice {
+		t.Errorf("Price() of zero quote error = %v, want ErrNoPrice", err)
+	}
+}
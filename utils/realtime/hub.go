@@ -0,0 +1,172 @@
+// Package realtime keeps the WebSocket connections of users following a
+// room, such as a trade's chat, and fans events out to them
+// Connections are held in memory, so users are only seen as connected by
+// the instance serving their socket
+package realtime
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long a write to a connection may take
+	writeWait = time.Second * 10
+	// pongWait is how long a connection may stay silent before it is
+	// dropped, pings are sent every pingPeriod to keep it talking
+	pongWait   = time.Second * 60
+	pingPeriod = pongWait * 9 / 10
+	// maxFrameSize is the largest frame read from a connection, in bytes
+	maxFrameSize = 16 << 10
+	// sendBuffer is how many events may be queued for a connection, a
+	// connection falling further behind is dropped
+	sendBuffer = 32
+)
+
+// Hub tracks the connections joined to each room
+type Hub struct {
+	mu    sync.RWMutex
+	rooms map[string]map[*Conn]struct{}
+}
+
+// NewHub returns a new Hub
+func NewHub() *Hub {
+	return &Hub{rooms: map[string]map[*Conn]struct{}{}}
+}
+
+// Conn is a user's connection joined to a room
+type Conn struct {
+	UserID string
+
+	hub  *Hub
+	ws   *websocket.Conn
+	room string
+	send chan interface{}
+	once sync.Once
+	done chan struct{}
+}
+
+// Join adds ws to room for userID, the connection receives the room's
+// events once it is served
+func (h *Hub) Join(room, userID string, ws *websocket.Conn) *Conn {
+	c := &Conn{
+		UserID: userID,
+		hub:    h,
+		ws:     ws,
+		room:   room,
+		send:   make(chan interface{}, sendBuffer),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[*Conn]struct{}{}
+	}
+	h.rooms[room][c] = struct{}{}
+	return c
+}
+
+// leave removes c from its room
+func (h *Hub) leave(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.rooms[c.room], c)
+	if len(h.rooms[c.room]) == 0 {
+		delete(h.rooms, c.room)
+	}
+}
+
+// Broadcast sends v as JSON to every connection in room except `except`,
+// which may be nil
+func (h *Hub) Broadcast(room string, v interface{}, except *Conn) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.rooms[room] {
+		if c != except {
+			c.Send(v)
+		}
+	}
+}
+
+// Online reports whether userID has a connection in room
+func (h *Hub) Online(room, userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.rooms[room] {
+		if c.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Send queues v to be written to c as JSON, a connection whose queue is
+// full is closed rather than holding up the sender
+func (c *Conn) Send(v interface{}) {
+	select {
+	case <-c.done:
+	case c.send <- v:
+	default:
+		log.Printf("realtime: dropping slow connection of user %s in %s", c.UserID, c.room)
+		c.close()
+	}
+}
+
+func (c *Conn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+}
+
+// Serve passes each frame read from c to handle until the connection is
+// closed, then removes c from its room
+func (c *Conn) Serve(handle func(data []byte)) {
+	defer c.hub.leave(c)
+	defer c.close()
+	go c.write()
+
+	c.ws.SetReadLimit(maxFrameSize)
+	c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("realtime: connection of user %s in %s failed: %v", c.UserID, c.room, err)
+			}
+			return
+		}
+		handle(data)
+	}
+}
+
+// write sends queued events and pings to c until it is closed
+func (c *Conn) write() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	defer c.close()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case v := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.ws.WriteJSON(v); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
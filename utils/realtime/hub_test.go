@@ -0,0 +1,71 @@
+package realtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHubBroadcast(t *testing.T) {
+	hub := NewHub()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := hub.Join("trade", r.URL.Query().Get("user"), ws)
+		c.Serve(func(data []byte) {
+			hub.Broadcast("trade", map[string]string{"from": c.UserID, "text": string(data)}, c)
+		})
+	}))
+	defer srv.Close()
+
+	dial := func(user string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?user=" + user
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("dial %s: %v", user, err)
+		}
+		return ws
+	}
+	buyer := dial("buyer")
+	seller := dial("seller")
+	defer seller.Close()
+
+	waitFor := func(want bool) {
+		deadline := time.Now().Add(time.Second)
+		for hub.Online("trade", "buyer") != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Online(buyer) = %v, want %v", !want, want)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+	waitFor(true)
+	if hub.Online("trade", "someone") {
+		t.Error("Online(someone) = true, want false")
+	}
+	for !hub.Online("trade", "seller") {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if err := buyer.WriteMessage(websocket.TextMessage, []byte("paid")); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	seller.SetReadDeadline(time.Now().Add(time.Second))
+	if err := seller.ReadJSON(&got); err != nil {
+		t.Fatalf("seller read: %v", err)
+	}
+	if got["from"] != "buyer" || got["text"] != "paid" {
+		t.Errorf("seller got %v, want paid from buyer", got)
+	}
+
+	buyer.Close()
+	waitFor(false)
+}
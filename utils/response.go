@@ -1,17 +1,21 @@
 package utils
 
 import (
+	"vhennpay-bend/models"
 	"encoding/json"
 	"net/http"
 )
 
-// Response represents a generic response
+// Response represents a generic response, Page is set on pages of a
+// paginated list and ErrorCode on errors clients act on
 type Response struct {
-	Status  string      `json:"status"`
-	Code    int         `json:"code"`
-	Data    interface{} `json:"data"`
-	Message string      `json:"message"`
-	Error   string      `json:"error"`
+	Status    string           `json:"status"`
+	Code      int              `json:"code"`
+	Data      interface{}      `json:"data"`
+	Page      *models.PageInfo `json:"page,omitempty"`
+	Message   string           `json:"message"`
+	Error     string           `json:"error"`
+	ErrorCode string           `json:"error_code,omitempty"`
 }
 
 // RespondWithError sends an error response
@@ -23,6 +27,17 @@ func RespondWithError(w http.ResponseWriter, code int, msg string) {
 	})
 }
 
+// RespondWithErrorCode sends an error response with a machine readable
+// errCode
+func RespondWithErrorCode(w http.ResponseWriter, code int, errCode, msg string) {
+	RespondWithJSON(w, code, Response{
+		Status:    "error",
+		Code:      code,
+		Error:     msg,
+		ErrorCode: errCode,
+	})
+}
+
 // RespondWithOk response
 func RespondWithOk(w http.ResponseWriter, msg string) {
 	RespondWithJSON(w, http.StatusOK, Response{
@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"vhennpay-bend/models"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// pollInterval is how often the scheduler looks for due jobs
+	pollInterval = time.Second * 5
+	// minLease is the shortest lease a job run is given, the lease is renewed
+	// every third of it while the run lasts
+	minLease = time.Minute * 2
+	// initialBackoff is the wait before retrying a failed run, it doubles on
+	// each consecutive failure up to the job's interval
+	initialBackoff = time.Second * 10
+)
+
+// Func is a job's work for a run started at now
+type Func func(now time.Time) error
+
+type job struct {
+	name     string
+	interval time.Duration
+	fn       Func
+}
+
+// Store records jobs and their leases, dao.JobDAO is the store backed by
+// the database
+type Store interface {
+	Ensure(name string, interval time.Duration) error
+	Acquire(name, owner string, now, until time.Time) (models.Job, error)
+	Renew(name, owner string, until time.Time) (bool, error)
+	Complete(name, owner string, run models.JobRun) error
+	FindAll() ([]models.Job, error)
+}
+
+// Scheduler runs registered jobs on their interval, jobs are recorded in the
+// jobs collection and leased so each run happens on a single instance
+type Scheduler struct {
+	dao      Store
+	owner    string
+	jobs     []job
+	minLease time.Duration
+}
+
+// NewScheduler returns a new Scheduler, owner identifies this instance on
+// the leases it takes
+func NewScheduler(dao Store) *Scheduler {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d-%s", host, os.Getpid(), primitive.NewObjectID().Hex())
+	return &Scheduler{dao: dao, owner: owner, minLease: minLease}
+}
+
+// Register adds a job run every interval, it must be called before Start
+func (s *Scheduler) Register(name string, interval time.Duration, fn Func) {
+	s.jobs = append(s.jobs, job{name: name, interval: interval, fn: fn})
+}
+
+// Start records the registered jobs and runs those due until the process
+// exits
+func (s *Scheduler) Start() {
+	for _, j := range s.jobs {
+		if err := s.dao.Ensure(j.name, j.interval); err != nil {
+			log.Printf("scheduler: failed to record job %s: %v", j.name, err)
+		}
+	}
+	log.Printf("scheduler: started as %s with %d jobs", s.owner, len(s.jobs))
+
+	for {
+		for _, j := range s.jobs {
+			s.runIfDue(j)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// runIfDue runs j when it is due and no other instance holds its lease
+func (s *Scheduler) runIfDue(j job) {
+	now := time.Now().UTC()
+	lease := j.interval
+	if lease < s.minLease {
+		lease = s.minLease
+	}
+
+	state, err := s.dao.Acquire(j.name, s.owner, now, now.Add(lease))
+	if err == mongo.ErrNoDocuments {
+		return
+	}
+	if err != nil {
+		log.Printf("scheduler: failed to lease job %s: %v", j.name, err)
+		return
+	}
+
+	// the lease is held for as long as the run lasts
+	done, held := make(chan struct{}), make(chan struct{})
+	go func() {
+		s.hold(j, lease, done)
+		close(held)
+	}()
+
+	run := models.JobRun{StartedAt: now}
+	run.Err = s.call(j, now)
+	close(done)
+	<-held
+	run.Duration = time.Since(now)
+	run.NextRunAt = now.Add(j.interval)
+	if run.Err != nil {
+		log.Printf("scheduler: job %s failed: %v", j.name, run.Err)
+		run.NextRunAt = now.Add(backoff(state.ConsecutiveFailures, j.interval))
+	}
+
+	if err := s.dao.Complete(j.name, s.owner, run); err != nil {
+		log.Printf("scheduler: failed to record run of job %s: %v", j.name, err)
+	}
+}
+
+// hold renews the lease on j every third of lease until done is closed, so
+// a run outliving its first lease isn't started again on another instance
+func (s *Scheduler) hold(j job, lease time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			ok, err := s.dao.Renew(j.name, s.owner, now.UTC().Add(lease))
+			if err != nil {
+				log.Printf("scheduler: failed to renew lease on job %s: %v", j.name, err)
+				continue
+			}
+			if !ok {
+				log.Printf("scheduler: lost the lease on job %s", j.name)
+				return
+			}
+		}
+	}
+}
+
+// call runs j, a panicking job fails its run rather than the scheduler
+func (s *Scheduler) call(j job, now time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return j.fn(now)
+}
+
+// backoff returns the wait before retrying a job that already failed
+// `failures` times in a row, it is never longer than the job's interval
+func backoff(failures int, interval time.Duration) time.Duration {
+	wait := initialBackoff
+	for i := 0; i < failures && wait < interval; i++ {
+		wait *= 2
+	}
+	if wait > interval {
+		return interval
+	}
+	return wait
+}
+
+// Jobs returns every scheduled job with its metrics
+func (s *Scheduler) Jobs() ([]models.Job, error) {
+	return s.dao.FindAll()
+}
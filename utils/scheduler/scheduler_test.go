@@ -0,0 +1,219 @@
+package scheduler
+
+import (
+	"vhennpay-bend/models"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memJobs is an in-memory Store leasing jobs under the conditions of the
+// dao.JobDAO.Acquire filter, a due job not leased by another live owner
+type memJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*models.Job
+}
+
+func newMemJobs() *memJobs {
+	return &memJobs{jobs: make(map[string]*models.Job)}
+}
+
+func (s *memJobs) Ensure(name string, interval time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; !ok {
+		s.jobs[name] = &models.Job{Name: name, NextRunAt: time.Now().UTC()}
+	}
+	s.jobs[name].IntervalSeconds = int64(interval / time.Second)
+	return nil
+}
+
+func (s *memJobs) Acquire(name, owner string, now, until time.Time) (models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[name]
+	if !ok || job.NextRunAt.After(now) {
+		return models.Job{}, mongo.ErrNoDocuments
+	}
+	if job.LeaseOwner != owner && !job.LeaseUntil.Before(now) {
+		return models.Job{}, mongo.ErrNoDocuments
+	}
+	job.LeaseOwner = owner
+	job.LeaseUntil = until
+	return *job, nil
+}
+
+func (s *memJobs) Renew(name, owner string, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[name]
+	if !ok || job.LeaseOwner != owner {
+		return false, nil
+	}
+	job.LeaseUntil = until
+	return true, nil
+}
+
+func (s *memJobs) Complete(name, owner string, run models.JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[name]
+	if !ok || job.LeaseOwner != owner {
+		return nil
+	}
+	job.LeaseOwner = ""
+	job.LeaseUntil = time.Time{}
+	job.NextRunAt = run.NextRunAt
+	job.LastRunAt = run.StartedAt
+	job.Runs++
+	if run.Err != nil {
+		job.LastError = run.Err.Error()
+		job.Failures++
+		job.ConsecutiveFailures++
+	} else {
+		job.LastError = ""
+		job.ConsecutiveFailures = 0
+	}
+	return nil
+}
+
+func (s *memJobs) FindAll() ([]models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []models.Job
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs, nil
+}
+
+func TestSecondInstanceSkipsLeasedJob(t *testing.T) {
+	store := newMemJobs()
+	a, b := NewScheduler(store), NewScheduler(store)
+
+	var runs int
+	j := job{name: "sweep", interval: time.Minute}
+	j.fn = func(now time.Time) error {
+		runs++
+		// b polls while a still holds the lease
+		b.runIfDue(j)
+		return nil
+	}
+	store.Ensure(j.name, j.interval)
+
+	a.runIfDue(j)
+	if runs != 1 {
+		t.Fatalf("runs = %d, want 1", runs)
+	}
+
+	got := store.jobs[j.name]
+	if got.LeaseOwner != "" || got.Runs != 1 {
+		t.Errorf("job = %+v, want one run with the lease given up", got)
+	}
+
+	// not due again until its interval has passed
+	b.runIfDue(j)
+	if runs != 1 {
+		t.Errorf("runs = %d, want the job left until due", runs)
+	}
+}
+
+func TestExpiredLeaseIsRetaken(t *testing.T) {
+	store := newMemJobs()
+	s := NewScheduler(store)
+
+	var runs int
+	j := job{name: "sweep", interval: time.Minute, fn: func(now time.Time) error {
+		runs++
+		return nil
+	}}
+
+	// an instance stopped mid run and left its lease behind
+	now := time.Now().UTC()
+	store.jobs[j.name] = &models.Job{
+		Name:       j.name,
+		LeaseOwner: "stopped",
+		LeaseUntil: now.Add(time.Minute),
+		NextRunAt:  now.Add(-time.Minute),
+	}
+	s.runIfDue(j)
+	if runs != 0 {
+		t.Fatalf("runs = %d, want the live lease respected", runs)
+	}
+
+	store.jobs[j.name].LeaseUntil = now.Add(-time.Second)
+	s.runIfDue(j)
+	if runs != 1 {
+		t.Fatalf("runs = %d, want the expired lease retaken", runs)
+	}
+	if got := store.jobs[j.name]; got.LeaseOwner != "" || !got.NextRunAt.After(now) {
+		t.Errorf("job = %+v, want the lease given up and the next run scheduled", got)
+	}
+}
+
+func TestLongRunKeepsLease(t *testing.T) {
+	store := newMemJobs()
+	a, b := NewScheduler(store), NewScheduler(store)
+	a.minLease = 30 * time.Millisecond
+
+	var runs int
+	j := job{name: "sweep", interval: time.Millisecond}
+	j.fn = func(now time.Time) error {
+		runs++
+		// b polls after a's first lease would have run out
+		time.Sleep(a.minLease * 3)
+		b.runIfDue(j)
+		return nil
+	}
+	store.Ensure(j.name, j.interval)
+
+	a.runIfDue(j)
+	if runs != 1 {
+		t.Errorf("runs = %d, want the lease renewed while the run lasts", runs)
+	}
+}
+
+func TestFailedRunBacksOff(t *testing.T) {
+	store := newMemJobs()
+	s := NewScheduler(store)
+
+	j := job{name: "sweep", interval: time.Hour, fn: func(now time.Time) error {
+		panic("boom")
+	}}
+	store.Ensure(j.name, j.interval)
+
+	start := time.Now().UTC()
+	s.runIfDue(j)
+
+	got := store.jobs[j.name]
+	if got.ConsecutiveFailures != 1 || got.LastError == "" {
+		t.Fatalf("job = %+v, want a recorded failure", got)
+	}
+	if got.NextRunAt.Before(start.Add(initialBackoff)) || got.NextRunAt.After(start.Add(j.interval)) {
+		t.Errorf("next run at %s, want a retry after %s", got.NextRunAt.Sub(start), initialBackoff)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		interval time.Duration
+		want     time.Duration
+	}{
+		{0, time.Minute, time.Second * 10},
+		{1, time.Minute, time.Second * 20},
+		{2, time.Minute, time.Second * 40},
+		{3, time.Minute, time.Minute},
+		{50, time.Minute, time.Minute},
+		{0, time.Second * 5, time.Second * 5},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.failures, tt.interval); got != tt.want {
+			t.Errorf("backoff(%d, %s) = %s, want %s", tt.failures, tt.interval, got, tt.want)
+		}
+	}
+}
@@ -48,20 +48,3 @@ func GenPasscode() int {
 func Now() string {
 	return time.Now().Format("01-02-2006 15:04:05")
 }
-
-// PostToChain ...
-func PostToChain(endpoint string, payload interface{}) (*http.Response, error) {
-	b, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
-	}
-
-	client := http.Client{Timeout: time.Second * 10}
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(b))
-	if err != nil {
-		return nil, err
-	}
-	req.Close = true
-	req.Header.Add("Content-Type", "application/json")
-	return client.Do(req)
-}